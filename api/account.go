@@ -0,0 +1,269 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/lockout"
+	"github.com/liquiddev99/dropbyte-backend/mailer"
+	"github.com/liquiddev99/dropbyte-backend/token"
+	"github.com/liquiddev99/dropbyte-backend/util"
+	"github.com/liquiddev99/dropbyte-backend/validation"
+)
+
+type accountResponse struct {
+	FullName      string `json:"full_name"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	TotpEnabled   bool   `json:"totp_enabled"`
+}
+
+func newAccountResponse(user db.User) accountResponse {
+	return accountResponse{
+		FullName:      user.FullName,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		TotpEnabled:   user.TotpEnabledAt.Valid,
+	}
+}
+
+type updateUserRequest struct {
+	FullName string `json:"full_name" binding:"required"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password"     binding:"required,password"`
+}
+
+// The password can be left out right after logging in, accounts created
+// through LDAP, OIDC or a login link don't have one.
+type changeEmailRequest struct {
+	Email           string `json:"email"            binding:"required,email"`
+	CurrentPassword string `json:"current_password"`
+}
+
+type deleteUserRequest struct {
+	Password string `json:"password"`
+}
+
+var errReauthRequired = errors.New("Enter your password or log in again to continue")
+
+// checkCurrentPassword loads the user behind the request and checks that
+// password is theirs, or without one that they logged in within
+// REAUTH_DURATION. Wrong passwords count towards the login lockout. On
+// failure the error response is already written.
+func (server *Server) checkCurrentPassword(ctx *gin.Context, password string) (db.User, bool) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
+	user, err := server.db.GetUser(ctx, authPayload.UserId)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return user, false
+	}
+
+	if password == "" {
+		return user, server.checkRecentLogin(ctx)
+	}
+
+	attempt := lockout.Attempt{
+		UserID:    user.ID,
+		Email:     user.Email,
+		ClientIP:  ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	}
+	if !server.checkLockout(ctx, attempt) {
+		return user, false
+	}
+
+	if err := util.CheckPassword(password, user.HashedPassword); err != nil {
+		server.loginFailed(ctx, attempt)
+		err := errors.New("Current password is incorrect")
+		ctx.JSON(http.StatusForbidden, responseError(err))
+		return user, false
+	}
+
+	return user, true
+}
+
+// checkRecentLogin accepts sessions whose login happened within
+// REAUTH_DURATION. Refreshing tokens doesn't count, the first session of a
+// family is the login itself.
+func (server *Server) checkRecentLogin(ctx *gin.Context) bool {
+	session := ctx.MustGet("session").(db.Session)
+
+	login, err := server.db.GetSession(ctx, session.FamilyID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return false
+	}
+
+	if time.Since(login.CreatedAt) > server.config.ReauthDuration {
+		ctx.JSON(http.StatusForbidden, responseError(errReauthRequired))
+		return false
+	}
+	return true
+}
+
+func (server *Server) updateUser(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
+	var req updateUserRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	user, err := server.db.UpdateUserFullName(ctx, db.UpdateUserFullNameParams{
+		ID:       authPayload.UserId,
+		FullName: req.FullName,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newAccountResponse(user))
+}
+
+// changePassword keeps the current device logged in and logs out every other
+// one.
+func (server *Server) changePassword(ctx *gin.Context) {
+	var req changePasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, bindingError(err))
+		return
+	}
+
+	user, ok := server.checkCurrentPassword(ctx, req.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	err := validation.ValidatePersonalInfo(req.NewPassword, user.Email, user.FullName)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"fields": gin.H{"new_password": err.Error()},
+		})
+		return
+	}
+
+	hashedPassword, err := util.HashPassword(req.NewPassword)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	err = server.db.UpdateUserPassword(ctx, db.UpdateUserPasswordParams{
+		ID:             user.ID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	session := ctx.MustGet("session").(db.Session)
+	err = server.db.BlockOtherUserSessions(ctx, db.BlockOtherUserSessionsParams{
+		UserID:   user.ID,
+		FamilyID: session.FamilyID,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.String(http.StatusOK, "OK")
+}
+
+// changeEmail switches the account to a new address, which has to be
+// verified again. The old address is told about the change.
+func (server *Server) changeEmail(ctx *gin.Context) {
+	var req changeEmailRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	user, ok := server.checkCurrentPassword(ctx, req.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	if req.Email == user.Email {
+		ctx.JSON(http.StatusOK, newAccountResponse(user))
+		return
+	}
+
+	updated, err := server.db.UpdateUserEmail(ctx, db.UpdateUserEmailParams{
+		ID:    user.ID,
+		Email: req.Email,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			ctx.JSON(http.StatusBadRequest, responseError(pgErr))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	if err := server.sendVerificationEmail(updated); err != nil {
+		log.Println("Failed to send verification email", updated.ID, err)
+	}
+	if err := server.mailer.Send(mailer.EmailChangedMessage(user.Email, user.FullName, updated.Email)); err != nil {
+		log.Println("Failed to notify previous email", updated.ID, err)
+	}
+
+	ctx.JSON(http.StatusOK, newAccountResponse(updated))
+}
+
+// deleteUser removes the account right away. Its files are purged from
+// storage in the background.
+func (server *Server) deleteUser(ctx *gin.Context) {
+	var req deleteUserRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	user, ok := server.checkCurrentPassword(ctx, req.Password)
+	if !ok {
+		return
+	}
+
+	// Sessions and password resets go with the user.
+	var files []db.File
+	err := server.execTx(ctx, func(q *db.Queries) error {
+		var err error
+		files, err = q.DeleteFilesByOwner(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		return q.DeleteUser(ctx, user.ID)
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	go func() {
+		for _, file := range files {
+			if err := server.releaseFile(context.Background(), file); err != nil {
+				log.Println("Failed to purge file", file.ID, err)
+			}
+		}
+	}()
+
+	server.clearSessionCookies(ctx)
+	ctx.String(http.StatusOK, "OK")
+}
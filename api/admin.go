@@ -0,0 +1,538 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/token"
+	"github.com/liquiddev99/dropbyte-backend/util"
+)
+
+// Admin routes need a login session of an account with the admin role. Every
+// call is written to the audit trail before it is carried out, reads included,
+// so nothing happens to an account without a trace.
+
+const (
+	auditListUsers     = "list_users"
+	auditViewUser      = "view_user"
+	auditViewFiles     = "view_files"
+	auditSuspendUser   = "suspend_user"
+	auditUnsuspendUser = "unsuspend_user"
+	auditForceLogout   = "force_logout"
+	auditUpdateQuota   = "update_quota"
+	auditDeleteFile    = "delete_file"
+	auditViewAuditLog  = "view_audit_log"
+)
+
+const adminDefaultPageSize = 50
+
+var errAccountSuspended = errors.New("Account is suspended")
+
+type adminPageRequest struct {
+	Page     int32 `form:"page"      binding:"omitempty,min=1"`
+	PageSize int32 `form:"page_size" binding:"omitempty,min=1,max=100"`
+}
+
+type listUsersRequest struct {
+	adminPageRequest
+	Search string `form:"search" binding:"max=100"`
+}
+
+type adminUserRequest struct {
+	ID string `form:"id" binding:"required,uuid"`
+}
+
+type adminUserFilesRequest struct {
+	adminPageRequest
+	ID string `form:"id" binding:"required,uuid"`
+}
+
+type adminActionRequest struct {
+	ID     string `json:"id"     binding:"required,uuid"`
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+type updateUserQuotaRequest struct {
+	ID string `json:"id" binding:"required,uuid"`
+	// Quota is in bytes, 0 for no limit and null to go back to the default.
+	Quota *int64 `json:"quota" binding:"omitempty,min=0"`
+}
+
+type adminUserResponse struct {
+	ID            uuid.UUID  `json:"id"`
+	FullName      string     `json:"full_name"`
+	Email         string     `json:"email"`
+	Role          string     `json:"role"`
+	EmailVerified bool       `json:"email_verified"`
+	TotpEnabled   bool       `json:"totp_enabled"`
+	SuspendedAt   *time.Time `json:"suspended_at"`
+	StorageQuota  int64      `json:"storage_quota"`
+	DefaultQuota  bool       `json:"default_quota"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type adminUserUsageResponse struct {
+	adminUserResponse
+	FileCount int64 `json:"file_count"`
+	UsedBytes int64 `json:"used_bytes"`
+}
+
+type auditLogResponse struct {
+	ID           uuid.UUID       `json:"id"`
+	AdminID      uuid.UUID       `json:"admin_id"`
+	Action       string          `json:"action"`
+	TargetUserID *uuid.UUID      `json:"target_user_id"`
+	Details      json.RawMessage `json:"details"`
+	ClientIP     string          `json:"client_ip"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+func (req adminPageRequest) limitOffset() (int32, int32) {
+	pageSize := req.PageSize
+	if pageSize == 0 {
+		pageSize = adminDefaultPageSize
+	}
+	page := req.Page
+	if page == 0 {
+		page = 1
+	}
+	return pageSize, (page - 1) * pageSize
+}
+
+func (server *Server) newAdminUserResponse(user db.User) adminUserResponse {
+	rsp := adminUserResponse{
+		ID:            user.ID,
+		FullName:      user.FullName,
+		Email:         user.Email,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		TotpEnabled:   user.TotpEnabledAt.Valid,
+		StorageQuota:  server.storageQuota(user),
+		DefaultQuota:  !user.StorageQuota.Valid,
+		CreatedAt:     user.CreatedAt,
+	}
+	if user.SuspendedAt.Valid {
+		rsp.SuspendedAt = &user.SuspendedAt.Time
+	}
+	return rsp
+}
+
+// checkSuspended answers 403 for accounts an admin has suspended, which
+// can't log in by any means.
+func checkSuspended(ctx *gin.Context, user db.User) bool {
+	if user.SuspendedAt.Valid {
+		ctx.JSON(http.StatusForbidden, responseError(errAccountSuspended))
+		return false
+	}
+	return true
+}
+
+// requireAdmin goes after the auth middleware. The role is read from the
+// database rather than the token, so demoting an admin takes effect at once.
+func (server *Server) requireAdmin(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
+	user, err := server.db.GetUser(ctx, authPayload.UserId)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, responseError(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	if user.Role != util.RoleAdmin || user.SuspendedAt.Valid {
+		err := errors.New("Only admins can access this endpoint")
+		ctx.AbortWithStatusJSON(http.StatusForbidden, responseError(err))
+		return
+	}
+
+	ctx.Set("admin", user)
+	ctx.Next()
+}
+
+// audit records an admin action. On failure the error response is already
+// written and the action must not go ahead.
+func (server *Server) audit(ctx *gin.Context, action string, target uuid.UUID, details gin.H) bool {
+	admin := ctx.MustGet("admin").(db.User)
+
+	if details == nil {
+		details = gin.H{}
+	}
+	data, err := json.Marshal(details)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return false
+	}
+
+	var targetID pgtype.UUID
+	if target != uuid.Nil {
+		targetID = pgtype.UUID{Bytes: target, Valid: true}
+	}
+
+	_, err = server.db.CreateAdminAuditLog(ctx, db.CreateAdminAuditLogParams{
+		AdminID:      admin.ID,
+		Action:       action,
+		TargetUserID: targetID,
+		Details:      data,
+		ClientIp:     ctx.ClientIP(),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return false
+	}
+	return true
+}
+
+// adminTargetUser loads the account an admin action is about. On failure the
+// error response is already written.
+func (server *Server) adminTargetUser(ctx *gin.Context, id string) (db.User, bool) {
+	user, err := server.db.GetUser(ctx, uuid.MustParse(id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, responseError(errors.New("User not found")))
+			return user, false
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return user, false
+	}
+	return user, true
+}
+
+// escapeLike makes search match literally inside an ILIKE pattern.
+func escapeLike(search string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(search)
+}
+
+// listUsers lists accounts, newest first, optionally only those whose email
+// or name contains search.
+func (server *Server) listUsers(ctx *gin.Context) {
+	var req listUsersRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+	limit, offset := req.limitOffset()
+
+	if !server.audit(ctx, auditListUsers, uuid.Nil, gin.H{"search": req.Search, "offset": offset}) {
+		return
+	}
+
+	users, err := server.db.ListUsers(ctx, db.ListUsersParams{
+		Search: escapeLike(strings.TrimSpace(req.Search)),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	rsp := make([]adminUserResponse, len(users))
+	for i, user := range users {
+		rsp[i] = server.newAdminUserResponse(user)
+	}
+
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// getAdminUser shows an account along with how much storage it uses.
+func (server *Server) getAdminUser(ctx *gin.Context) {
+	var req adminUserRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	user, ok := server.adminTargetUser(ctx, req.ID)
+	if !ok {
+		return
+	}
+
+	if !server.audit(ctx, auditViewUser, user.ID, nil) {
+		return
+	}
+
+	usage, err := server.db.GetUserUsage(ctx, user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, adminUserUsageResponse{
+		adminUserResponse: server.newAdminUserResponse(user),
+		FileCount:         usage.FileCount,
+		UsedBytes:         usage.UsedBytes,
+	})
+}
+
+func (server *Server) getAdminUserFiles(ctx *gin.Context) {
+	var req adminUserFilesRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+	limit, offset := req.limitOffset()
+
+	user, ok := server.adminTargetUser(ctx, req.ID)
+	if !ok {
+		return
+	}
+
+	if !server.audit(ctx, auditViewFiles, user.ID, gin.H{"offset": offset}) {
+		return
+	}
+
+	files, err := server.db.ListFiles(ctx, db.ListFilesParams{
+		Owner:  user.ID,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	rsp := make([]fileResponse, len(files))
+	for i, file := range files {
+		rsp[i] = newFileResponse(file)
+	}
+
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// suspendUser stops an account from logging in and ends its sessions. Its API
+// keys stop working while it stays suspended.
+func (server *Server) suspendUser(ctx *gin.Context) {
+	admin := ctx.MustGet("admin").(db.User)
+
+	var req adminActionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	user, ok := server.adminTargetUser(ctx, req.ID)
+	if !ok {
+		return
+	}
+
+	if user.ID == admin.ID {
+		err := errors.New("Admins cannot suspend themselves")
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+	if user.SuspendedAt.Valid {
+		err := errors.New("Account is already suspended")
+		ctx.JSON(http.StatusConflict, responseError(err))
+		return
+	}
+
+	if !server.audit(ctx, auditSuspendUser, user.ID, gin.H{"reason": req.Reason}) {
+		return
+	}
+
+	if _, err := server.db.SuspendUser(ctx, user.ID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	if err := server.db.BlockUserSessions(ctx, user.ID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	server.respondAdminUser(ctx, user.ID)
+}
+
+// unsuspendUser lets the account log in again. Its old sessions stay revoked.
+func (server *Server) unsuspendUser(ctx *gin.Context) {
+	var req adminActionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	user, ok := server.adminTargetUser(ctx, req.ID)
+	if !ok {
+		return
+	}
+
+	if !user.SuspendedAt.Valid {
+		err := errors.New("Account is not suspended")
+		ctx.JSON(http.StatusConflict, responseError(err))
+		return
+	}
+
+	if !server.audit(ctx, auditUnsuspendUser, user.ID, gin.H{"reason": req.Reason}) {
+		return
+	}
+
+	if _, err := server.db.UnsuspendUser(ctx, user.ID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	server.respondAdminUser(ctx, user.ID)
+}
+
+// forceLogoutUser revokes every session of the account, the same as the user
+// logging out everywhere.
+func (server *Server) forceLogoutUser(ctx *gin.Context) {
+	var req adminActionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	user, ok := server.adminTargetUser(ctx, req.ID)
+	if !ok {
+		return
+	}
+
+	if !server.audit(ctx, auditForceLogout, user.ID, gin.H{"reason": req.Reason}) {
+		return
+	}
+
+	if err := server.db.BlockUserSessions(ctx, user.ID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.String(http.StatusOK, "OK")
+}
+
+// updateUserQuota sets how many bytes the account may store. Files already
+// stored are kept when the quota drops below them, only new uploads fail.
+func (server *Server) updateUserQuota(ctx *gin.Context) {
+	var req updateUserQuotaRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	user, ok := server.adminTargetUser(ctx, req.ID)
+	if !ok {
+		return
+	}
+
+	var quota pgtype.Int8
+	if req.Quota != nil {
+		quota = pgtype.Int8{Int64: *req.Quota, Valid: true}
+	}
+
+	details := gin.H{"quota": req.Quota, "previous_quota": nil}
+	if user.StorageQuota.Valid {
+		details["previous_quota"] = user.StorageQuota.Int64
+	}
+	if !server.audit(ctx, auditUpdateQuota, user.ID, details) {
+		return
+	}
+
+	err := server.db.UpdateUserStorageQuota(ctx, db.UpdateUserStorageQuotaParams{
+		ID:           user.ID,
+		StorageQuota: quota,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	server.respondAdminUser(ctx, user.ID)
+}
+
+// adminDeleteFile removes a file of any user, for abuse.
+func (server *Server) adminDeleteFile(ctx *gin.Context) {
+	var req adminActionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	file, err := server.db.GetFile(ctx, uuid.MustParse(req.ID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, responseError(errors.New("File not found")))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	details := gin.H{
+		"file_id": file.ID,
+		"name":    file.Name,
+		"size":    file.Size,
+		"reason":  req.Reason,
+	}
+	if !server.audit(ctx, auditDeleteFile, file.Owner, details) {
+		return
+	}
+
+	if err := server.removeFile(ctx, file); err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newFileResponse(file))
+}
+
+func (server *Server) getAuditLog(ctx *gin.Context) {
+	var req adminPageRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+	limit, offset := req.limitOffset()
+
+	if !server.audit(ctx, auditViewAuditLog, uuid.Nil, gin.H{"offset": offset}) {
+		return
+	}
+
+	logs, err := server.db.ListAdminAuditLogs(ctx, db.ListAdminAuditLogsParams{
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	rsp := make([]auditLogResponse, len(logs))
+	for i, entry := range logs {
+		rsp[i] = auditLogResponse{
+			ID:        entry.ID,
+			AdminID:   entry.AdminID,
+			Action:    entry.Action,
+			Details:   entry.Details,
+			ClientIP:  entry.ClientIp,
+			CreatedAt: entry.CreatedAt,
+		}
+		if entry.TargetUserID.Valid {
+			target := uuid.UUID(entry.TargetUserID.Bytes)
+			rsp[i].TargetUserID = &target
+		}
+	}
+
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// respondAdminUser answers with the account as it is after an action.
+func (server *Server) respondAdminUser(ctx *gin.Context, id uuid.UUID) {
+	user, err := server.db.GetUser(ctx, id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, server.newAdminUserResponse(user))
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/liquiddev99/dropbyte-backend/apikey"
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/token"
+)
+
+type createApiKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=64"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type deleteApiKeyRequest struct {
+	ID string `json:"id" binding:"required,uuid"`
+}
+
+type apiKeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type createApiKeyResponse struct {
+	apiKeyResponse
+	Key string `json:"key"`
+}
+
+func newApiKeyResponse(key db.ApiKey) apiKeyResponse {
+	rsp := apiKeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+	}
+	if key.ExpiresAt.Valid {
+		rsp.ExpiresAt = &key.ExpiresAt.Time
+	}
+	if key.LastUsedAt.Valid {
+		rsp.LastUsedAt = &key.LastUsedAt.Time
+	}
+	return rsp
+}
+
+// createApiKey issues a key for scripts and CI. The key itself is only
+// returned here, afterwards it can be told apart by its prefix.
+func (server *Server) createApiKey(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
+	var req createApiKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	for _, scope := range req.Scopes {
+		if !apikey.ValidScope(scope) {
+			err := fmt.Errorf("Unknown scope %q", scope)
+			ctx.JSON(http.StatusBadRequest, responseError(err))
+			return
+		}
+	}
+
+	var expiresAt pgtype.Timestamptz
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			err := errors.New("Expiry must be in the future")
+			ctx.JSON(http.StatusBadRequest, responseError(err))
+			return
+		}
+		expiresAt = pgtype.Timestamptz{Time: *req.ExpiresAt, Valid: true}
+	}
+
+	key, hash, err := apikey.Generate()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	apiKey, err := server.db.CreateApiKey(ctx, db.CreateApiKeyParams{
+		UserID:    authPayload.UserId,
+		Name:      req.Name,
+		Prefix:    key[:apikey.PrefixLength],
+		KeyHash:   hash,
+		Scopes:    req.Scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, createApiKeyResponse{
+		apiKeyResponse: newApiKeyResponse(apiKey),
+		Key:            key,
+	})
+}
+
+func (server *Server) getApiKeys(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
+	keys, err := server.db.ListApiKeys(ctx, authPayload.UserId)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	rsp := make([]apiKeyResponse, len(keys))
+	for i, key := range keys {
+		rsp[i] = newApiKeyResponse(key)
+	}
+
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+func (server *Server) deleteApiKey(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
+	var req deleteApiKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	rows, err := server.db.DeleteApiKey(ctx, db.DeleteApiKeyParams{
+		ID:     uuid.MustParse(req.ID),
+		UserID: authPayload.UserId,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+	if rows == 0 {
+		ctx.JSON(http.StatusNotFound, responseError(errors.New("API key not found")))
+		return
+	}
+
+	ctx.String(http.StatusOK, "OK")
+}
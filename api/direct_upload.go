@@ -0,0 +1,298 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/request"
+)
+
+// Direct uploads let the browser send the file straight to B2. The server
+// only reserves the upload and presigns a PUT of the declared object through
+// the S3-compatible API, then checks the stored object against the
+// reservation before the file is recorded.
+//
+// The bytes never pass through the server, so they are stored as sent. Clients
+// that need confidentiality encrypt them and pass the e2e metadata.
+
+type directUploadRequest struct {
+	Name          string `json:"name"           binding:"required_without=EncryptedName,max=1024"`
+	Size          int64  `json:"size"           binding:"required,min=1"`
+	Sha1          string `json:"sha1"           binding:"required,len=40,hexadecimal,lowercase"`
+	EncryptedName string `json:"encrypted_name" binding:"max=1024"`
+	ChunkSize     int32  `json:"chunk_size"     binding:"required_with=EncryptedName,min=0,max=16777216"`
+	KeyHint       string `json:"key_hint"       binding:"max=64"`
+}
+
+// directUploadResponse tells the client where and how to upload. The file is
+// sent with a PUT to UploadUrl carrying Headers, and the URL stops working at
+// ExpiresAt. It is only good for FileName with the declared length and SHA-1.
+type directUploadResponse struct {
+	ID            uuid.UUID         `json:"id"`
+	UploadUrl     string            `json:"upload_url"`
+	Headers       map[string]string `json:"headers"`
+	FileName      string            `json:"file_name"`
+	ContentSha1   string            `json:"content_sha1"`
+	ContentLength int64             `json:"content_length"`
+	ExpiresAt     time.Time         `json:"expires_at"`
+}
+
+type completeDirectUploadRequest struct {
+	ID string `json:"id" binding:"required,uuid"`
+}
+
+func (server *Server) createDirectUpload(ctx *gin.Context) {
+	var req directUploadRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	if server.config.B2S3Endpoint == "" {
+		err := errors.New("Direct uploads are not enabled")
+		ctx.JSON(http.StatusNotImplemented, responseError(err))
+		return
+	}
+
+	if !server.checkUploadSize(ctx, uploadOwner(ctx), req.Size) {
+		return
+	}
+
+	fileName := uuid.NewString()
+	presigned, err := request.PresignUpload(
+		server.config.B2S3Endpoint,
+		server.config.B2S3Region,
+		server.config.B2ApplicationKeyId,
+		server.config.B2ApplicationKey,
+		server.config.BucketName,
+		fileName,
+		req.Size,
+		req.Sha1,
+		server.config.DirectUploadDuration,
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	// The reservation lasts exactly as long as the presigned URL.
+	arg := db.CreateDirectUploadParams{
+		Owner:     uploadOwner(ctx),
+		FileName:  fileName,
+		Name:      req.Name,
+		Size:      req.Size,
+		Sha1:      req.Sha1,
+		ExpiresAt: presigned.ExpiresAt,
+	}
+	if req.EncryptedName != "" {
+		arg.Name = ""
+		arg.E2e = true
+		arg.EncryptedName = req.EncryptedName
+		arg.ChunkSize = req.ChunkSize
+		arg.KeyHint = req.KeyHint
+	}
+
+	upload, err := server.db.CreateDirectUpload(ctx, arg)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, directUploadResponse{
+		ID:            upload.ID,
+		UploadUrl:     presigned.Url,
+		Headers:       presigned.Headers,
+		FileName:      upload.FileName,
+		ContentSha1:   upload.Sha1,
+		ContentLength: upload.Size,
+		ExpiresAt:     presigned.ExpiresAt,
+	})
+}
+
+// completeDirectUpload records the file once the object uploaded to B2
+// matches the reservation. A mismatching object is deleted and the
+// reservation is dropped.
+func (server *Server) completeDirectUpload(ctx *gin.Context) {
+	var req completeDirectUploadRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	upload, err := server.db.GetDirectUpload(ctx, uuid.MustParse(req.ID))
+	if err == nil && upload.Owner != uploadOwner(ctx) {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, responseError(errors.New("Upload not found")))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	if time.Now().After(upload.ExpiresAt) {
+		ctx.JSON(http.StatusGone, responseError(errors.New("Upload has expired")))
+		return
+	}
+
+	authResponse, err := request.AuthorizeAccount(
+		server.config.B2ApplicationKeyId,
+		server.config.B2ApplicationKey,
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	// The presigned URL only stores the reserved name, so that is where the
+	// file is.
+	info, found, err := request.FindFileByName(
+		server.config.BucketId,
+		upload.FileName,
+		authResponse.AuthorizationToken,
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+	if !found {
+		err := errors.New("Nothing has been uploaded yet")
+		ctx.JSON(http.StatusUnprocessableEntity, responseError(err))
+		return
+	}
+
+	if info.FileName != upload.FileName || info.BucketId != server.config.BucketId {
+		err := errors.New("File doesn't belong to this upload")
+		ctx.JSON(http.StatusUnprocessableEntity, responseError(err))
+		return
+	}
+
+	if info.ContentLength != upload.Size || info.ContentSha1 != upload.Sha1 {
+		server.deleteStoredFile(info.FileId, info.FileName)
+		if err := server.db.DeleteDirectUpload(ctx, upload.ID); err != nil {
+			log.Println("Failed to delete direct upload", upload.ID, err)
+		}
+
+		err := errors.New("Uploaded file doesn't match the declared size and sha1")
+		ctx.JSON(http.StatusUnprocessableEntity, responseError(err))
+		return
+	}
+
+	// Only one completion may turn the reservation into a file.
+	if _, err := server.db.ClaimDirectUpload(ctx, upload.ID); err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.JSON(http.StatusConflict, responseError(errors.New("Upload is already completed")))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	blob, err := server.acquireStoredBlob(ctx, upload, info.FileId, info.ContentType)
+	if err != nil {
+		server.deleteStoredFile(info.FileId, info.FileName)
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	var e2e *e2eUploadRequest
+	if upload.E2e {
+		e2e = &e2eUploadRequest{
+			EncryptedName: upload.EncryptedName,
+			ChunkSize:     upload.ChunkSize,
+			KeyHint:       upload.KeyHint,
+		}
+	}
+
+	created, err := server.createFile(ctx, newCreateFileParams(upload.Owner, upload.Name, e2e), blob)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, responseFile{
+		ID:       created.ID,
+		FileID:   created.FileID,
+		BucketID: created.BucketID,
+		FileName: created.Name,
+		Size:     uint(blob.Size),
+		FileType: created.FileType,
+	})
+}
+
+// acquireStoredBlob records the content the client has stored as fileId as a
+// blob of its own. It was stored as sent, so it is never shared with other
+// uploads of the same content, which expect it to be encrypted.
+func (server *Server) acquireStoredBlob(
+	ctx context.Context,
+	upload db.DirectUpload,
+	fileId string,
+	contentType string,
+) (db.Blob, error) {
+	return server.db.CreateBlob(ctx, db.CreateBlobParams{
+		Sha1:        upload.Sha1,
+		Size:        upload.Size,
+		FileID:      fileId,
+		BucketID:    server.config.BucketId,
+		FileName:    upload.FileName,
+		ContentType: contentType,
+	})
+}
+
+// removeExpiredDirectUploads drops reservations that were never completed,
+// along with anything the client managed to upload for them.
+func (server *Server) removeExpiredDirectUploads() {
+	ctx := context.Background()
+
+	uploads, err := server.db.ListExpiredDirectUploads(ctx)
+	if err != nil {
+		log.Println("Failed to list expired direct uploads", err)
+		return
+	}
+	if len(uploads) == 0 {
+		return
+	}
+
+	authResponse, err := request.AuthorizeAccount(
+		server.config.B2ApplicationKeyId,
+		server.config.B2ApplicationKey,
+	)
+	if err != nil {
+		log.Println("Failed to authorize b2 account", err)
+		return
+	}
+
+	for _, upload := range uploads {
+		info, found, err := request.FindFileByName(
+			server.config.BucketId,
+			upload.FileName,
+			authResponse.AuthorizationToken,
+		)
+		if err != nil {
+			log.Println("Failed to look up expired direct upload", upload.ID, err)
+			continue
+		}
+
+		if found {
+			_, err := request.DeleteFileById(info.FileId, info.FileName, authResponse.AuthorizationToken)
+			if err != nil {
+				log.Println("Failed to delete expired direct upload", upload.ID, err)
+				continue
+			}
+		}
+
+		if err := server.db.DeleteDirectUpload(ctx, upload.ID); err != nil {
+			log.Println("Failed to delete direct upload", upload.ID, err)
+		}
+	}
+}
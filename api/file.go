@@ -1,22 +1,79 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 
+	"github.com/liquiddev99/dropbyte-backend/apikey"
 	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/encryption"
 	"github.com/liquiddev99/dropbyte-backend/request"
 	"github.com/liquiddev99/dropbyte-backend/token"
 )
 
+// Clients from before files had their own id send the B2 file_id instead,
+// and file_name which is no longer needed. Both are still accepted.
 type deteleFileRequest struct {
-	FileId   string `json:"file_id"   binding:"required"`
-	FileName string `json:"file_name" binding:"required"`
+	ID       string `json:"id"        binding:"required_without=FileId,omitempty,uuid"`
+	FileId   string `json:"file_id"`
+	FileName string `json:"file_name"`
 }
 
 type downloadFileRequest struct {
-	FileId string `form:"file_id" binding:"required"`
+	ID     string `form:"id"      binding:"required_without=FileId,omitempty,uuid"`
+	FileId string `form:"file_id"`
+}
+
+type e2eFileRequest struct {
+	ID string `form:"id" binding:"required,uuid"`
+}
+
+type fileResponse struct {
+	ID            uuid.UUID `json:"id"`
+	FileID        string    `json:"file_id"`
+	BucketID      string    `json:"bucket_id"`
+	Owner         uuid.UUID `json:"owner"`
+	Name          string    `json:"name"`
+	Size          string    `json:"size"`
+	Favourite     bool      `json:"favourite"`
+	FileType      string    `json:"file_type"`
+	LastModified  string    `json:"last_modified"`
+	CreatedAt     time.Time `json:"created_at"`
+	E2E           bool      `json:"e2e"`
+	EncryptedName string    `json:"encrypted_name,omitempty"`
+	ChunkSize     int32     `json:"chunk_size,omitempty"`
+	KeyHint       string    `json:"key_hint,omitempty"`
+}
+
+func newFileResponse(file db.File) fileResponse {
+	return fileResponse{
+		ID:            file.ID,
+		FileID:        file.FileID,
+		BucketID:      file.BucketID,
+		Owner:         file.Owner,
+		Name:          file.Name,
+		Size:          file.Size,
+		Favourite:     file.Favourite,
+		FileType:      file.FileType,
+		LastModified:  file.LastModified,
+		CreatedAt:     file.CreatedAt,
+		E2E:           file.E2e,
+		EncryptedName: file.EncryptedName,
+		ChunkSize:     file.ChunkSize,
+		KeyHint:       file.KeyHint,
+	}
 }
 
 func (server *Server) getFiles(ctx *gin.Context) {
@@ -34,16 +91,250 @@ func (server *Server) getFiles(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, files)
+	rsp := make([]fileResponse, len(files))
+	for i, file := range files {
+		rsp[i] = newFileResponse(file)
+	}
+
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// getOwnedFile loads the file with the given id and checks that it belongs to
+// the caller, and that their token isn't bound to another file. On failure the
+// error response is already written.
+func (server *Server) getOwnedFile(ctx *gin.Context, id string, authPayload *token.Payload) (db.File, bool) {
+	if !authPayload.AllowsResource(id) {
+		err := errors.New("Token is not valid for this file")
+		ctx.JSON(http.StatusForbidden, responseError(err))
+		return db.File{}, false
+	}
+
+	file, err := server.db.GetFile(ctx, uuid.MustParse(id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, responseError(err))
+			return file, false
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return file, false
+	}
+
+	if file.Owner != authPayload.UserId {
+		err := errors.New("File doesn't belong to the authenticated user")
+		ctx.JSON(http.StatusForbidden, responseError(err))
+		return file, false
+	}
+
+	return file, true
+}
+
+// legacyFileID returns id, or when a client only sent the B2 file id, the id
+// of the caller's file stored under it.
+func (server *Server) legacyFileID(
+	ctx *gin.Context,
+	id string,
+	b2FileId string,
+	authPayload *token.Payload,
+) (string, bool) {
+	if id != "" {
+		return id, true
+	}
+
+	file, err := server.db.GetFileByFileId(ctx, db.GetFileByFileIdParams{
+		Owner:  authPayload.UserId,
+		FileID: b2FileId,
+	})
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, responseError(err))
+			return "", false
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return "", false
+	}
+
+	return file.ID.String(), true
+}
+
+type createDownloadTokenRequest struct {
+	ID string `json:"id" binding:"required,uuid"`
+}
+
+type downloadTokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// createDownloadToken mints a short-lived token that can only download one
+// file. It can be handed to someone else and stops working when the session
+// that created it is revoked.
+func (server *Server) createDownloadToken(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
+	var req createDownloadTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	file, ok := server.getOwnedFile(ctx, req.ID, authPayload)
+	if !ok {
+		return
+	}
+
+	// Links shared from an API key are revoked with the key, the others with
+	// the session.
+	claims := token.Claims{
+		Audience: token.AudienceShare,
+		Scopes:   []string{apikey.ScopeFilesRead},
+		Resource: file.ID.String(),
+	}
+	if key, ok := ctx.Get("api_key"); ok {
+		claims.KeyId = key.(db.ApiKey).ID
+	}
+
+	downloadToken, payload, err := server.token.CreateScopedToken(
+		authPayload.UserId,
+		authPayload.SessionId,
+		token.AccessToken,
+		claims,
+		server.config.DownloadTokenDuration,
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, downloadTokenResponse{
+		Token:     downloadToken,
+		ExpiresAt: payload.ExpiredAt,
+	})
 }
 
 func (server *Server) downloadFileById(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
 	var req downloadFileRequest
 	if err := ctx.ShouldBindQuery(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, responseError(err))
 		return
 	}
 
+	id, ok := server.legacyFileID(ctx, req.ID, req.FileId, authPayload)
+	if !ok {
+		return
+	}
+
+	file, ok := server.getOwnedFile(ctx, id, authPayload)
+	if !ok {
+		return
+	}
+
+	server.serveFile(ctx, file)
+}
+
+// getE2EFile returns the public metadata of an end-to-end encrypted drop.
+// Knowing the id is enough, the content is useless without the key from the
+// link fragment.
+func (server *Server) getE2EFile(ctx *gin.Context) {
+	file, ok := server.getE2EFileByID(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"id":             file.ID,
+		"size":           file.Size,
+		"encrypted_name": file.EncryptedName,
+		"chunk_size":     file.ChunkSize,
+		"key_hint":       file.KeyHint,
+		"created_at":     file.CreatedAt,
+	})
+}
+
+func (server *Server) downloadE2EFile(ctx *gin.Context) {
+	file, ok := server.getE2EFileByID(ctx)
+	if !ok {
+		return
+	}
+
+	server.serveFile(ctx, file)
+}
+
+func (server *Server) getE2EFileByID(ctx *gin.Context) (db.File, bool) {
+	var req e2eFileRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return db.File{}, false
+	}
+
+	file, err := server.db.GetFile(ctx, uuid.MustParse(req.ID))
+	if err == nil && !file.E2e {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, responseError(err))
+			return file, false
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return file, false
+	}
+
+	return file, true
+}
+
+// serveFile streams file to the client, honouring a single-range Range
+// header. Encrypted files are decrypted chunk by chunk, fetching only the
+// chunks that cover the requested range.
+func (server *Server) serveFile(ctx *gin.Context, file db.File) {
+	size, err := strconv.ParseInt(file.Size, 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	start, end, partial, err := parseRange(ctx.GetHeader("Range"), size)
+	if err != nil {
+		ctx.Header("Content-Range", fmt.Sprintf("bytes */%d", size))
+		ctx.JSON(http.StatusRequestedRangeNotSatisfiable, responseError(err))
+		return
+	}
+
+	// The real name of an end-to-end encrypted file is only known to clients.
+	fileName := file.Name
+	if file.E2e {
+		fileName = file.ID.String()
+	}
+
+	extraHeaders := map[string]string{
+		"Accept-Ranges":       "bytes",
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": fileName}),
+	}
+	status := http.StatusOK
+	if partial {
+		status = http.StatusPartialContent
+		extraHeaders["Content-Range"] = fmt.Sprintf("bytes %d-%d/%d", start, end, size)
+	}
+
+	if size == 0 {
+		ctx.DataFromReader(status, 0, "application/octet-stream", http.NoBody, extraHeaders)
+		return
+	}
+
+	var stream *encryption.Stream
+	byteRange := fmt.Sprintf("bytes=%d-%d", start, end)
+	if file.WrappedKey != nil {
+		stream, err = server.fileStream(ctx, file)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, responseError(err))
+			return
+		}
+
+		cipherStart, cipherEnd := stream.CiphertextRange(size, start, end)
+		byteRange = fmt.Sprintf("bytes=%d-%d", cipherStart, cipherEnd)
+	}
+
 	authResponse, err := request.AuthorizeAccount(
 		server.config.B2ApplicationKeyId,
 		server.config.B2ApplicationKey,
@@ -53,42 +344,178 @@ func (server *Server) downloadFileById(ctx *gin.Context) {
 		return
 	}
 
-	res, err := request.DownloadFileById(req.FileId, authResponse.AuthorizationToken)
+	res, err := request.OpenFileById(file.FileID, authResponse.AuthorizationToken, byteRange)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, responseError(err))
 		return
 	}
+	defer res.Body.Close()
+
+	var body io.Reader = res.Body
+	if stream != nil {
+		body = stream.NewRangeReader(res.Body, size, start, end)
+	}
+
+	ctx.DataFromReader(status, end-start+1, "application/octet-stream", body, extraHeaders)
+}
+
+// fileStream unwraps the data key of an encrypted file with its owner's KEK.
+func (server *Server) fileStream(ctx context.Context, file db.File) (*encryption.Stream, error) {
+	kek, err := server.keyring.UserKey(ctx, file.Owner)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := encryption.UnwrapKey(kek, file.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := server.db.GetBlob(ctx, file.BlobID)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := encryption.ParseHeader(blob.EncryptionHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	return encryption.NewStream(dataKey, header)
+}
+
+// parseRange parses a single "bytes=" range against a resource of size bytes
+// and returns the inclusive byte range to serve.
+func parseRange(header string, size int64) (start int64, end int64, partial bool, err error) {
+	if header == "" {
+		return 0, size - 1, false, nil
+	}
+
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, errors.New("Only a single bytes range is supported")
+	}
+
+	first, last, found := strings.Cut(spec, "-")
+	if !found {
+		return 0, 0, false, errors.New("Invalid range")
+	}
+
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix <= 0 {
+			return 0, 0, false, errors.New("Invalid range")
+		}
+		if suffix > size {
+			suffix = size
+		}
+		start, end = size-suffix, size-1
+	} else {
+		start, err = strconv.ParseInt(first, 10, 64)
+		if err != nil {
+			return 0, 0, false, errors.New("Invalid range")
+		}
+		end = size - 1
+		if last != "" {
+			end, err = strconv.ParseInt(last, 10, 64)
+			if err != nil {
+				return 0, 0, false, errors.New("Invalid range")
+			}
+			if end >= size {
+				end = size - 1
+			}
+		}
+	}
 
-	ctx.Data(http.StatusOK, "application/octet-stream", res)
+	if start < 0 || start > end || start >= size {
+		return 0, 0, false, errors.New("Range not satisfiable")
+	}
+
+	return start, end, true, nil
 }
 
 func (server *Server) deleteFileById(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
 	var req deteleFileRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, responseError(err))
 		return
 	}
 
-	authResponse, err := request.AuthorizeAccount(
-		server.config.B2ApplicationKeyId,
-		server.config.B2ApplicationKey,
-	)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, responseError(err))
+	id, ok := server.legacyFileID(ctx, req.ID, req.FileId, authPayload)
+	if !ok {
 		return
 	}
 
-	res, err := request.DeleteFileById(req.FileId, req.FileName, authResponse.AuthorizationToken)
-	if err != nil {
-		ctx.JSON(res.StatusCode, responseError(err))
+	file, ok := server.getOwnedFile(ctx, id, authPayload)
+	if !ok {
 		return
 	}
 
-	err = server.db.DeleteFile(ctx, req.FileId)
-	if err != nil {
+	if err := server.removeFile(ctx, file); err != nil {
 		ctx.JSON(http.StatusInternalServerError, responseError(err))
 		return
 	}
 
-	ctx.JSON(http.StatusOK, res)
+	ctx.JSON(http.StatusOK, newFileResponse(file))
+}
+
+// removeFile deletes the file and its content once nothing else references it.
+func (server *Server) removeFile(ctx context.Context, file db.File) error {
+	if err := server.db.DeleteFile(ctx, file.ID); err != nil {
+		return err
+	}
+	return server.releaseFile(ctx, file)
+}
+
+// releaseFile frees the storage of a file whose row is already gone.
+func (server *Server) releaseFile(ctx context.Context, file db.File) error {
+	// Files uploaded before deduplication own their B2 object outright.
+	if file.BlobID == uuid.Nil {
+		return server.deleteStoredFile(file.FileID, file.Name)
+	}
+	return server.releaseBlob(ctx, file.BlobID)
+}
+
+// releaseBlob drops one reference to a blob and removes it from B2 once
+// nothing references it anymore.
+func (server *Server) releaseBlob(ctx context.Context, blobID uuid.UUID) error {
+	blob, err := server.db.ReleaseBlob(ctx, blobID)
+	if err != nil {
+		return err
+	}
+	if blob.RefCount > 0 {
+		return nil
+	}
+
+	blob, err = server.db.DeleteUnreferencedBlob(ctx, blobID)
+	if err != nil {
+		// Someone referenced the blob again before we could delete it.
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	return server.deleteStoredFile(blob.FileID, blob.FileName)
+}
+
+func (server *Server) deleteStoredFile(fileId string, fileName string) error {
+	authResponse, err := request.AuthorizeAccount(
+		server.config.B2ApplicationKeyId,
+		server.config.B2ApplicationKey,
+	)
+	if err != nil {
+		log.Println("Failed to authorize b2 account", err)
+		return err
+	}
+
+	_, err = request.DeleteFileById(fileId, fileName, authResponse.AuthorizationToken)
+	if err != nil {
+		log.Println("Failed to delete file from b2", fileId, err)
+		return err
+	}
+
+	return nil
 }
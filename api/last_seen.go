@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+)
+
+// lastSeenRecorder collects session activity in memory and writes it in one
+// statement per interval, so authenticated requests do not each cost an
+// UPDATE. Activity is tracked per session family, which is one device.
+type lastSeenRecorder struct {
+	store *db.Queries
+	mu    sync.Mutex
+	seen  map[uuid.UUID]time.Time
+}
+
+func newLastSeenRecorder(store *db.Queries) *lastSeenRecorder {
+	return &lastSeenRecorder{store: store, seen: map[uuid.UUID]time.Time{}}
+}
+
+func (recorder *lastSeenRecorder) touch(familyID uuid.UUID) {
+	recorder.mu.Lock()
+	recorder.seen[familyID] = time.Now()
+	recorder.mu.Unlock()
+}
+
+func (recorder *lastSeenRecorder) flush(ctx context.Context) error {
+	recorder.mu.Lock()
+	seen := recorder.seen
+	recorder.seen = map[uuid.UUID]time.Time{}
+	recorder.mu.Unlock()
+
+	if len(seen) == 0 {
+		return nil
+	}
+
+	arg := db.UpdateSessionsLastSeenParams{
+		FamilyIds:   make([]uuid.UUID, 0, len(seen)),
+		LastSeenAts: make([]time.Time, 0, len(seen)),
+	}
+	for familyID, lastSeen := range seen {
+		arg.FamilyIds = append(arg.FamilyIds, familyID)
+		arg.LastSeenAts = append(arg.LastSeenAts, lastSeen)
+	}
+
+	return recorder.store.UpdateSessionsLastSeen(ctx, arg)
+}
+
+func (recorder *lastSeenRecorder) start(interval time.Duration) {
+	ticker := time.Tick(interval)
+
+	go func() {
+		for {
+			<-ticker
+			if err := recorder.flush(context.Background()); err != nil {
+				log.Println("Failed to update session last seen", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/lockout"
+	"github.com/liquiddev99/dropbyte-backend/token"
+)
+
+// errInvalidCredentials is the one answer to a failed login, whether the
+// email has no account or the password is wrong.
+var errInvalidCredentials = errors.New("Invalid email or password")
+
+type loginAttemptResponse struct {
+	ID        uuid.UUID `json:"id"`
+	ClientIP  string    `json:"client_ip"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// checkLockout answers 429 while the email or client IP of attempt is locked.
+func (server *Server) checkLockout(ctx *gin.Context, attempt lockout.Attempt) bool {
+	err := server.lockout.Check(ctx, attempt.Email, attempt.ClientIP)
+	if err == nil {
+		return true
+	}
+
+	if locked, ok := err.(*lockout.LockedError); ok {
+		retryAfter := int(locked.RetryAfter.Seconds()) + 1
+		ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+		ctx.JSON(http.StatusTooManyRequests, responseError(err))
+		return false
+	}
+
+	ctx.JSON(http.StatusInternalServerError, responseError(err))
+	return false
+}
+
+// loginFailed and loginSucceeded only log failures, the login itself has
+// been decided by then.
+func (server *Server) loginFailed(ctx *gin.Context, attempt lockout.Attempt) {
+	if err := server.lockout.Fail(ctx, attempt); err != nil {
+		log.Println("Failed to record failed login", err)
+	}
+}
+
+func (server *Server) loginSucceeded(ctx *gin.Context, attempt lockout.Attempt) {
+	if err := server.lockout.Succeed(ctx, attempt); err != nil {
+		log.Println("Failed to record login", err)
+	}
+}
+
+// getLoginHistory lists the latest logins to the account, including failed
+// ones, so the user can spot someone else trying.
+func (server *Server) getLoginHistory(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
+	attempts, err := server.db.ListLoginAttempts(ctx, db.ListLoginAttemptsParams{
+		UserID: authPayload.UserId,
+		Limit:  100,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	rsp := make([]loginAttemptResponse, len(attempts))
+	for i, attempt := range attempts {
+		rsp[i] = loginAttemptResponse{
+			ID:        attempt.ID,
+			ClientIP:  attempt.ClientIp,
+			UserAgent: attempt.UserAgent,
+			Success:   attempt.Success,
+			CreatedAt: attempt.CreatedAt,
+		}
+	}
+
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// removeStaleLoginThrottles drops failure counts that no longer matter and
+// login history past its retention.
+func (server *Server) removeStaleLoginThrottles() {
+	err := server.lockout.Prune(context.Background(), server.config.LoginHistoryRetention)
+	if err != nil {
+		log.Println("Failed to prune login attempts", err)
+	}
+}
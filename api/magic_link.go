@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/lockout"
+	"github.com/liquiddev99/dropbyte-backend/mailer"
+	"github.com/liquiddev99/dropbyte-backend/token"
+)
+
+// Magic links log in without a password. Like reset tokens they are random,
+// stored as a SHA-256, short-lived and work once. They are tied to an email
+// rather than a user, so with MAGIC_LINK_SIGNUP the account can be created
+// when the link is followed.
+
+type requestMagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type magicLinkLoginRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+var errInvalidMagicLink = errors.New("Invalid or expired login link")
+
+func hashMagicLinkToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// requestMagicLink answers the same whether or not the email has an account,
+// and sends the link in the background.
+func (server *Server) requestMagicLink(ctx *gin.Context) {
+	var req requestMagicLinkRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	go func() {
+		if err := server.sendMagicLink(context.Background(), req.Email); err != nil {
+			log.Println("Failed to send login link", err)
+		}
+	}()
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "If this email can log in, a login link has been sent",
+	})
+}
+
+func (server *Server) sendMagicLink(ctx context.Context, email string) error {
+	// The route is limited by IP, this keeps one inbox from being flooded
+	// from many.
+	allowed, _, err := server.limiter.Allow(ctx, "magic_link", "email:"+email)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return nil
+	}
+
+	if !server.config.MagicLinkSignup {
+		_, err := server.db.GetUserByEmail(ctx, email)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	_, err = server.db.CreateMagicLink(ctx, db.CreateMagicLinkParams{
+		Email:     email,
+		TokenHash: hashMagicLinkToken(token),
+		ExpiresAt: time.Now().Add(server.config.MagicLinkDuration),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := server.config.MagicLinkUrl + "?" + url.Values{"token": {token}}.Encode()
+	return server.mailer.Send(mailer.MagicLinkMessage(email, link, server.config.MagicLinkDuration))
+}
+
+// magicLinkLogin exchanges a login link for a session, the same as loginUser
+// would after a password. Accounts with two-factor authentication get an MFA
+// challenge instead, the link only proves the email.
+func (server *Server) magicLinkLogin(ctx *gin.Context) {
+	var req magicLinkLoginRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	link, err := server.db.UseMagicLink(ctx, hashMagicLinkToken(req.Token))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.JSON(http.StatusUnauthorized, responseError(errInvalidMagicLink))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	if err := server.db.InvalidateMagicLinks(ctx, link.Email); err != nil {
+		log.Println("Failed to invalidate login links", link.Email, err)
+	}
+
+	user, err := server.magicLinkUser(ctx, link.Email)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.JSON(http.StatusUnauthorized, responseError(errInvalidMagicLink))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+	if !checkSuspended(ctx, user) {
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		mfaToken, mfaPayload, err := server.token.CreateToken(
+			user.ID,
+			uuid.Nil,
+			token.MFAToken,
+			server.config.MFAChallengeDuration,
+		)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, responseError(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, mfaChallengeResponse{
+			MFARequired:       true,
+			MFAToken:          mfaToken,
+			MFATokenExpiresAt: mfaPayload.ExpiredAt,
+		})
+		return
+	}
+
+	server.loginSucceeded(ctx, lockout.Attempt{
+		UserID:    user.ID,
+		Email:     user.Email,
+		ClientIP:  ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	})
+
+	tokens, err := server.createSession(ctx, user.ID, uuid.Nil)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	server.setSessionCookies(ctx, tokens)
+
+	ctx.JSON(http.StatusOK, newUserResponse(user, tokens))
+}
+
+// magicLinkUser returns the account of email, creating it if sign up through
+// links is enabled. Following the link proves the address, so an unverified
+// account is claimed the same way as through an identity provider.
+func (server *Server) magicLinkUser(ctx context.Context, email string) (db.User, error) {
+	user, err := server.db.GetUserByEmail(ctx, email)
+	switch {
+	case err == pgx.ErrNoRows && server.config.MagicLinkSignup:
+		return server.provisionMagicLinkUser(ctx, email)
+	case err != nil:
+		return db.User{}, err
+	case !user.EmailVerifiedAt.Valid:
+		if err := server.claimUnverifiedUser(ctx, user); err != nil {
+			return db.User{}, err
+		}
+		return server.db.GetUser(ctx, user.ID)
+	}
+	return user, nil
+}
+
+func (server *Server) provisionMagicLinkUser(ctx context.Context, email string) (db.User, error) {
+	hashedPassword, err := unusablePassword()
+	if err != nil {
+		return db.User{}, err
+	}
+
+	user, err := server.db.CreateUser(ctx, db.CreateUserParams{
+		FullName:       email,
+		Email:          email,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		return db.User{}, err
+	}
+
+	_, err = server.db.VerifyUserEmail(ctx, db.VerifyUserEmailParams{ID: user.ID, Email: user.Email})
+	if err != nil {
+		return db.User{}, err
+	}
+	return server.db.GetUser(ctx, user.ID)
+}
+
+// removeExpiredMagicLinks drops login links that were never followed.
+func (server *Server) removeExpiredMagicLinks() {
+	if err := server.db.DeleteExpiredMagicLinks(context.Background()); err != nil {
+		log.Println("Failed to delete expired login links", err)
+	}
+}
@@ -5,46 +5,230 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 
+	"github.com/liquiddev99/dropbyte-backend/apikey"
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
 	"github.com/liquiddev99/dropbyte-backend/token"
+	"github.com/liquiddev99/dropbyte-backend/util"
 )
 
-func authMiddleware(token token.Token) gin.HandlerFunc {
+// authMiddleware accepts access tokens whose session is still active, so
+// logging out revokes them immediately instead of at expiry. The token comes
+// from the Authorization header or, for browsers, the access_token cookie.
+//
+// Routes declare the scope they require and the token audiences they accept.
+// API keys and scoped tokens are only accepted when scope is set and was
+// granted to them, everything else needs a full login session.
+func authMiddleware(
+	tokenMaker token.Token,
+	store *db.Queries,
+	csrfKey []byte,
+	lastSeen *lastSeenRecorder,
+	keyUsage *apikey.UsageRecorder,
+	scope string,
+	audiences []string,
+) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		authHeader := ctx.GetHeader("authorization")
+		fromCookie := false
 
+		var access_token string
 		if len(authHeader) == 0 {
-			err := errors.New("Authorization header is not provided")
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, responseError(err))
+			cookie, err := ctx.Cookie("access_token")
+			if err != nil || cookie == "" {
+				err := errors.New("Authorization header is not provided")
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, responseError(err))
+				return
+			}
+			access_token = cookie
+			fromCookie = true
+		} else {
+			fields := strings.Fields(authHeader)
+			if len(fields) < 2 {
+				err := errors.New("Invalid Authorization header formar")
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, responseError(err))
+				return
+			}
+
+			if authType := strings.ToLower(fields[0]); authType != "bearer" {
+				err := fmt.Errorf("Unsupport authorization type %s", authType)
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, responseError(err))
+				return
+			}
+
+			access_token = fields[1]
+		}
+
+		if !fromCookie && apikey.IsKey(access_token) {
+			authorizeApiKey(ctx, store, keyUsage, access_token, scope)
 			return
 		}
 
-		fields := strings.Fields(authHeader)
-		if len(fields) < 2 {
-			err := errors.New("Invalid Authorization header formar")
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, responseError(err))
+		payload, err := tokenMaker.VerifyToken(access_token, token.AccessToken)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, responseError(err))
 			return
 		}
 
-		if authType := strings.ToLower(fields[0]); authType != "bearer" {
-			err := fmt.Errorf("Unsupport authorization type %s", authType)
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, responseError(err))
+		if err := checkGrant(payload, scope, audiences); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, responseError(err))
 			return
 		}
 
-		access_token := fields[1]
-		payload, err := token.VerifyToken(access_token)
+		if fromCookie {
+			if err := checkCSRF(ctx, csrfKey, payload.SessionId); err != nil {
+				ctx.AbortWithStatusJSON(http.StatusForbidden, responseError(err))
+				return
+			}
+		}
+
+		if payload.KeyId != uuid.Nil {
+			authorizeKeyToken(ctx, store, payload)
+			return
+		}
+
+		session, err := store.GetSession(ctx, payload.SessionId)
 		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusBadRequest, responseError(err))
+			if err == pgx.ErrNoRows {
+				err := errors.New("Session not found")
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, responseError(err))
+				return
+			}
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, responseError(err))
 			return
 		}
 
+		if session.IsBlocked || session.UserID != payload.UserId {
+			err := errors.New("Session has been revoked")
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, responseError(err))
+			return
+		}
+
+		lastSeen.touch(session.FamilyID)
+
 		ctx.Set("payload", payload)
+		ctx.Set("session", session)
 		log.Println(ctx.Request.Method)
 		log.Println("Next")
 		ctx.Next()
 	}
 }
+
+// checkGrant checks that a token was minted for one of the route's audiences
+// and grants the scope it requires.
+func checkGrant(payload *token.Payload, scope string, audiences []string) error {
+	if err := payload.CheckAudience(audiences...); err != nil {
+		return err
+	}
+
+	if scope == "" {
+		if payload.Restricted() {
+			return errors.New("This endpoint requires a login session")
+		}
+		return nil
+	}
+
+	if !payload.HasScope(scope) {
+		return fmt.Errorf("Token is missing the %s scope", scope)
+	}
+	return nil
+}
+
+// authorizeApiKey authenticates a request made with an API key. Handlers see
+// the same payload as for a session, without a session id.
+func authorizeApiKey(
+	ctx *gin.Context,
+	store *db.Queries,
+	keyUsage *apikey.UsageRecorder,
+	credential string,
+	scope string,
+) {
+	if scope == "" {
+		err := errors.New("API keys cannot access this endpoint")
+		ctx.AbortWithStatusJSON(http.StatusForbidden, responseError(err))
+		return
+	}
+
+	key, err := apikey.Authenticate(ctx, store, credential)
+	if err != nil {
+		if err == apikey.ErrInvalidKey || err == apikey.ErrExpiredKey {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, responseError(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	if !apikey.HasScope(key, scope) {
+		err := fmt.Errorf("API key is missing the %s scope", scope)
+		ctx.AbortWithStatusJSON(http.StatusForbidden, responseError(err))
+		return
+	}
+
+	keyUsage.Touch(key.ID)
+
+	ctx.Set("payload", &token.Payload{
+		TokenId:  key.ID,
+		UserId:   key.UserID,
+		Audience: token.AudienceCLI,
+		Scopes:   key.Scopes,
+		IssuedAt: key.CreatedAt,
+	})
+	ctx.Set("api_key", key)
+	ctx.Next()
+}
+
+// authorizeKeyToken checks a token that was minted with an API key rather
+// than in a session. It lasts only as long as the key and its shares scope.
+func authorizeKeyToken(ctx *gin.Context, store *db.Queries, payload *token.Payload) {
+	key, err := apikey.Get(ctx, store, payload.KeyId)
+	if err != nil {
+		if err == apikey.ErrInvalidKey || err == apikey.ErrExpiredKey {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, responseError(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	if key.UserID != payload.UserId || !apikey.HasScope(key, apikey.ScopeSharesManage) {
+		err := errors.New("API key has been revoked")
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, responseError(err))
+		return
+	}
+
+	ctx.Set("payload", payload)
+	ctx.Next()
+}
+
+// clientIPHeader carries the resolved client address to gin. Whatever the
+// client sent under the same name is overwritten.
+const clientIPHeader = "X-Dropbyte-Client-Ip"
+
+// resolveClientIP believes X-Forwarded-For only as far as the hops were added
+// by trusted proxies.
+func resolveClientIP(proxies []netip.Prefix) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		forwarded := util.SplitForwarded(ctx.Request.Header.Values("X-Forwarded-For"))
+		ip := util.ClientIP(ctx.Request.RemoteAddr, forwarded, proxies)
+		ctx.Request.Header.Set(clientIPHeader, ip)
+		ctx.Next()
+	}
+}
+
+// limitUploadSize caps the request body so oversized uploads are rejected
+// while reading instead of being buffered in full.
+func limitUploadSize(maxUploadSize int64) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		// Leave room for the multipart boundaries and form fields.
+		limit := maxUploadSize + 1024*1024
+		ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, limit)
+		ctx.Next()
+	}
+}
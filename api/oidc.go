@@ -0,0 +1,345 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/sso"
+	"github.com/liquiddev99/dropbyte-backend/token"
+	"github.com/liquiddev99/dropbyte-backend/util"
+)
+
+// Signing in through an OpenID provider goes through the browser: /login
+// redirects to the provider, which redirects back to /callback. The state is
+// kept in the database and in a cookie, so the callback only completes a login
+// started by the same browser. Accounts are matched by provider subject, then
+// by verified email, and created when neither matches.
+
+const oidcStateCookieName = "oidc_state"
+
+var errOidcUnverifiedEmail = errors.New("Provider did not verify the email address")
+
+type oidcProviderRequest struct {
+	Provider string `uri:"provider" binding:"required"`
+}
+
+type oidcCallbackRequest struct {
+	Code  string `form:"code"  binding:"required"`
+	State string `form:"state" binding:"required"`
+}
+
+func newOidcProviders(config util.Config) map[string]*sso.Provider {
+	providers := make(map[string]*sso.Provider, len(config.OIDCProviders))
+	for _, provider := range config.OIDCProviders {
+		redirectUrl := config.PublicUrl + "/oidc/" + url.PathEscape(provider.Name) + "/callback"
+		providers[provider.Name] = sso.NewProvider(provider, redirectUrl)
+	}
+	return providers
+}
+
+// oidcProvider looks up the provider named in the path. On failure the error
+// response is already written.
+func (server *Server) oidcProvider(ctx *gin.Context) (*sso.Provider, bool) {
+	var req oidcProviderRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return nil, false
+	}
+
+	provider, ok := server.oidcProviders[req.Provider]
+	if !ok {
+		ctx.JSON(http.StatusNotFound, responseError(errors.New("Unknown provider")))
+		return nil, false
+	}
+	return provider, true
+}
+
+func (server *Server) getOidcProviders(ctx *gin.Context) {
+	names := make([]string, len(server.config.OIDCProviders))
+	for i, provider := range server.config.OIDCProviders {
+		names[i] = provider.Name
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"providers": names})
+}
+
+func (server *Server) oidcLogin(ctx *gin.Context) {
+	provider, ok := server.oidcProvider(ctx)
+	if !ok {
+		return
+	}
+
+	values := make([]string, 3)
+	for i := range values {
+		value, err := sso.RandomString()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, responseError(err))
+			return
+		}
+		values[i] = value
+	}
+	state, nonce, codeVerifier := values[0], values[1], values[2]
+
+	authUrl, err := provider.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, responseError(err))
+		return
+	}
+
+	_, err = server.db.CreateOidcLogin(ctx, db.CreateOidcLoginParams{
+		State:        state,
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(server.config.OIDCLoginDuration),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(
+		oidcStateCookieName,
+		state,
+		int(server.config.OIDCLoginDuration.Seconds()),
+		"/oidc",
+		server.config.Domain,
+		true,
+		true,
+	)
+	ctx.Redirect(http.StatusFound, authUrl)
+}
+
+// oidcCallback finishes the login and sends the browser back to the frontend
+// with the session cookies set. When the account has two-factor
+// authentication enabled the frontend gets an MFA token in the fragment
+// instead, to be exchanged at /login/mfa.
+func (server *Server) oidcCallback(ctx *gin.Context) {
+	provider, ok := server.oidcProvider(ctx)
+	if !ok {
+		return
+	}
+
+	if providerError := ctx.Query("error"); providerError != "" {
+		err := errors.New(providerError + ": " + ctx.Query("error_description"))
+		ctx.JSON(http.StatusUnauthorized, responseError(err))
+		return
+	}
+
+	var req oidcCallbackRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	state, _ := ctx.Cookie(oidcStateCookieName)
+	ctx.SetCookie(oidcStateCookieName, "", -1, "/oidc", server.config.Domain, true, true)
+	if state == "" || state != req.State {
+		err := errors.New("Login was not started by this browser")
+		ctx.JSON(http.StatusForbidden, responseError(err))
+		return
+	}
+
+	login, err := server.db.ClaimOidcLogin(ctx, req.State)
+	if err == nil && login.Provider != provider.Name {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, responseError(errors.New("Login not found")))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	if time.Now().After(login.ExpiresAt) {
+		ctx.JSON(http.StatusGone, responseError(errors.New("Login has expired")))
+		return
+	}
+
+	identity, err := provider.Exchange(ctx, req.Code, login.Nonce, login.CodeVerifier)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, responseError(err))
+		return
+	}
+
+	user, err := server.oidcUser(ctx, provider.Name, identity)
+	if err != nil {
+		if err == errOidcUnverifiedEmail {
+			ctx.JSON(http.StatusForbidden, responseError(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+	if !checkSuspended(ctx, user) {
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		mfaToken, _, err := server.token.CreateToken(
+			user.ID,
+			uuid.Nil,
+			token.MFAToken,
+			server.config.MFAChallengeDuration,
+		)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, responseError(err))
+			return
+		}
+
+		fragment := url.Values{"mfa_token": {mfaToken}}.Encode()
+		ctx.Redirect(http.StatusFound, server.config.OIDCLoginRedirectUrl+"#"+fragment)
+		return
+	}
+
+	tokens, err := server.createSession(ctx, user.ID, uuid.Nil)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	server.setSessionCookies(ctx, tokens)
+	ctx.Redirect(http.StatusFound, server.config.OIDCLoginRedirectUrl)
+}
+
+// oidcUser returns the account linked to identity, linking or creating one
+// by email when the provider has verified the address.
+func (server *Server) oidcUser(ctx context.Context, provider string, identity sso.Identity) (db.User, error) {
+	linked, err := server.db.GetUserIdentity(ctx, db.GetUserIdentityParams{
+		Provider: provider,
+		Subject:  identity.Subject,
+	})
+	if err == nil {
+		return server.db.GetUser(ctx, linked.UserID)
+	}
+	if err != pgx.ErrNoRows {
+		return db.User{}, err
+	}
+
+	if !identity.EmailVerified || identity.Email == "" {
+		return db.User{}, errOidcUnverifiedEmail
+	}
+
+	user, err := server.db.GetUserByEmail(ctx, identity.Email)
+	switch {
+	case err == pgx.ErrNoRows:
+		user, err = server.provisionOidcUser(ctx, identity)
+	case err == nil && !user.EmailVerifiedAt.Valid:
+		err = server.claimUnverifiedUser(ctx, user)
+	}
+	if err != nil {
+		return db.User{}, err
+	}
+
+	_, err = server.db.CreateUserIdentity(ctx, db.CreateUserIdentityParams{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return db.User{}, err
+	}
+
+	return server.db.GetUser(ctx, user.ID)
+}
+
+// unusablePassword returns a hash no password matches. Users can still set a
+// password through a reset.
+func unusablePassword() (string, error) {
+	password, err := sso.RandomString()
+	if err != nil {
+		return "", err
+	}
+	return util.HashPassword(password)
+}
+
+func (server *Server) provisionOidcUser(ctx context.Context, identity sso.Identity) (db.User, error) {
+	hashedPassword, err := unusablePassword()
+	if err != nil {
+		return db.User{}, err
+	}
+
+	fullName := identity.Name
+	if fullName == "" {
+		fullName = identity.Email
+	}
+
+	user, err := server.db.CreateUser(ctx, db.CreateUserParams{
+		FullName:       fullName,
+		Email:          identity.Email,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		return db.User{}, err
+	}
+
+	_, err = server.db.VerifyUserEmail(ctx, db.VerifyUserEmailParams{ID: user.ID, Email: user.Email})
+	return user, err
+}
+
+// claimUnverifiedUser hands an account whose email was never verified to the
+// user the provider vouches for. Whoever registered it may not own the
+// address, so everything they could sign in with stops working at once: the
+// password, sessions, API keys, passkeys, second factor, linked identities
+// and pending reset links.
+func (server *Server) claimUnverifiedUser(ctx context.Context, user db.User) error {
+	hashedPassword, err := unusablePassword()
+	if err != nil {
+		return err
+	}
+
+	return server.execTx(ctx, func(q *db.Queries) error {
+		err := q.UpdateUserPassword(ctx, db.UpdateUserPasswordParams{
+			ID:             user.ID,
+			HashedPassword: hashedPassword,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := q.BlockUserSessions(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := q.DeleteUserApiKeys(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := q.DeleteUserWebauthnCredentials(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := q.DisableUserTotp(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := q.DeleteRecoveryCodes(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := q.DeleteUserIdentities(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := q.InvalidatePasswordResets(ctx, user.ID); err != nil {
+			return err
+		}
+
+		_, err = q.VerifyUserEmail(ctx, db.VerifyUserEmailParams{ID: user.ID, Email: user.Email})
+		return err
+	})
+}
+
+// removeExpiredOidcLogins drops logins that never came back from the provider.
+func (server *Server) removeExpiredOidcLogins() {
+	if err := server.db.DeleteExpiredOidcLogins(context.Background()); err != nil {
+		log.Println("Failed to delete expired oidc logins", err)
+	}
+}
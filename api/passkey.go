@@ -0,0 +1,394 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/passkey"
+	"github.com/liquiddev99/dropbyte-backend/token"
+)
+
+// Both ceremonies start by storing the WebAuthn session data under a random
+// challenge id. Finishing a ceremony deletes it, so an answer from the
+// authenticator is accepted at most once.
+
+const (
+	passkeyRegistration = "registration"
+	passkeyLogin        = "login"
+)
+
+type passkeyChallengeResponse struct {
+	ChallengeID uuid.UUID   `json:"challenge_id"`
+	Options     interface{} `json:"options"`
+}
+
+// The body of the finish requests is the PublicKeyCredential returned by the
+// browser, so everything else is passed in the query.
+type finishPasskeyRegistrationRequest struct {
+	ChallengeID string `form:"challenge_id" binding:"required,uuid"`
+	Name        string `form:"name"         binding:"required,max=64"`
+}
+
+type finishPasskeyLoginRequest struct {
+	ChallengeID string `form:"challenge_id" binding:"required,uuid"`
+}
+
+type deletePasskeyRequest struct {
+	ID string `json:"id" binding:"required,uuid"`
+}
+
+type passkeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func newPasskeyResponse(credential db.WebauthnCredential) passkeyResponse {
+	rsp := passkeyResponse{
+		ID:        credential.ID,
+		Name:      credential.Name,
+		CreatedAt: credential.CreatedAt,
+	}
+	if credential.LastUsedAt.Valid {
+		rsp.LastUsedAt = &credential.LastUsedAt.Time
+	}
+	return rsp
+}
+
+func newWebauthnCredential(credential db.WebauthnCredential) webauthn.Credential {
+	transports := make([]protocol.AuthenticatorTransport, len(credential.Transports))
+	for i, transport := range credential.Transports {
+		transports[i] = protocol.AuthenticatorTransport(transport)
+	}
+
+	return webauthn.Credential{
+		ID:              credential.CredentialID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			BackupEligible: credential.BackupEligible,
+			BackupState:    credential.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    credential.Aaguid,
+			SignCount: uint32(credential.SignCount),
+		},
+	}
+}
+
+func newPasskeyUser(user db.User, credentials []db.WebauthnCredential) passkey.User {
+	passkeyUser := passkey.User{
+		ID:          user.ID,
+		Name:        user.Email,
+		DisplayName: user.FullName,
+	}
+	for _, credential := range credentials {
+		passkeyUser.Credentials = append(passkeyUser.Credentials, newWebauthnCredential(credential))
+	}
+	return passkeyUser
+}
+
+func (server *Server) saveChallenge(
+	ctx context.Context,
+	userID uuid.UUID,
+	ceremony string,
+	session *webauthn.SessionData,
+) (uuid.UUID, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	challenge, err := server.db.CreateWebauthnChallenge(ctx, db.CreateWebauthnChallengeParams{
+		UserID:      userID,
+		Ceremony:    ceremony,
+		SessionData: data,
+		ExpiresAt:   time.Now().Add(server.config.WebauthnChallengeDuration),
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return challenge.ID, nil
+}
+
+// claimChallenge consumes the challenge started for ceremony. On failure the
+// error response is already written.
+func (server *Server) claimChallenge(
+	ctx *gin.Context,
+	id string,
+	ceremony string,
+) (db.WebauthnChallenge, webauthn.SessionData, bool) {
+	var session webauthn.SessionData
+
+	challenge, err := server.db.ClaimWebauthnChallenge(ctx, uuid.MustParse(id))
+	if err == nil && challenge.Ceremony != ceremony {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, responseError(errors.New("Challenge not found")))
+			return challenge, session, false
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return challenge, session, false
+	}
+
+	if time.Now().After(challenge.ExpiresAt) {
+		ctx.JSON(http.StatusGone, responseError(errors.New("Challenge has expired")))
+		return challenge, session, false
+	}
+
+	if err := json.Unmarshal(challenge.SessionData, &session); err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return challenge, session, false
+	}
+
+	return challenge, session, true
+}
+
+func (server *Server) beginPasskeyRegistration(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
+	user, err := server.db.GetUser(ctx, authPayload.UserId)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	credentials, err := server.db.ListWebauthnCredentials(ctx, user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	options, session, err := server.passkeys.BeginRegistration(newPasskeyUser(user, credentials))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	challengeID, err := server.saveChallenge(ctx, user.ID, passkeyRegistration, session)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, passkeyChallengeResponse{ChallengeID: challengeID, Options: options})
+}
+
+func (server *Server) finishPasskeyRegistration(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
+	var req finishPasskeyRegistrationRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	challenge, session, ok := server.claimChallenge(ctx, req.ChallengeID, passkeyRegistration)
+	if !ok {
+		return
+	}
+	if challenge.UserID != authPayload.UserId {
+		ctx.JSON(http.StatusNotFound, responseError(errors.New("Challenge not found")))
+		return
+	}
+
+	user, err := server.db.GetUser(ctx, authPayload.UserId)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	credentials, err := server.db.ListWebauthnCredentials(ctx, user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	credential, err := server.passkeys.FinishRegistration(
+		newPasskeyUser(user, credentials),
+		session,
+		ctx.Request.Body,
+	)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	transports := make([]string, len(credential.Transport))
+	for i, transport := range credential.Transport {
+		transports[i] = string(transport)
+	}
+
+	created, err := server.db.CreateWebauthnCredential(ctx, db.CreateWebauthnCredentialParams{
+		UserID:          user.ID,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		Aaguid:          credential.Authenticator.AAGUID,
+		SignCount:       int64(credential.Authenticator.SignCount),
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		Name:            req.Name,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			ctx.JSON(http.StatusConflict, responseError(errors.New("Passkey is already registered")))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newPasskeyResponse(created))
+}
+
+func (server *Server) getPasskeys(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
+	credentials, err := server.db.ListWebauthnCredentials(ctx, authPayload.UserId)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	rsp := make([]passkeyResponse, len(credentials))
+	for i, credential := range credentials {
+		rsp[i] = newPasskeyResponse(credential)
+	}
+
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+func (server *Server) deletePasskey(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
+	var req deletePasskeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	rows, err := server.db.DeleteWebauthnCredential(ctx, db.DeleteWebauthnCredentialParams{
+		ID:     uuid.MustParse(req.ID),
+		UserID: authPayload.UserId,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+	if rows == 0 {
+		ctx.JSON(http.StatusNotFound, responseError(errors.New("Passkey not found")))
+		return
+	}
+
+	ctx.String(http.StatusOK, "OK")
+}
+
+func (server *Server) beginPasskeyLogin(ctx *gin.Context) {
+	options, session, err := server.passkeys.BeginLogin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	challengeID, err := server.saveChallenge(ctx, uuid.Nil, passkeyLogin, session)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, passkeyChallengeResponse{ChallengeID: challengeID, Options: options})
+}
+
+// finishPasskeyLogin signs in the owner of the passkey. The stored signature
+// counter only moves forward, so a replayed assertion is rejected even if it
+// races the original one.
+func (server *Server) finishPasskeyLogin(ctx *gin.Context) {
+	var req finishPasskeyLoginRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	_, session, ok := server.claimChallenge(ctx, req.ChallengeID, passkeyLogin)
+	if !ok {
+		return
+	}
+
+	var user db.User
+	var stored db.WebauthnCredential
+	lookup := func(credentialID []byte, userID uuid.UUID) (passkey.User, error) {
+		var err error
+		stored, err = server.db.GetWebauthnCredentialByCredentialID(ctx, credentialID)
+		if err != nil {
+			return passkey.User{}, err
+		}
+		if stored.UserID != userID {
+			return passkey.User{}, errors.New("Passkey belongs to another user")
+		}
+
+		user, err = server.db.GetUser(ctx, userID)
+		if err != nil {
+			return passkey.User{}, err
+		}
+		return newPasskeyUser(user, []db.WebauthnCredential{stored}), nil
+	}
+
+	_, credential, err := server.passkeys.FinishLogin(session, ctx.Request.Body, lookup)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, responseError(err))
+		return
+	}
+
+	rows, err := server.db.UseWebauthnCredential(ctx, db.UseWebauthnCredentialParams{
+		ID:          stored.ID,
+		SignCount:   int64(credential.Authenticator.SignCount),
+		BackupState: credential.Flags.BackupState,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+	if rows == 0 {
+		ctx.JSON(http.StatusUnauthorized, responseError(passkey.ErrClonedAuthenticator))
+		return
+	}
+	if !checkSuspended(ctx, user) {
+		return
+	}
+
+	tokens, err := server.createSession(ctx, user.ID, uuid.Nil)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	server.setSessionCookies(ctx, tokens)
+
+	ctx.JSON(http.StatusOK, newUserResponse(user, tokens))
+}
+
+// removeExpiredChallenges drops ceremonies that were never finished.
+func (server *Server) removeExpiredChallenges() {
+	if err := server.db.DeleteExpiredWebauthnChallenges(context.Background()); err != nil {
+		log.Println("Failed to delete expired webauthn challenges", err)
+	}
+}
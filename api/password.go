@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/mailer"
+	"github.com/liquiddev99/dropbyte-backend/util"
+	"github.com/liquiddev99/dropbyte-backend/validation"
+)
+
+// Reset tokens are random and only their SHA-256 is stored, so a leaked
+// database cannot be used to take over accounts. A token works once and
+// resetting the password logs the user out everywhere.
+
+type requestPasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+var errInvalidResetToken = errors.New("Invalid or expired reset token")
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"    binding:"required"`
+	Password string `json:"password" binding:"required,password"`
+}
+
+func hashResetToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// requestPasswordReset always answers the same way, and does the work in the
+// background, so it cannot be used to find out which emails have accounts.
+func (server *Server) requestPasswordReset(ctx *gin.Context) {
+	var req requestPasswordResetRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	go func() {
+		if err := server.sendPasswordReset(context.Background(), req.Email); err != nil {
+			log.Println("Failed to send password reset", err)
+		}
+	}()
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "If an account exists for this email, a reset link has been sent",
+	})
+}
+
+func (server *Server) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := server.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	_, err = server.db.CreatePasswordReset(ctx, db.CreatePasswordResetParams{
+		UserID:    user.ID,
+		TokenHash: hashResetToken(token),
+		ExpiresAt: time.Now().Add(server.config.PasswordResetDuration),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := server.config.PasswordResetUrl + "?" + url.Values{"token": {token}}.Encode()
+	return server.mailer.Send(mailer.PasswordResetMessage(
+		user.Email,
+		user.FullName,
+		link,
+		server.config.PasswordResetDuration,
+	))
+}
+
+func (server *Server) resetPassword(ctx *gin.Context) {
+	var req resetPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, bindingError(err))
+		return
+	}
+
+	// Look the token up before using it, so a rejected password doesn't burn
+	// it.
+	reset, err := server.db.GetPasswordReset(ctx, hashResetToken(req.Token))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, responseError(errInvalidResetToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	user, err := server.db.GetUser(ctx, reset.UserID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	err = validation.ValidateNewPassword(req.Password, user.Email, user.FullName)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"fields": gin.H{"password": err.Error()},
+		})
+		return
+	}
+
+	hashedPassword, err := util.HashPassword(req.Password)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	// Burning the token, swapping the password and ending the old sessions
+	// land together, so a failure can't leave a used token behind with the
+	// old password still in place.
+	err = server.execTx(ctx, func(q *db.Queries) error {
+		var err error
+		reset, err = q.UsePasswordReset(ctx, hashResetToken(req.Token))
+		if err != nil {
+			return err
+		}
+
+		err = q.UpdateUserPassword(ctx, db.UpdateUserPasswordParams{
+			ID:             reset.UserID,
+			HashedPassword: hashedPassword,
+		})
+		if err != nil {
+			return err
+		}
+
+		return q.BlockUserSessions(ctx, reset.UserID)
+	})
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, responseError(errInvalidResetToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	if err := server.db.InvalidatePasswordResets(ctx, reset.UserID); err != nil {
+		log.Println("Failed to invalidate password resets", reset.UserID, err)
+	}
+
+	server.clearSessionCookies(ctx)
+	ctx.String(http.StatusOK, "OK")
+}
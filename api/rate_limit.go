@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/token"
+)
+
+var errRateLimited = errors.New("Too many requests, try again later")
+
+// rateLimit takes a token from the named policy's bucket for the caller. API
+// keys and users are limited on their own, anyone else by client IP, so it
+// should come after the auth middleware on routes that have one.
+func (server *Server) rateLimit(policy string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		allowed, retryAfter, err := server.limiter.Allow(ctx, policy, rateLimitKey(ctx))
+		if err != nil {
+			// An unreachable store shouldn't take the whole API down with it.
+			log.Println("Failed to check rate limit", err)
+			ctx.Next()
+			return
+		}
+
+		if !allowed {
+			seconds := int(retryAfter.Seconds()) + 1
+			ctx.Header("Retry-After", strconv.Itoa(seconds))
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, responseError(errRateLimited))
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+func rateLimitKey(ctx *gin.Context) string {
+	if key, ok := ctx.Get("api_key"); ok {
+		return "key:" + key.(db.ApiKey).ID.String()
+	}
+	if payload, ok := ctx.Get("payload"); ok {
+		return "user:" + payload.(*token.Payload).UserId.String()
+	}
+	return "ip:" + ctx.ClientIP()
+}
+
+// removeIdleRateLimits drops buckets that have filled up again.
+func (server *Server) removeIdleRateLimits() {
+	if err := server.limiter.Prune(context.Background()); err != nil {
+		log.Println("Failed to prune rate limits", err)
+	}
+}
@@ -1,14 +1,28 @@
 package api
 
 import (
+	"context"
 	"log"
+	"net/netip"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 
+	"github.com/liquiddev99/dropbyte-backend/apikey"
+	"github.com/liquiddev99/dropbyte-backend/authenticator"
 	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/encryption"
+	"github.com/liquiddev99/dropbyte-backend/lockout"
+	"github.com/liquiddev99/dropbyte-backend/mailer"
+	"github.com/liquiddev99/dropbyte-backend/passkey"
+	"github.com/liquiddev99/dropbyte-backend/ratelimit"
 	"github.com/liquiddev99/dropbyte-backend/request"
+	"github.com/liquiddev99/dropbyte-backend/sso"
 	"github.com/liquiddev99/dropbyte-backend/token"
 	"github.com/liquiddev99/dropbyte-backend/util"
 )
@@ -16,24 +30,111 @@ import (
 type Server struct {
 	config         util.Config
 	db             *db.Queries
+	pool           *pgxpool.Pool
 	router         *gin.Engine
 	token          token.Token
+	keyring        *encryption.Keyring
+	lastSeen       *lastSeenRecorder
+	keyUsage       *apikey.UsageRecorder
+	lockout        *lockout.Guard
+	limiter        *ratelimit.Limiter
+	authenticator  authenticator.Authenticator
+	mailer         mailer.Mailer
+	passkeys       *passkey.Passkeys
+	oidcProviders  map[string]*sso.Provider
+	proxies        []netip.Prefix
 	b2UploadUrl    string
 	b2UrlAuthToken string
 }
 
-func NewServer(config util.Config, db *db.Queries) (*Server, error) {
-	token, err := token.NewMaker(config.SymmetricKey)
+func NewServer(config util.Config, db *db.Queries, pool *pgxpool.Pool) (*Server, error) {
+	token, err := token.New(config.SymmetricKey, config.TokenSigningKey, config.TokenRetiredKeys)
 	if err != nil {
-		log.Fatal("Cannot create token maker")
+		log.Fatal("Cannot create token maker", err)
+	}
+	keyring, err := encryption.NewKeyring(config.MasterKey, db)
+	if err != nil {
+		log.Fatal("Cannot create keyring")
+	}
+	mailer, err := mailer.New(config.Mailer, mailer.Config{
+		From:        config.MailFrom,
+		SMTPAddress: config.SMTPAddress,
+		Username:    config.SMTPUsername,
+		Password:    config.SMTPPassword,
+		Directory:   config.MailDirectory,
+	})
+	if err != nil {
+		log.Fatal("Cannot create mailer", err)
+	}
+	passkeys, err := passkey.New(passkey.Config{
+		RPID:          config.WebauthnRPID,
+		RPDisplayName: config.WebauthnRPName,
+		RPOrigins:     []string{config.OriginAllowed},
+	})
+	if err != nil {
+		log.Fatal("Cannot create passkeys", err)
+	}
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(jsonFieldName)
+		v.RegisterValidation("password", validPassword)
+	}
+
+	loginGuard := lockout.New(db, lockout.Config{
+		MaxAttempts:   config.LoginMaxAttempts,
+		MaxIPAttempts: config.LoginMaxIPAttempts,
+		Delay:         config.LoginLockoutDuration,
+		MaxDelay:      config.LoginMaxLockoutDuration,
+		Window:        config.LoginAttemptWindow,
+	})
+	policies, err := ratelimit.ParsePolicies(config.RateLimits)
+	if err != nil {
+		log.Fatal("Cannot parse rate limits", err)
+	}
+	limitStore, err := ratelimit.NewStore(config.RateLimitStore, db)
+	if err != nil {
+		log.Fatal("Cannot create rate limit store", err)
+	}
+
+	authenticator, err := authenticator.New(config, db)
+	if err != nil {
+		log.Fatal("Cannot create authenticator", err)
+	}
+
+	proxies, err := util.ParseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		log.Fatal("Cannot parse trusted proxies", err)
+	}
+
+	server := &Server{
+		config:        config,
+		db:            db,
+		pool:          pool,
+		token:         token,
+		keyring:       keyring,
+		lastSeen:      newLastSeenRecorder(db),
+		keyUsage:      apikey.NewUsageRecorder(db),
+		lockout:       loginGuard,
+		limiter:       ratelimit.New(limitStore, policies),
+		authenticator: authenticator,
+		mailer:        mailer,
+		passkeys:      passkeys,
+		oidcProviders: newOidcProviders(config),
+		proxies:       proxies,
 	}
-	server := &Server{config: config, db: db, token: token}
 
 	server.setupRouter()
 
 	return server, nil
 }
 
+// execTx runs fn on queries bound to a single transaction, which commits when
+// fn returns nil.
+func (server *Server) execTx(ctx context.Context, fn func(*db.Queries) error) error {
+	return pgx.BeginFunc(ctx, server.pool, func(tx pgx.Tx) error {
+		return fn(db.New(tx))
+	})
+}
+
 func (server *Server) scheduledTask() {
 	authResponse, err := request.AuthorizeAccount(
 		server.config.B2ApplicationKeyId,
@@ -54,6 +155,14 @@ func (server *Server) scheduledTask() {
 	}
 	server.b2UploadUrl = urlResponse.UploadUrl
 	server.b2UrlAuthToken = urlResponse.AuthorizationToken
+
+	server.removeExpiredUploads()
+	server.removeExpiredDirectUploads()
+	server.removeExpiredChallenges()
+	server.removeExpiredOidcLogins()
+	server.removeExpiredMagicLinks()
+	server.removeStaleLoginThrottles()
+	server.removeIdleRateLimits()
 }
 
 func (server *Server) startScheduledTask() {
@@ -71,11 +180,18 @@ func (server *Server) startScheduledTask() {
 }
 
 func (server *Server) setupRouter() {
+	// The client address is resolved the same way as for gRPC calls and handed
+	// to gin as a trusted platform header, so ctx.ClientIP() reports it.
 	router := gin.Default()
+	if err := router.SetTrustedProxies(nil); err != nil {
+		log.Fatal("Cannot set trusted proxies", err)
+	}
+	router.TrustedPlatform = clientIPHeader
+	router.Use(resolveClientIP(server.proxies))
 
 	corsConf := cors.DefaultConfig()
 	corsConf.AllowOrigins = []string{server.config.OriginAllowed}
-	corsConf.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "HEAD"}
+	corsConf.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "HEAD"}
 	corsConf.AllowCredentials = true
 	corsConf.AllowHeaders = []string{
 		"Content-Type",
@@ -84,27 +200,146 @@ func (server *Server) setupRouter() {
 		"X-Requested-With",
 		"Origin",
 		"Access-Control-Request-Headers",
+		"Range",
+		"Tus-Resumable",
+		"Upload-Length",
+		"Upload-Offset",
+		"Upload-Metadata",
+		"Upload-Defer-Length",
+		"X-CSRF-Token",
+	}
+	corsConf.ExposeHeaders = []string{
+		"Content-Range",
+		"Content-Disposition",
+		"Location",
+		"Tus-Resumable",
+		"Tus-Version",
+		"Tus-Extension",
+		"Tus-Max-Size",
+		"Upload-Offset",
+		"Upload-Length",
+		"Upload-Metadata",
+		"Upload-Expires",
+		"Upload-File-Id",
 	}
 
 	router.Use(cors.New(corsConf))
 	router.MaxMultipartMemory = 250 * 1024 * 1024
 
-	authRoutes := router.Group("/").Use(authMiddleware(server.token))
+	// Routes behind requireAuth need a login session, API keys and scoped
+	// tokens can only use the routes that require one of their scopes. Share
+	// tokens are only accepted where a route lists their audience.
+	requireScope := func(scope string, audiences ...string) gin.HandlerFunc {
+		return authMiddleware(
+			server.token,
+			server.db,
+			[]byte(server.config.SymmetricKey),
+			server.lastSeen,
+			server.keyUsage,
+			scope,
+			append([]string{token.AudienceWeb, token.AudienceCLI}, audiences...),
+		)
+	}
+	requireAuth := requireScope("")
+	filesRead := requireScope(apikey.ScopeFilesRead)
+	filesWrite := requireScope(apikey.ScopeFilesWrite)
+	sharesManage := requireScope(apikey.ScopeSharesManage)
+	fileDownload := requireScope(apikey.ScopeFilesRead, token.AudienceShare)
+
+	// Guests are limited by IP, everyone else by user or API key, so the api
+	// limit goes after the auth middleware.
+	loginLimit := server.rateLimit("login")
+	uploadRateLimit := server.rateLimit("upload")
+	resetLimit := server.rateLimit("password_reset")
+	apiLimit := server.rateLimit("api")
+	authRoutes := router.Group("/").Use(requireAuth, apiLimit)
+
+	uploadLimit := limitUploadSize(server.config.MaxUploadSize)
 
-	router.POST("/upload", server.guestUploadFile)
-	router.POST("/signup", server.createUser)
-	router.POST("/login", server.loginUser)
+	router.POST("/upload", uploadRateLimit, uploadLimit, server.guestUploadFile)
+	router.POST("/upload/e2e", uploadRateLimit, uploadLimit, server.guestUploadE2EFile)
+	router.POST("/upload/direct", uploadRateLimit, server.createDirectUpload)
+	router.POST("/upload/direct/complete", uploadRateLimit, server.completeDirectUpload)
+	router.POST("/signup", server.rateLimit("signup"), server.createUser)
+	router.POST("/login", loginLimit, server.loginUser)
+	router.POST("/login/mfa", loginLimit, server.loginMFA)
+	router.POST("/login/passkey/begin", server.beginPasskeyLogin)
+	router.POST("/login/passkey/finish", loginLimit, server.finishPasskeyLogin)
+	router.POST("/login/magic_link", server.rateLimit("magic_link"), server.requestMagicLink)
+	router.POST("/login/magic_link/verify", loginLimit, server.magicLinkLogin)
+	router.GET("/oidc/providers", server.getOidcProviders)
+	router.GET("/oidc/:provider/login", server.oidcLogin)
+	router.GET("/oidc/:provider/callback", server.oidcCallback)
+	router.POST("/tokens/renew_access", server.renewAccessToken)
+	router.GET("/.well-known/paseto-keys", server.getTokenKeys)
+	router.GET("/verify_email", server.verifyEmail)
+	router.POST("/password/reset_request", resetLimit, server.requestPasswordReset)
+	router.POST("/password/reset", resetLimit, server.resetPassword)
+	router.GET("/e2e/file", server.getE2EFile)
+	router.GET("/e2e/file/download", server.downloadE2EFile)
 
-	authRoutes.POST("/user/upload", server.userUploadFile)
-	authRoutes.GET("/user/files", server.getFiles)
-	authRoutes.POST("/user/file/delete", server.deleteFileById)
-	authRoutes.GET("/user/file/download", server.downloadFileById)
+	guestTusRoutes := router.Group("/uploads", tusResumable())
+	guestTusRoutes.OPTIONS("", server.tusOptions)
+	guestTusRoutes.POST("", uploadRateLimit, server.createTusUpload)
+	guestTusRoutes.HEAD("/:id", server.headTusUpload)
+	guestTusRoutes.PATCH("/:id", server.patchTusUpload)
+	guestTusRoutes.DELETE("/:id", server.deleteTusUpload)
+
+	// Discovery stays public, the uploads themselves belong to the user.
+	router.OPTIONS("/user/uploads", tusResumable(), server.tusOptions)
+	userTusRoutes := router.Group("/user/uploads", tusResumable(), filesWrite, apiLimit)
+	userTusRoutes.POST("", server.createTusUpload)
+	userTusRoutes.HEAD("/:id", server.headTusUpload)
+	userTusRoutes.PATCH("/:id", server.patchTusUpload)
+	userTusRoutes.DELETE("/:id", server.deleteTusUpload)
+
+	router.POST("/user/upload", filesWrite, apiLimit, uploadLimit, server.userUploadFile)
+	router.POST("/user/upload/e2e", filesWrite, apiLimit, uploadLimit, server.userUploadE2EFile)
+	router.POST("/user/upload/direct", filesWrite, apiLimit, server.createDirectUpload)
+	router.POST("/user/upload/direct/complete", filesWrite, apiLimit, server.completeDirectUpload)
+	router.GET("/user/files", filesRead, apiLimit, server.getFiles)
+	router.POST("/user/file/delete", filesWrite, apiLimit, server.deleteFileById)
+	router.GET("/user/file/download", fileDownload, apiLimit, server.downloadFileById)
+	router.POST("/user/file/download_token", sharesManage, apiLimit, server.createDownloadToken)
 	authRoutes.POST("/user/logout", server.logout)
+	authRoutes.POST("/user/logout_all", server.logoutAll)
+	authRoutes.POST("/user/update", server.updateUser)
+	authRoutes.POST("/user/password", server.changePassword)
+	authRoutes.POST("/user/email", server.changeEmail)
+	authRoutes.POST("/user/delete", server.deleteUser)
+	authRoutes.POST("/user/verify_email/resend", server.resendVerificationEmail)
+	authRoutes.POST("/user/totp/enroll", server.enrollTotp)
+	authRoutes.POST("/user/totp/confirm", server.confirmTotp)
+	authRoutes.POST("/user/totp/disable", server.disableTotp)
+	authRoutes.POST("/user/totp/recovery_codes", server.regenerateRecoveryCodes)
+	authRoutes.POST("/user/passkey/register/begin", server.beginPasskeyRegistration)
+	authRoutes.POST("/user/passkey/register/finish", server.finishPasskeyRegistration)
+	authRoutes.GET("/user/passkeys", server.getPasskeys)
+	authRoutes.POST("/user/passkey/delete", server.deletePasskey)
+	authRoutes.POST("/user/api_keys", server.createApiKey)
+	authRoutes.GET("/user/api_keys", server.getApiKeys)
+	authRoutes.POST("/user/api_key/delete", server.deleteApiKey)
+	authRoutes.GET("/user/sessions", server.getSessions)
+	authRoutes.GET("/user/login_history", server.getLoginHistory)
+	authRoutes.POST("/user/session/revoke", server.revokeSession)
+
+	adminRoutes := router.Group("/admin").Use(requireAuth, apiLimit, server.requireAdmin)
+	adminRoutes.GET("/users", server.listUsers)
+	adminRoutes.GET("/user", server.getAdminUser)
+	adminRoutes.GET("/user/files", server.getAdminUserFiles)
+	adminRoutes.POST("/user/suspend", server.suspendUser)
+	adminRoutes.POST("/user/unsuspend", server.unsuspendUser)
+	adminRoutes.POST("/user/logout", server.forceLogoutUser)
+	adminRoutes.POST("/user/quota", server.updateUserQuota)
+	adminRoutes.POST("/file/delete", server.adminDeleteFile)
+	adminRoutes.GET("/audit_log", server.getAuditLog)
 	server.router = router
 }
 
 func (server *Server) Start(address string) error {
 	server.startScheduledTask()
+	server.lastSeen.start(time.Minute)
+	server.keyUsage.Start(time.Minute)
 	return server.router.Run(address)
 }
 
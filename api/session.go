@@ -0,0 +1,97 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/token"
+)
+
+type revokeSessionRequest struct {
+	ID string `json:"id" binding:"required,uuid"`
+}
+
+type sessionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	ClientIP   string    `json:"client_ip"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	Current    bool      `json:"current"`
+}
+
+func newSessionResponse(session db.Session, current db.Session) sessionResponse {
+	return sessionResponse{
+		ID:         session.ID,
+		UserAgent:  session.UserAgent,
+		ClientIP:   session.ClientIp,
+		LastSeenAt: session.LastSeenAt,
+		ExpiresAt:  session.ExpiresAt,
+		CreatedAt:  session.CreatedAt,
+		Current:    session.FamilyID == current.FamilyID,
+	}
+}
+
+// getSessions lists the devices the user is logged in on. Each login is shown
+// once, as its latest refresh token.
+func (server *Server) getSessions(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+	current := ctx.MustGet("session").(db.Session)
+
+	sessions, err := server.db.ListActiveSessions(ctx, authPayload.UserId)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	rsp := make([]sessionResponse, len(sessions))
+	for i, session := range sessions {
+		rsp[i] = newSessionResponse(session, current)
+	}
+
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// revokeSession logs one device out, along with every token rotated from the
+// same login.
+func (server *Server) revokeSession(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
+	var req revokeSessionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	session, err := server.db.GetSession(ctx, uuid.MustParse(req.ID))
+	if err == nil && session.UserID != authPayload.UserId {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, responseError(errors.New("Session not found")))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	if err := server.db.BlockSessionFamily(ctx, session.FamilyID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	current := ctx.MustGet("session").(db.Session)
+	if session.FamilyID == current.FamilyID {
+		server.clearSessionCookies(ctx)
+	}
+
+	ctx.String(http.StatusOK, "OK")
+}
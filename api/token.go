@@ -0,0 +1,279 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/token"
+)
+
+// Every login starts a session family. Renewing the access token rotates the
+// refresh token: the used session is marked rotated and a new one joins the
+// family. Presenting a rotated refresh token again means it was stolen or
+// replayed, so the whole family is blocked.
+
+type sessionTokens struct {
+	SessionID             uuid.UUID
+	AccessToken           string
+	AccessTokenExpiresAt  time.Time
+	RefreshToken          string
+	RefreshTokenExpiresAt time.Time
+	CSRFToken             string
+}
+
+type renewAccessTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type renewAccessTokenResponse struct {
+	SessionID             uuid.UUID `json:"session_id"`
+	AccessToken           string    `json:"access_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+	CSRFToken             string    `json:"csrf_token"`
+}
+
+// createSession issues a new access and refresh token pair for userId. With
+// familyID set to uuid.Nil the session starts a new family.
+func (server *Server) createSession(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	familyID uuid.UUID,
+) (sessionTokens, error) {
+	sessionID := uuid.New()
+	if familyID == uuid.Nil {
+		familyID = sessionID
+	}
+
+	accessToken, accessPayload, err := server.token.CreateScopedToken(
+		userID,
+		sessionID,
+		token.AccessToken,
+		token.Claims{Audience: token.AudienceWeb},
+		server.config.AccessTokenDuration,
+	)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+
+	refreshToken, refreshPayload, err := server.token.CreateToken(
+		userID,
+		sessionID,
+		token.RefreshToken,
+		server.config.RefreshTokenDuration,
+	)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+
+	_, err = server.db.CreateSession(ctx, db.CreateSessionParams{
+		ID:           sessionID,
+		UserID:       userID,
+		FamilyID:     familyID,
+		RefreshToken: refreshToken,
+		UserAgent:    ctx.Request.UserAgent(),
+		ClientIp:     ctx.ClientIP(),
+		ExpiresAt:    refreshPayload.ExpiredAt,
+	})
+	if err != nil {
+		return sessionTokens{}, err
+	}
+
+	return sessionTokens{
+		SessionID:             sessionID,
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessPayload.ExpiredAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshPayload.ExpiredAt,
+		CSRFToken:             csrfToken([]byte(server.config.SymmetricKey), sessionID),
+	}, nil
+}
+
+// setSessionCookies stores the tokens for browser clients. The CSRF token is
+// readable from JavaScript so it can be echoed in the X-CSRF-Token header.
+func (server *Server) setSessionCookies(ctx *gin.Context, tokens sessionTokens) {
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(
+		"access_token",
+		tokens.AccessToken,
+		int(server.config.AccessTokenDuration.Seconds()),
+		"/",
+		server.config.Domain,
+		true,
+		true,
+	)
+	ctx.SetCookie(
+		"refresh_token",
+		tokens.RefreshToken,
+		int(server.config.RefreshTokenDuration.Seconds()),
+		"/tokens",
+		server.config.Domain,
+		true,
+		true,
+	)
+	ctx.SetCookie(
+		csrfCookieName,
+		tokens.CSRFToken,
+		int(server.config.RefreshTokenDuration.Seconds()),
+		"/",
+		server.config.Domain,
+		true,
+		false,
+	)
+}
+
+func (server *Server) clearSessionCookies(ctx *gin.Context) {
+	ctx.SetCookie("access_token", "", -1, "/", server.config.Domain, true, true)
+	ctx.SetCookie("refresh_token", "", -1, "/tokens", server.config.Domain, true, true)
+	ctx.SetCookie(csrfCookieName, "", -1, "/", server.config.Domain, true, false)
+}
+
+func (server *Server) renewAccessToken(ctx *gin.Context) {
+	var req renewAccessTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	fromCookie := false
+	if req.RefreshToken == "" {
+		req.RefreshToken, _ = ctx.Cookie("refresh_token")
+		fromCookie = true
+	}
+	if req.RefreshToken == "" {
+		err := errors.New("Refresh token is not provided")
+		ctx.JSON(http.StatusUnauthorized, responseError(err))
+		return
+	}
+
+	refreshPayload, err := server.token.VerifyToken(req.RefreshToken, token.RefreshToken)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, responseError(err))
+		return
+	}
+
+	if fromCookie {
+		err := checkCSRF(ctx, []byte(server.config.SymmetricKey), refreshPayload.SessionId)
+		if err != nil {
+			ctx.JSON(http.StatusForbidden, responseError(err))
+			return
+		}
+	}
+
+	session, err := server.db.GetSession(ctx, refreshPayload.SessionId)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.JSON(http.StatusUnauthorized, responseError(errors.New("Session not found")))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	if session.IsBlocked {
+		err := errors.New("Session is blocked")
+		ctx.JSON(http.StatusUnauthorized, responseError(err))
+		return
+	}
+
+	if session.UserID != refreshPayload.UserId || session.RefreshToken != req.RefreshToken {
+		err := errors.New("Mismatched session token")
+		ctx.JSON(http.StatusUnauthorized, responseError(err))
+		return
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		err := errors.New("Session has expired")
+		ctx.JSON(http.StatusUnauthorized, responseError(err))
+		return
+	}
+
+	rotated, err := server.db.RotateSession(ctx, session.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+	if rotated == 0 {
+		if err := server.db.BlockSessionFamily(ctx, session.FamilyID); err != nil {
+			log.Println("Failed to block session family", session.FamilyID, err)
+		}
+
+		err := errors.New("Refresh token was already used, the session has been revoked")
+		ctx.JSON(http.StatusUnauthorized, responseError(err))
+		return
+	}
+
+	tokens, err := server.createSession(ctx, session.UserID, session.FamilyID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	server.setSessionCookies(ctx, tokens)
+
+	ctx.JSON(http.StatusOK, renewAccessTokenResponse{
+		SessionID:             tokens.SessionID,
+		AccessToken:           tokens.AccessToken,
+		AccessTokenExpiresAt:  tokens.AccessTokenExpiresAt,
+		RefreshToken:          tokens.RefreshToken,
+		RefreshTokenExpiresAt: tokens.RefreshTokenExpiresAt,
+		CSRFToken:             tokens.CSRFToken,
+	})
+}
+
+type tokenKeyResponse struct {
+	KeyID     string `json:"kid"`
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Status    string `json:"status"`
+}
+
+type tokenKeysResponse struct {
+	Keys []tokenKeyResponse `json:"keys"`
+}
+
+// getTokenKeys publishes the keys tokens are verified with, in the shape of a
+// JWKS, so other services can check tokens without holding a secret. Tokens
+// name their key in the footer's kid.
+func (server *Server) getTokenKeys(ctx *gin.Context) {
+	keySet, ok := server.token.(token.KeySet)
+	if !ok {
+		err := errors.New("Tokens are not signed with public keys")
+		ctx.JSON(http.StatusNotFound, responseError(err))
+		return
+	}
+
+	keys := keySet.PublicKeys()
+	rsp := tokenKeysResponse{Keys: make([]tokenKeyResponse, len(keys))}
+	for i, key := range keys {
+		status := "active"
+		if key.Retired {
+			status = "retired"
+		}
+		rsp.Keys[i] = tokenKeyResponse{
+			KeyID:     key.ID,
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(key.Key),
+			Use:       "sig",
+			Algorithm: "v2.public",
+			Status:    status,
+		}
+	}
+
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, rsp)
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/token"
+	"github.com/liquiddev99/dropbyte-backend/totp"
+)
+
+// TOTP secrets are wrapped by the master key. Enrollment stores the secret
+// without enabling it, the first valid code turns two-factor authentication on
+// and hands out the recovery codes. Only hashes of recovery codes are stored.
+
+type enrollTotpRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type enrollTotpResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type confirmTotpRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type regenerateRecoveryCodesRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type disableTotpRequest struct {
+	Password     string `json:"password"      binding:"required"`
+	Code         string `json:"code"          binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// replaceRecoveryCodes invalidates the previous recovery codes of user and
+// returns a new set.
+func (server *Server) replaceRecoveryCodes(ctx context.Context, user db.User) ([]string, error) {
+	codes, err := totp.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([][]byte, len(codes))
+	for i, code := range codes {
+		hashes[i] = totp.HashRecoveryCode(code)
+	}
+
+	if err := server.db.DeleteRecoveryCodes(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	err = server.db.CreateRecoveryCodes(ctx, db.CreateRecoveryCodesParams{
+		UserID:     user.ID,
+		CodeHashes: hashes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (server *Server) enrollTotp(ctx *gin.Context) {
+	var req enrollTotpRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	user, ok := server.checkCurrentPassword(ctx, req.Password)
+	if !ok {
+		return
+	}
+
+	errEnabled := errors.New("Two-factor authentication is already enabled")
+	if user.TotpEnabledAt.Valid {
+		ctx.JSON(http.StatusConflict, responseError(errEnabled))
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	wrapped, err := server.keyring.WrapSecret(secret)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	rows, err := server.db.SetUserTotpSecret(ctx, db.SetUserTotpSecretParams{
+		ID:         user.ID,
+		TotpSecret: wrapped,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+	if rows == 0 {
+		ctx.JSON(http.StatusConflict, responseError(errEnabled))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, enrollTotpResponse{
+		Secret: totp.EncodeSecret(secret),
+		URI:    totp.URI(server.config.TotpIssuer, user.Email, secret),
+	})
+}
+
+func (server *Server) confirmTotp(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
+	var req confirmTotpRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	user, err := server.db.GetUser(ctx, authPayload.UserId)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	errEnabled := errors.New("Two-factor authentication is already enabled")
+	if user.TotpEnabledAt.Valid {
+		ctx.JSON(http.StatusConflict, responseError(errEnabled))
+		return
+	}
+	if user.TotpSecret == nil {
+		err := errors.New("Two-factor enrollment has not been started")
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	if err := totp.CheckSecondFactor(ctx, server.db, server.keyring, user, req.Code, ""); err != nil {
+		if err == totp.ErrInvalidSecondFactor {
+			ctx.JSON(http.StatusBadRequest, responseError(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	codes, err := server.replaceRecoveryCodes(ctx, user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	rows, err := server.db.EnableUserTotp(ctx, user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+	if rows == 0 {
+		ctx.JSON(http.StatusConflict, responseError(errEnabled))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// regenerateRecoveryCodes replaces all recovery codes, used or not.
+func (server *Server) regenerateRecoveryCodes(ctx *gin.Context) {
+	var req regenerateRecoveryCodesRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	user, ok := server.checkCurrentPassword(ctx, req.Password)
+	if !ok {
+		return
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		err := errors.New("Two-factor authentication is not enabled")
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	codes, err := server.replaceRecoveryCodes(ctx, user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (server *Server) disableTotp(ctx *gin.Context) {
+	var req disableTotpRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	user, ok := server.checkCurrentPassword(ctx, req.Password)
+	if !ok {
+		return
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		err := errors.New("Two-factor authentication is not enabled")
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	if err := totp.CheckSecondFactor(ctx, server.db, server.keyring, user, req.Code, req.RecoveryCode); err != nil {
+		if err == totp.ErrInvalidSecondFactor {
+			ctx.JSON(http.StatusForbidden, responseError(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	if err := server.db.DisableUserTotp(ctx, user.ID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	if err := server.db.DeleteRecoveryCodes(ctx, user.ID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.String(http.StatusOK, "OK")
+}
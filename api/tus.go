@@ -0,0 +1,652 @@
+package api
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/encryption"
+	"github.com/liquiddev99/dropbyte-backend/request"
+)
+
+// Resumable uploads implement the tus 1.0 core protocol together with the
+// creation, termination and expiration extensions (https://tus.io/protocols).
+//
+// Received bytes are encrypted and shipped to B2 as parts of a large file once
+// enough of them are buffered. Until then they are kept in the uploads row, so
+// an upload can continue on any server.
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,expiration"
+	// Plaintext per B2 part. Encrypted, this stays above B2's 5MB minimum.
+	tusPartSize = 80 * encryption.DefaultChunkSize
+)
+
+var errTusConflict = errors.New("Upload was modified concurrently")
+
+// tusResumable rejects requests speaking another tus version and marks every
+// response with the supported one.
+func tusResumable() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Tus-Resumable", tusVersion)
+
+		if ctx.Request.Method != http.MethodOptions && ctx.GetHeader("Tus-Resumable") != tusVersion {
+			ctx.Header("Tus-Version", tusVersion)
+			err := errors.New("Unsupported tus version")
+			ctx.AbortWithStatusJSON(http.StatusPreconditionFailed, responseError(err))
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+func (server *Server) tusOptions(ctx *gin.Context) {
+	ctx.Header("Tus-Version", tusVersion)
+	ctx.Header("Tus-Extension", tusExtensions)
+	ctx.Header("Tus-Max-Size", strconv.FormatInt(server.config.MaxUploadSize, 10))
+	ctx.Status(http.StatusNoContent)
+}
+
+func (server *Server) createTusUpload(ctx *gin.Context) {
+	if ctx.GetHeader("Upload-Defer-Length") != "" {
+		err := errors.New("Deferred upload length is not supported")
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	length, err := strconv.ParseInt(ctx.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		err := errors.New("Invalid Upload-Length header")
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	if !server.checkUploadSize(ctx, uploadOwner(ctx), length) {
+		return
+	}
+
+	metadata := ctx.GetHeader("Upload-Metadata")
+	if _, _, err := parseTusFileMetadata(metadata); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	// The content hash isn't known until the upload is done, and the blob
+	// may end up shared with other owners, so the B2 object gets a random
+	// name rather than the file's.
+	objectName := uuid.NewString()
+
+	dataKey, err := encryption.NewKey()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+	header, err := encryption.NewHeader(encryption.DefaultChunkSize)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+	wrappedKey, err := server.keyring.WrapBlobKey(dataKey)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+	sha1State, err := sha1.New().(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+	sha256State, err := sha256.New().(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	arg := db.CreateUploadParams{
+		Owner:            uploadOwner(ctx),
+		Length:           length,
+		Metadata:         metadata,
+		FileName:         objectName,
+		Sha1State:        sha1State,
+		Sha256State:      sha256State,
+		WrappedKey:       wrappedKey,
+		EncryptionHeader: header.Marshal(),
+		ExpiresAt:        time.Now().Add(server.config.UploadExpiration),
+	}
+
+	upload, err := server.db.CreateUpload(ctx, arg)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.Header("Location", strings.TrimSuffix(ctx.Request.URL.Path, "/")+"/"+upload.ID.String())
+	ctx.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	ctx.Status(http.StatusCreated)
+}
+
+func (server *Server) headTusUpload(ctx *gin.Context) {
+	upload, ok := server.getTusUpload(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Upload-Offset", strconv.FormatInt(upload.UploadOffset, 10))
+	ctx.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	ctx.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.Metadata != "" {
+		ctx.Header("Upload-Metadata", upload.Metadata)
+	}
+	ctx.Status(http.StatusOK)
+}
+
+func (server *Server) patchTusUpload(ctx *gin.Context) {
+	upload, ok := server.getTusUpload(ctx)
+	if !ok {
+		return
+	}
+
+	if ctx.ContentType() != "application/offset+octet-stream" {
+		err := errors.New("Content-Type must be application/offset+octet-stream")
+		ctx.JSON(http.StatusUnsupportedMediaType, responseError(err))
+		return
+	}
+
+	offset, err := strconv.ParseInt(ctx.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		err := errors.New("Invalid Upload-Offset header")
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+	if offset != upload.UploadOffset {
+		err := fmt.Errorf("Upload-Offset must be %d", upload.UploadOffset)
+		ctx.JSON(http.StatusConflict, responseError(err))
+		return
+	}
+
+	progress, err := server.newTusProgress(upload)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	readErr := progress.receive(ctx, io.LimitReader(ctx.Request.Body, upload.Length-offset))
+
+	// Keep whatever arrived, even if the client went away half way.
+	if err := progress.save(ctx); err != nil {
+		status := http.StatusInternalServerError
+		if err == errTusConflict {
+			status = http.StatusConflict
+		}
+		ctx.JSON(status, responseError(err))
+		return
+	}
+	if readErr != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(readErr))
+		return
+	}
+
+	if progress.upload.UploadOffset == progress.upload.Length {
+		file, err := progress.complete(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, responseError(err))
+			return
+		}
+		ctx.Header("Upload-File-Id", file.ID.String())
+	}
+
+	ctx.Header("Upload-Offset", strconv.FormatInt(progress.upload.UploadOffset, 10))
+	ctx.Header("Upload-Expires", progress.upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	ctx.Status(http.StatusNoContent)
+}
+
+func (server *Server) deleteTusUpload(ctx *gin.Context) {
+	upload, ok := server.getTusUpload(ctx)
+	if !ok {
+		return
+	}
+
+	if err := server.removeTusUpload(ctx, upload); err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// getTusUpload loads the upload named in the URL for the current owner. On
+// failure the error response is already written.
+func (server *Server) getTusUpload(ctx *gin.Context) (db.Upload, bool) {
+	var upload db.Upload
+
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, responseError(errors.New("Upload not found")))
+		return upload, false
+	}
+
+	upload, err = server.db.GetUpload(ctx, id)
+	if err == nil && upload.Owner != uploadOwner(ctx) {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, responseError(errors.New("Upload not found")))
+			return upload, false
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return upload, false
+	}
+
+	if time.Now().After(upload.ExpiresAt) {
+		ctx.JSON(http.StatusGone, responseError(errors.New("Upload has expired")))
+		return upload, false
+	}
+
+	return upload, true
+}
+
+// removeTusUpload drops an unfinished upload along with its B2 parts.
+func (server *Server) removeTusUpload(ctx context.Context, upload db.Upload) error {
+	if upload.LargeFileID != "" {
+		authResponse, err := request.AuthorizeAccount(
+			server.config.B2ApplicationKeyId,
+			server.config.B2ApplicationKey,
+		)
+		if err != nil {
+			return err
+		}
+
+		err = request.CancelLargeFile(upload.LargeFileID, authResponse.AuthorizationToken)
+		if err != nil {
+			return err
+		}
+	}
+
+	return server.db.DeleteUpload(ctx, upload.ID)
+}
+
+func (server *Server) removeExpiredUploads() {
+	ctx := context.Background()
+
+	uploads, err := server.db.ListExpiredUploads(ctx)
+	if err != nil {
+		log.Println("Failed to list expired uploads", err)
+		return
+	}
+
+	for _, upload := range uploads {
+		if err := server.removeTusUpload(ctx, upload); err != nil {
+			log.Println("Failed to remove expired upload", upload.ID, err)
+		}
+	}
+}
+
+// tusProgress tracks an upload while a PATCH request feeds it. Uploads started
+// before blobs were shared by SHA-256 have no sha256 state and aren't shared.
+type tusProgress struct {
+	server    *Server
+	upload    db.Upload
+	saved     int64
+	hash      hash.Hash
+	sha256    hash.Hash
+	stream    *encryption.Stream
+	authToken string
+}
+
+func (server *Server) newTusProgress(upload db.Upload) (*tusProgress, error) {
+	var sha256Hash hash.Hash
+	if upload.Sha256State != nil {
+		sha256Hash = sha256.New()
+		if err := sha256Hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(upload.Sha256State); err != nil {
+			return nil, err
+		}
+	}
+
+	hash := sha1.New()
+	if err := hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(upload.Sha1State); err != nil {
+		return nil, err
+	}
+
+	dataKey, err := server.keyring.UnwrapBlobKey(upload.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	header, err := encryption.ParseHeader(upload.EncryptionHeader)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := encryption.NewStream(dataKey, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tusProgress{
+		server: server,
+		upload: upload,
+		saved:  upload.UploadOffset,
+		hash:   hash,
+		sha256: sha256Hash,
+		stream: stream,
+	}, nil
+}
+
+// receive consumes body, shipping a part to B2 whenever more than a part's
+// worth is buffered. At least one byte is always held back so the final part,
+// whose last chunk is sealed differently, is only built on completion.
+func (progress *tusProgress) receive(ctx context.Context, body io.Reader) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := body.Read(buf)
+		if n > 0 {
+			progress.hash.Write(buf[:n])
+			if progress.sha256 != nil {
+				progress.sha256.Write(buf[:n])
+			}
+			progress.upload.Pending = append(progress.upload.Pending, buf[:n]...)
+			progress.upload.UploadOffset += int64(n)
+		}
+
+		if len(progress.upload.Pending) > tusPartSize {
+			if err := progress.uploadPart(progress.upload.Pending[:tusPartSize], false); err != nil {
+				return err
+			}
+			progress.upload.Pending = append([]byte(nil), progress.upload.Pending[tusPartSize:]...)
+
+			if err := progress.save(ctx); err != nil {
+				return err
+			}
+		}
+
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+func (progress *tusProgress) save(ctx context.Context) error {
+	sha1State, err := progress.hash.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	var sha256State []byte
+	if progress.sha256 != nil {
+		sha256State, err = progress.sha256.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return err
+		}
+	}
+
+	rows, err := progress.server.db.UpdateUploadProgress(ctx, db.UpdateUploadProgressParams{
+		UploadOffset:   progress.upload.UploadOffset,
+		Pending:        progress.upload.Pending,
+		Sha1State:      sha1State,
+		Sha256State:    sha256State,
+		LargeFileID:    progress.upload.LargeFileID,
+		PartSha1s:      progress.upload.PartSha1s,
+		ID:             progress.upload.ID,
+		PreviousOffset: progress.saved,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errTusConflict
+	}
+
+	progress.saved = progress.upload.UploadOffset
+	progress.upload.Sha1State = sha1State
+	progress.upload.Sha256State = sha256State
+	return nil
+}
+
+func (progress *tusProgress) b2AuthToken() (string, error) {
+	if progress.authToken == "" {
+		authResponse, err := request.AuthorizeAccount(
+			progress.server.config.B2ApplicationKeyId,
+			progress.server.config.B2ApplicationKey,
+		)
+		if err != nil {
+			return "", err
+		}
+		progress.authToken = authResponse.AuthorizationToken
+	}
+	return progress.authToken, nil
+}
+
+// uploadPart encrypts plaintext as the next part of the B2 large file,
+// starting the large file first if needed.
+func (progress *tusProgress) uploadPart(plaintext []byte, final bool) error {
+	authToken, err := progress.b2AuthToken()
+	if err != nil {
+		return err
+	}
+
+	if progress.upload.LargeFileID == "" {
+		largeFile, err := request.StartLargeFile(
+			progress.server.config.BucketId,
+			progress.upload.FileName,
+			authToken,
+		)
+		if err != nil {
+			return err
+		}
+		progress.upload.LargeFileID = largeFile.FileId
+	}
+
+	partNumber := len(progress.upload.PartSha1s) + 1
+	firstChunk := uint64(partNumber-1) * tusPartSize / encryption.DefaultChunkSize
+
+	var part []byte
+	if partNumber == 1 {
+		part = append([]byte(nil), progress.upload.EncryptionHeader...)
+	}
+	part = append(part, progress.stream.EncryptChunks(plaintext, firstChunk, final)...)
+	partSHA1 := sha1.Sum(part)
+
+	partUrl, err := request.GetUploadPartUrl(progress.upload.LargeFileID, authToken)
+	if err != nil {
+		return err
+	}
+
+	err = request.UploadPart(
+		partUrl.UploadUrl,
+		partUrl.AuthorizationToken,
+		partNumber,
+		part,
+		hex.EncodeToString(partSHA1[:]),
+	)
+	if err != nil {
+		return err
+	}
+
+	progress.upload.PartSha1s = append(progress.upload.PartSha1s, hex.EncodeToString(partSHA1[:]))
+	return nil
+}
+
+// complete stores the remaining bytes, turns the upload into a regular file
+// and forgets the upload. Content that is already stored is deduplicated and
+// the parts uploaded so far are discarded.
+func (progress *tusProgress) complete(ctx context.Context) (db.File, error) {
+	server := progress.server
+	upload := progress.upload
+
+	hash := contentHash{SHA1: hex.EncodeToString(progress.hash.Sum(nil))}
+	var blob db.Blob
+	err := pgx.ErrNoRows
+	if progress.sha256 != nil {
+		hash.SHA256 = hex.EncodeToString(progress.sha256.Sum(nil))
+		blob, err = server.db.AcquireBlob(ctx, db.AcquireBlobParams{
+			Sha256: pgtype.Text{String: hash.SHA256, Valid: true},
+			Size:   upload.Length,
+		})
+	}
+	if err == nil {
+		if err := server.removeTusUpload(ctx, upload); err != nil {
+			log.Println("Failed to remove deduplicated upload", upload.ID, err)
+		}
+	} else if err == pgx.ErrNoRows {
+		blob, err = progress.storeBlob(ctx, hash)
+		if err != nil {
+			return db.File{}, err
+		}
+
+		if err := server.db.DeleteUpload(ctx, upload.ID); err != nil {
+			log.Println("Failed to delete completed upload", upload.ID, err)
+		}
+	} else {
+		return db.File{}, err
+	}
+
+	fileName, e2e, err := parseTusFileMetadata(upload.Metadata)
+	if err != nil {
+		server.releaseBlob(ctx, blob.ID)
+		return db.File{}, err
+	}
+
+	return server.createFile(ctx, newCreateFileParams(upload.Owner, fileName, e2e), blob)
+}
+
+func (progress *tusProgress) storeBlob(ctx context.Context, hash contentHash) (db.Blob, error) {
+	server := progress.server
+	upload := progress.upload
+
+	var fileId, fileName, bucketId, contentType string
+	if upload.LargeFileID == "" {
+		// Too small for a large file, store it in one go.
+		object := append(append([]byte(nil), progress.upload.EncryptionHeader...), progress.stream.EncryptChunks(upload.Pending, 0, true)...)
+		objectSHA1 := sha1.Sum(object)
+
+		uploadResp, err := request.UploadFile(
+			server.b2UploadUrl,
+			server.b2UrlAuthToken,
+			upload.FileName,
+			object,
+			hex.EncodeToString(objectSHA1[:]),
+		)
+		if err != nil {
+			return db.Blob{}, err
+		}
+		fileId, fileName, bucketId, contentType = uploadResp.FileId, uploadResp.FileName, uploadResp.BucketId, uploadResp.ContentType
+	} else {
+		if err := progress.uploadPart(upload.Pending, true); err != nil {
+			return db.Blob{}, err
+		}
+
+		authToken, err := progress.b2AuthToken()
+		if err != nil {
+			return db.Blob{}, err
+		}
+
+		finishResp, err := request.FinishLargeFile(upload.LargeFileID, progress.upload.PartSha1s, authToken)
+		if err != nil {
+			return db.Blob{}, err
+		}
+		fileId, fileName, bucketId, contentType = finishResp.FileId, finishResp.FileName, finishResp.BucketId, finishResp.ContentType
+	}
+
+	blob, err := server.db.CreateBlob(ctx, db.CreateBlobParams{
+		Sha1:             hash.SHA1,
+		Sha256:           pgtype.Text{String: hash.SHA256, Valid: hash.SHA256 != ""},
+		Size:             upload.Length,
+		FileID:           fileId,
+		BucketID:         bucketId,
+		FileName:         fileName,
+		ContentType:      contentType,
+		WrappedKey:       upload.WrappedKey,
+		EncryptionHeader: upload.EncryptionHeader,
+	})
+	if err != nil {
+		server.deleteStoredFile(fileId, fileName)
+		return blob, err
+	}
+
+	// A concurrent upload of the same content won the race, drop our copy.
+	if blob.FileID != fileId {
+		server.deleteStoredFile(fileId, fileName)
+	}
+
+	return blob, nil
+}
+
+// parseTusFileMetadata reads the file name, or the end-to-end encryption
+// metadata, from an Upload-Metadata header.
+func parseTusFileMetadata(header string) (string, *e2eUploadRequest, error) {
+	metadata, err := parseTusMetadata(header)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if _, ok := metadata["encrypted_name"]; ok {
+		chunkSize, err := strconv.ParseInt(metadata["chunk_size"], 10, 32)
+		if err != nil {
+			return "", nil, errors.New("Invalid chunk_size metadata")
+		}
+
+		e2e := &e2eUploadRequest{
+			EncryptedName: metadata["encrypted_name"],
+			ChunkSize:     int32(chunkSize),
+			KeyHint:       metadata["key_hint"],
+		}
+		if err := binding.Validator.ValidateStruct(e2e); err != nil {
+			return "", nil, err
+		}
+		return "", e2e, nil
+	}
+
+	fileName := metadata["filename"]
+	if fileName == "" {
+		return "", nil, errors.New("Upload-Metadata must contain a filename")
+	}
+	return fileName, nil, nil
+}
+
+// parseTusMetadata decodes "key base64value" pairs separated by commas.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("Invalid Upload-Metadata header")
+		}
+		if _, ok := metadata[key]; ok {
+			return nil, fmt.Errorf("Duplicate Upload-Metadata key %s", key)
+		}
+
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Upload-Metadata value for %s", key)
+		}
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
@@ -2,129 +2,153 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/kurin/blazer/b2"
 
 	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/encryption"
+	"github.com/liquiddev99/dropbyte-backend/request"
 	"github.com/liquiddev99/dropbyte-backend/token"
 )
 
 type responseFile struct {
-	FileID   string `json:"fileId"`
-	BucketID string `json:"bucketId"`
-	FileName string `json:"fileName"`
-	Size     uint   `json:"contentLength"`
-	FileType string `json:"contentType"`
+	ID       uuid.UUID `json:"id"`
+	FileID   string    `json:"fileId"`
+	BucketID string    `json:"bucketId"`
+	FileName string    `json:"fileName"`
+	Size     uint      `json:"contentLength"`
+	FileType string    `json:"contentType"`
+}
+
+// e2eUploadRequest describes a file the client encrypted itself. The server
+// stores it as opaque bytes; the key only ever lives in the link fragment.
+type e2eUploadRequest struct {
+	EncryptedName string `form:"encrypted_name" binding:"required,max=1024"`
+	ChunkSize     int32  `form:"chunk_size"     binding:"required,min=1,max=16777216"`
+	KeyHint       string `form:"key_hint"       binding:"max=64"`
 }
 
 func (server *Server) guestUploadFile(ctx *gin.Context) {
-	// Get file information
-	file, err := ctx.FormFile("file")
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, responseError(err))
-		return
-	}
+	server.uploadFile(ctx, uuid.Nil, nil)
+}
 
-	openedFile, err := file.Open()
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, responseError(err))
-		return
-	}
-	defer openedFile.Close()
+func (server *Server) userUploadFile(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
 
-	fileContent := &bytes.Buffer{}
-	io.Copy(fileContent, openedFile)
+	server.uploadFile(ctx, authPayload.UserId, nil)
+}
 
-	_, fileHeader, err := ctx.Request.FormFile("file")
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, responseError(err))
+func (server *Server) guestUploadE2EFile(ctx *gin.Context) {
+	var req e2eUploadRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
 		return
 	}
 
-	openedHeader, err := fileHeader.Open()
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, responseError(err))
-		return
-	}
-	defer openedHeader.Close()
+	server.uploadFile(ctx, uuid.Nil, &req)
+}
 
-	// Upload file
-	uploadRequest, err := http.NewRequest(
-		"POST",
-		server.b2UploadUrl,
-		fileContent,
-	)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, responseError(err))
-		return
-	}
+func (server *Server) userUploadE2EFile(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
 
-	sha1Hash := sha1.New()
-	if _, err := io.Copy(sha1Hash, openedHeader); err != nil {
-		ctx.JSON(http.StatusInternalServerError, responseError(err))
+	var req e2eUploadRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
 		return
 	}
 
-	contentSHA1 := hex.EncodeToString(sha1Hash.Sum(nil))
+	server.uploadFile(ctx, authPayload.UserId, &req)
+}
 
-	uploadRequest.Header.Set(
-		"Authorization",
-		server.b2UrlAuthToken,
-	)
-	uploadRequest.Header.Set("X-Bz-File-Name", url.QueryEscape(file.Filename))
-	uploadRequest.Header.Set("Content-Length", fmt.Sprintf("%d", fileContent.Len()))
-	uploadRequest.Header.Set("Content-Type", "b2/x-auto")
-	uploadRequest.Header.Set("X-Bz-Content-Sha1", contentSHA1)
+// uploadOwner returns the authenticated user, or uuid.Nil on the guest routes.
+func uploadOwner(ctx *gin.Context) uuid.UUID {
+	if payload, ok := ctx.Get("payload"); ok {
+		return payload.(*token.Payload).UserId
+	}
+	return uuid.Nil
+}
 
-	// Upload the file to specific dst.
-	client := &http.Client{}
+// checkUploadSize reports whether owner may upload size bytes. Users who have
+// not verified their email get a smaller limit, and the file must fit in what
+// is left of their storage quota. On failure the error response is already
+// written.
+func (server *Server) checkUploadSize(ctx *gin.Context, owner uuid.UUID, size int64) bool {
+	limit := server.config.MaxUploadSize
+	verified := true
+
+	if owner != uuid.Nil {
+		user, err := server.db.GetUser(ctx, owner)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, responseError(err))
+			return false
+		}
+		if !user.EmailVerifiedAt.Valid && server.config.UnverifiedMaxUploadSize < limit {
+			limit = server.config.UnverifiedMaxUploadSize
+			verified = false
+		}
+		if !server.checkQuota(ctx, user, size) {
+			return false
+		}
+	}
 
-	uploadResp, err := client.Do(uploadRequest)
-	if uploadResp.StatusCode != 200 {
-		ctx.JSON(http.StatusInternalServerError, responseError(err))
-		return
+	if size <= limit {
+		return true
 	}
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, responseError(err))
-		return
+
+	err := fmt.Errorf("File exceeds the upload limit of %d bytes", limit)
+	if !verified {
+		err = fmt.Errorf("%w, verify your email to upload larger files", err)
 	}
-	defer uploadResp.Body.Close()
+	ctx.JSON(http.StatusRequestEntityTooLarge, responseError(err))
+	return false
+}
 
-	var responseData responseFile
-	err = json.NewDecoder(uploadResp.Body).Decode(&responseData)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, responseError(err))
-		return
+// storageQuota is the number of bytes user may store, 0 for no limit.
+func (server *Server) storageQuota(user db.User) int64 {
+	if user.StorageQuota.Valid {
+		return user.StorageQuota.Int64
 	}
+	return server.config.DefaultStorageQuota
+}
 
-	fileArg := db.CreateFileParams{
-		FileID:   responseData.FileID,
-		BucketID: responseData.BucketID,
-		Size:     fmt.Sprintf("%d", responseData.Size),
-		Name:     responseData.FileName,
-		FileType: responseData.FileType,
+// checkQuota reports whether size more bytes fit in the quota of user. Uploads
+// in progress aren't counted, so parallel uploads can overshoot it by one
+// file each.
+func (server *Server) checkQuota(ctx *gin.Context, user db.User, size int64) bool {
+	quota := server.storageQuota(user)
+	if quota <= 0 {
+		return true
 	}
 
-	_, err = server.db.CreateFile(ctx, fileArg)
+	usage, err := server.db.GetUserUsage(ctx, user.ID)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, responseError(err))
-		return
+		return false
 	}
 
-	ctx.JSON(http.StatusOK, responseData)
+	if usage.UsedBytes+size > quota {
+		err := fmt.Errorf("Storage quota of %d bytes exceeded, %d bytes are in use", quota, usage.UsedBytes)
+		ctx.JSON(http.StatusForbidden, responseError(err))
+		return false
+	}
+	return true
 }
 
-func (server *Server) userUploadFile(ctx *gin.Context) {
-	authPayload := ctx.MustGet("payload").(*token.Payload)
-
+// uploadFile stores the multipart "file" field for owner. Identical content is
+// only uploaded to B2 once; later uploads reference the existing blob. With e2e
+// set the content is client-side ciphertext and its real name is never stored.
+func (server *Server) uploadFile(ctx *gin.Context, owner uuid.UUID, e2e *e2eUploadRequest) {
 	// Get file information
 	file, err := ctx.FormFile("file")
 	if err != nil {
@@ -132,6 +156,10 @@ func (server *Server) userUploadFile(ctx *gin.Context) {
 		return
 	}
 
+	if !server.checkUploadSize(ctx, owner, file.Size) {
+		return
+	}
+
 	openedFile, err := file.Open()
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, responseError(err))
@@ -140,86 +168,185 @@ func (server *Server) userUploadFile(ctx *gin.Context) {
 	defer openedFile.Close()
 
 	fileContent := &bytes.Buffer{}
-	io.Copy(fileContent, openedFile)
-
-	_, fileHeader, err := ctx.Request.FormFile("file")
-	if err != nil {
+	if _, err := io.Copy(fileContent, openedFile); err != nil {
 		ctx.JSON(http.StatusInternalServerError, responseError(err))
 		return
 	}
 
-	openedHeader, err := fileHeader.Open()
+	sha1Hash := sha1.Sum(fileContent.Bytes())
+	sha256Hash := sha256.Sum256(fileContent.Bytes())
+	hash := contentHash{
+		SHA1:   hex.EncodeToString(sha1Hash[:]),
+		SHA256: hex.EncodeToString(sha256Hash[:]),
+	}
+
+	fileArg := newCreateFileParams(owner, file.Filename, e2e)
+
+	blob, err := server.acquireBlob(ctx, fileContent.Bytes(), hash)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, responseError(err))
 		return
 	}
-	defer openedHeader.Close()
 
-	// Upload file
-	uploadRequest, err := http.NewRequest(
-		"POST",
-		server.b2UploadUrl,
-		fileContent,
-	)
+	created, err := server.createFile(ctx, fileArg, blob)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, responseError(err))
 		return
 	}
 
-	sha1Hash := sha1.New()
-	if _, err := io.Copy(sha1Hash, openedHeader); err != nil {
-		ctx.JSON(http.StatusInternalServerError, responseError(err))
-		return
+	ctx.JSON(http.StatusOK, responseFile{
+		ID:       created.ID,
+		FileID:   created.FileID,
+		BucketID: created.BucketID,
+		FileName: created.Name,
+		Size:     uint(blob.Size),
+		FileType: created.FileType,
+	})
+}
+
+// newCreateFileParams describes a file named name, or an end-to-end encrypted
+// one whose real name stays hidden when e2e is set.
+func newCreateFileParams(owner uuid.UUID, name string, e2e *e2eUploadRequest) db.CreateFileParams {
+	fileArg := db.CreateFileParams{
+		Owner: owner,
+		Name:  name,
 	}
+	if e2e != nil {
+		fileArg.Name = ""
+		fileArg.E2e = true
+		fileArg.EncryptedName = e2e.EncryptedName
+		fileArg.ChunkSize = e2e.ChunkSize
+		fileArg.KeyHint = e2e.KeyHint
+	}
+	return fileArg
+}
 
-	contentSHA1 := hex.EncodeToString(sha1Hash.Sum(nil))
+// createFile records a file backed by blob, taking over the reference held on
+// it. The reference is released again if the file cannot be created.
+func (server *Server) createFile(
+	ctx context.Context,
+	fileArg db.CreateFileParams,
+	blob db.Blob,
+) (db.File, error) {
+	wrappedKey, err := server.wrapFileKey(ctx, blob, fileArg.Owner)
+	if err != nil {
+		server.releaseBlob(ctx, blob.ID)
+		return db.File{}, err
+	}
 
-	uploadRequest.Header.Set(
-		"Authorization",
-		server.b2UrlAuthToken,
-	)
-	uploadRequest.Header.Set("X-Bz-File-Name", url.QueryEscape(file.Filename))
-	uploadRequest.Header.Set("Content-Length", fmt.Sprintf("%d", fileContent.Len()))
-	uploadRequest.Header.Set("Content-Type", "b2/x-auto")
-	uploadRequest.Header.Set("X-Bz-Content-Sha1", contentSHA1)
+	fileArg.FileID = blob.FileID
+	fileArg.BucketID = blob.BucketID
+	fileArg.Size = fmt.Sprintf("%d", blob.Size)
+	fileArg.FileType = blob.ContentType
+	fileArg.BlobID = blob.ID
+	fileArg.WrappedKey = wrappedKey
+
+	file, err := server.db.CreateFile(ctx, fileArg)
+	if err != nil {
+		server.releaseBlob(ctx, blob.ID)
+		return file, err
+	}
 
-	// Upload the file to specific dst.
-	client := &http.Client{}
+	return file, nil
+}
 
-	uploadResp, err := client.Do(uploadRequest)
-	if uploadResp.StatusCode != 200 {
-		ctx.JSON(http.StatusInternalServerError, responseError(err))
-		return
+// contentHash identifies the plaintext of a blob. Blobs are shared by SHA-256,
+// SHA-1 is only kept because B2 reports it for stored files.
+type contentHash struct {
+	SHA1   string
+	SHA256 string
+}
+
+// acquireBlob returns the blob holding content with one more reference taken.
+// New content is encrypted with a fresh data key and uploaded to B2 under its
+// hash, a blob is shared by every owner of the content so none of their names
+// fits; content that is already stored is only referenced again.
+func (server *Server) acquireBlob(
+	ctx context.Context,
+	content []byte,
+	hash contentHash,
+) (db.Blob, error) {
+	blob, err := server.db.AcquireBlob(ctx, db.AcquireBlobParams{
+		Sha256: pgtype.Text{String: hash.SHA256, Valid: true},
+		Size:   int64(len(content)),
+	})
+	if err != pgx.ErrNoRows {
+		return blob, err
 	}
+
+	dataKey, err := encryption.NewKey()
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, responseError(err))
-		return
+		return blob, err
+	}
+	header, err := encryption.NewHeader(encryption.DefaultChunkSize)
+	if err != nil {
+		return blob, err
+	}
+	stream, err := encryption.NewStream(dataKey, header)
+	if err != nil {
+		return blob, err
+	}
+	wrappedKey, err := server.keyring.WrapBlobKey(dataKey)
+	if err != nil {
+		return blob, err
 	}
-	defer uploadResp.Body.Close()
 
-	var responseData responseFile
-	err = json.NewDecoder(uploadResp.Body).Decode(&responseData)
+	ciphertext := stream.Encrypt(content)
+	cipherSHA1 := sha1.Sum(ciphertext)
+
+	uploadResp, err := request.UploadFile(
+		server.b2UploadUrl,
+		server.b2UrlAuthToken,
+		hash.SHA256,
+		ciphertext,
+		hex.EncodeToString(cipherSHA1[:]),
+	)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, responseError(err))
-		return
+		return blob, err
 	}
 
-	fileArg := db.CreateFileParams{
-		FileID:   responseData.FileID,
-		BucketID: responseData.BucketID,
-		Owner:    authPayload.UserId,
-		Size:     fmt.Sprintf("%d", responseData.Size),
-		Name:     responseData.FileName,
-		FileType: responseData.FileType,
+	blob, err = server.db.CreateBlob(ctx, db.CreateBlobParams{
+		Sha1:             hash.SHA1,
+		Sha256:           pgtype.Text{String: hash.SHA256, Valid: true},
+		Size:             int64(len(content)),
+		FileID:           uploadResp.FileId,
+		BucketID:         uploadResp.BucketId,
+		FileName:         uploadResp.FileName,
+		ContentType:      uploadResp.ContentType,
+		WrappedKey:       wrappedKey,
+		EncryptionHeader: header.Marshal(),
+	})
+	if err != nil {
+		server.deleteStoredFile(uploadResp.FileId, uploadResp.FileName)
+		return blob, err
+	}
+
+	// A concurrent upload of the same content won the race, drop our copy.
+	if blob.FileID != uploadResp.FileId {
+		server.deleteStoredFile(uploadResp.FileId, uploadResp.FileName)
+	}
+
+	return blob, nil
+}
+
+// wrapFileKey wraps the data key of blob under the KEK of owner. Blobs stored
+// before encryption at rest have no key and yield nil.
+func (server *Server) wrapFileKey(ctx context.Context, blob db.Blob, owner uuid.UUID) ([]byte, error) {
+	if blob.WrappedKey == nil {
+		return nil, nil
 	}
 
-	_, err = server.db.CreateFile(ctx, fileArg)
+	dataKey, err := server.keyring.UnwrapBlobKey(blob.WrappedKey)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, responseError(err))
-		return
+		return nil, err
+	}
+
+	kek, err := server.keyring.UserKey(ctx, owner)
+	if err != nil {
+		return nil, err
 	}
 
-	ctx.JSON(http.StatusOK, responseData)
+	return encryption.WrapKey(kek, dataKey)
 }
 
 func (server *Server) guestUploadFileB2(ctx *gin.Context) {
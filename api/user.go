@@ -2,43 +2,63 @@ package api
 
 import (
 	"errors"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 
+	"github.com/liquiddev99/dropbyte-backend/authenticator"
 	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/lockout"
+	"github.com/liquiddev99/dropbyte-backend/token"
+	"github.com/liquiddev99/dropbyte-backend/totp"
 	"github.com/liquiddev99/dropbyte-backend/util"
 )
 
 type createUserRequest struct {
-	Password string `json:"password"  binding:"required,min=6"`
+	Password string `json:"password"  binding:"required,password"`
 	FullName string `json:"full_name" binding:"required"`
 	Email    string `json:"email"     binding:"required,email"`
 }
 
 type userResponse struct {
-	FullName  string    `json:"full_name"    binding:"required"`
-	Email     string    `json:"email"        binding:"required,email"`
-	Token     string    `json:"access_token"`
-	CreatedAt time.Time `json:"created_at"`
+	FullName              string    `json:"full_name"                binding:"required"`
+	Email                 string    `json:"email"                    binding:"required,email"`
+	EmailVerified         bool      `json:"email_verified"`
+	Role                  string    `json:"role"`
+	SessionID             uuid.UUID `json:"session_id"`
+	Token                 string    `json:"access_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+	CSRFToken             string    `json:"csrf_token"`
+	CreatedAt             time.Time `json:"created_at"`
 }
 
-func newUserResponse(user db.User, token string) userResponse {
+func newUserResponse(user db.User, tokens sessionTokens) userResponse {
 	return userResponse{
-		FullName:  user.FullName,
-		Email:     user.Email,
-		Token:     token,
-		CreatedAt: user.CreatedAt,
+		FullName:              user.FullName,
+		Email:                 user.Email,
+		EmailVerified:         user.EmailVerifiedAt.Valid,
+		Role:                  user.Role,
+		SessionID:             tokens.SessionID,
+		Token:                 tokens.AccessToken,
+		AccessTokenExpiresAt:  tokens.AccessTokenExpiresAt,
+		RefreshToken:          tokens.RefreshToken,
+		RefreshTokenExpiresAt: tokens.RefreshTokenExpiresAt,
+		CSRFToken:             tokens.CSRFToken,
+		CreatedAt:             user.CreatedAt,
 	}
 }
 
 func (server *Server) createUser(ctx *gin.Context) {
 	var req createUserRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, responseError(err))
+		ctx.JSON(http.StatusBadRequest, bindingError(err))
 		return
 	}
 
@@ -64,11 +84,21 @@ func (server *Server) createUser(ctx *gin.Context) {
 		ctx.JSON(http.StatusInternalServerError, responseError(err))
 		return
 	}
-	token, err := server.token.CreateToken(user.ID, server.config.AccessTokenDuration)
 
-	ctx.SetCookie("access_token", token, 86400, "/", server.config.Domain, true, true)
+	// The account works right away, with the restrictions of an unverified one.
+	if err := server.sendVerificationEmail(user); err != nil {
+		log.Println("Failed to send verification email", user.ID, err)
+	}
 
-	userResponse := newUserResponse(user, token)
+	tokens, err := server.createSession(ctx, user.ID, uuid.Nil)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	server.setSessionCookies(ctx, tokens)
+
+	userResponse := newUserResponse(user, tokens)
 
 	ctx.JSON(http.StatusOK, userResponse)
 }
@@ -78,6 +108,20 @@ type loginUserRequest struct {
 	Password string `json:"password" binding:"required,min=6"`
 }
 
+// mfaChallengeResponse replaces the session tokens when the account has
+// two-factor authentication enabled.
+type mfaChallengeResponse struct {
+	MFARequired       bool      `json:"mfa_required"`
+	MFAToken          string    `json:"mfa_token"`
+	MFATokenExpiresAt time.Time `json:"mfa_token_expires_at"`
+}
+
+type loginMFARequest struct {
+	MFAToken     string `json:"mfa_token"     binding:"required"`
+	Code         string `json:"code"          binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
 func (server *Server) loginUser(ctx *gin.Context) {
 	var req loginUserRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -85,32 +129,161 @@ func (server *Server) loginUser(ctx *gin.Context) {
 		return
 	}
 
-	user, err := server.db.GetUserByEmail(ctx, req.Email)
+	attempt := lockout.Attempt{
+		Email:     req.Email,
+		ClientIP:  ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	}
+	if !server.checkLockout(ctx, attempt) {
+		return
+	}
+
+	user, err := server.authenticator.Authenticate(ctx, req.Email, req.Password)
+	attempt.UserID = user.ID
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			ctx.JSON(http.StatusNotFound, responseError(err))
+		if err == authenticator.ErrInvalidCredentials {
+			server.loginFailed(ctx, attempt)
+			ctx.JSON(http.StatusUnauthorized, responseError(errInvalidCredentials))
 			return
 		}
 		ctx.JSON(http.StatusInternalServerError, responseError(err))
 		return
 	}
+	if !checkSuspended(ctx, user) {
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		mfaToken, mfaPayload, err := server.token.CreateToken(
+			user.ID,
+			uuid.Nil,
+			token.MFAToken,
+			server.config.MFAChallengeDuration,
+		)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, responseError(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, mfaChallengeResponse{
+			MFARequired:       true,
+			MFAToken:          mfaToken,
+			MFATokenExpiresAt: mfaPayload.ExpiredAt,
+		})
+		return
+	}
+
+	server.loginSucceeded(ctx, attempt)
 
-	err = util.CheckPassword(req.Password, user.HashedPassword)
+	tokens, err := server.createSession(ctx, user.ID, uuid.Nil)
 	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	server.setSessionCookies(ctx, tokens)
+
+	userResponse := newUserResponse(user, tokens)
+
+	ctx.JSON(http.StatusOK, userResponse)
+}
+
+// loginMFA finishes a login started with a password by checking the second
+// factor.
+func (server *Server) loginMFA(ctx *gin.Context) {
+	var req loginMFARequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, responseError(err))
 		return
 	}
 
-	token, err := server.token.CreateToken(user.ID, server.config.AccessTokenDuration)
+	mfaPayload, err := server.token.VerifyToken(req.MFAToken, token.MFAToken)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, responseError(err))
+		return
+	}
+
+	user, err := server.db.GetUser(ctx, mfaPayload.UserId)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.JSON(http.StatusUnauthorized, responseError(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		err := errors.New("Two-factor authentication is not enabled")
+		ctx.JSON(http.StatusUnauthorized, responseError(err))
+		return
+	}
+	if !checkSuspended(ctx, user) {
+		return
+	}
+
+	attempt := lockout.Attempt{
+		UserID:    user.ID,
+		Email:     user.Email,
+		ClientIP:  ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	}
+	if !server.checkLockout(ctx, attempt) {
+		return
+	}
 
-	ctx.SetCookie("access_token", token, 86400, "/", server.config.Domain, true, true)
+	if err := totp.CheckSecondFactor(ctx, server.db, server.keyring, user, req.Code, req.RecoveryCode); err != nil {
+		if err == totp.ErrInvalidSecondFactor {
+			server.loginFailed(ctx, attempt)
+			ctx.JSON(http.StatusUnauthorized, responseError(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
 
-	userResponse := newUserResponse(user, token)
+	server.loginSucceeded(ctx, attempt)
 
-	ctx.JSON(http.StatusOK, userResponse)
+	tokens, err := server.createSession(ctx, user.ID, uuid.Nil)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	server.setSessionCookies(ctx, tokens)
+
+	ctx.JSON(http.StatusOK, newUserResponse(user, tokens))
 }
 
+// logout revokes the current session, including the refresh tokens rotated
+// from the same login.
 func (server *Server) logout(ctx *gin.Context) {
-	ctx.SetCookie("access_token", "", -1, "/", server.config.Domain, true, true)
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
+	session, err := server.db.GetSession(ctx, authPayload.SessionId)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	if err := server.db.BlockSessionFamily(ctx, session.FamilyID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	server.clearSessionCookies(ctx)
+	ctx.String(http.StatusOK, "OK")
+}
+
+// logoutAll revokes every session of the user, on all devices.
+func (server *Server) logoutAll(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
+	if err := server.db.BlockUserSessions(ctx, authPayload.UserId); err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	server.clearSessionCookies(ctx)
 	ctx.String(http.StatusOK, "OK")
 }
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/liquiddev99/dropbyte-backend/validation"
+)
+
+// validPassword applies the password policy to fields tagged "password". The
+// email and full name of the same request, if it has them, must not appear in
+// the password.
+var validPassword validator.Func = func(fl validator.FieldLevel) bool {
+	value, ok := fl.Field().Interface().(string)
+	if !ok {
+		return false
+	}
+
+	var personal []string
+	parent := fl.Parent()
+	if parent.Kind() == reflect.Struct {
+		for _, name := range []string{"Email", "FullName"} {
+			if field := parent.FieldByName(name); field.Kind() == reflect.String {
+				personal = append(personal, field.String())
+			}
+		}
+	}
+
+	return validation.ValidateNewPassword(value, personal...) == nil
+}
+
+// jsonFieldName makes validation errors name fields the way clients send them.
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// bindingError is responseError for binding failures, with a message for
+// each invalid field so clients can show it next to the input.
+func bindingError(err error) gin.H {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return responseError(err)
+	}
+
+	fields := gin.H{}
+	for _, fieldError := range validationErrors {
+		fields[fieldError.Field()] = fieldMessage(fieldError)
+	}
+
+	return gin.H{"error": err.Error(), "fields": fields}
+}
+
+func fieldMessage(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required":
+		return "Must be provided"
+	case "password":
+		value, _ := fieldError.Value().(string)
+		if err := validation.ValidateNewPassword(value); err != nil {
+			return err.Error()
+		}
+		// Only the check against the email and name is left.
+		return "Must not contain your email or name"
+	default:
+		return "Failed the " + fieldError.Tag() + " check"
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/mailer"
+	"github.com/liquiddev99/dropbyte-backend/token"
+)
+
+type verifyEmailRequest struct {
+	UserID    string `form:"user"      binding:"required,uuid"`
+	Expires   int64  `form:"expires"   binding:"required"`
+	Signature string `form:"signature" binding:"required"`
+}
+
+func (server *Server) sendVerificationEmail(user db.User) error {
+	link := token.EmailVerificationLink(
+		server.config.PublicUrl,
+		[]byte(server.config.SymmetricKey),
+		user.ID,
+		user.Email,
+		time.Now().Add(server.config.EmailVerificationDuration),
+	)
+
+	return server.mailer.Send(mailer.VerificationMessage(
+		user.Email,
+		user.FullName,
+		link,
+		server.config.EmailVerificationDuration,
+	))
+}
+
+func (server *Server) verifyEmail(ctx *gin.Context) {
+	var req verifyEmailRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	if time.Now().Unix() > req.Expires {
+		err := errors.New("Verification link has expired")
+		ctx.JSON(http.StatusGone, responseError(err))
+		return
+	}
+
+	user, err := server.db.GetUser(ctx, uuid.MustParse(req.UserID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, responseError(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	if !token.CheckEmailVerificationSignature(
+		[]byte(server.config.SymmetricKey),
+		user.ID,
+		user.Email,
+		req.Expires,
+		req.Signature,
+	) {
+		err := errors.New("Invalid verification link")
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	if _, err := server.db.VerifyUserEmail(ctx, db.VerifyUserEmailParams{
+		ID:    user.ID,
+		Email: user.Email,
+	}); err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"email": user.Email, "email_verified": true})
+}
+
+func (server *Server) resendVerificationEmail(ctx *gin.Context) {
+	authPayload := ctx.MustGet("payload").(*token.Payload)
+
+	user, err := server.db.GetUser(ctx, authPayload.UserId)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	if user.EmailVerifiedAt.Valid {
+		err := errors.New("Email is already verified")
+		ctx.JSON(http.StatusBadRequest, responseError(err))
+		return
+	}
+
+	if err := server.sendVerificationEmail(user); err != nil {
+		ctx.JSON(http.StatusInternalServerError, responseError(err))
+		return
+	}
+
+	ctx.String(http.StatusOK, "OK")
+}
@@ -0,0 +1,105 @@
+// Package apikey issues and checks long-lived API keys for scripts. Keys are
+// random, only their SHA-256 is stored, and each key is limited to the scopes
+// it was created with.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+)
+
+// Prefix tells API keys apart from access tokens in the Authorization header.
+const Prefix = "dbk_"
+
+// PrefixLength is how much of a key is stored in the clear so users can tell
+// their keys apart.
+const PrefixLength = len(Prefix) + 8
+
+const (
+	ScopeFilesRead    = "files:read"
+	ScopeFilesWrite   = "files:write"
+	ScopeSharesManage = "shares:manage"
+)
+
+var Scopes = []string{ScopeFilesRead, ScopeFilesWrite, ScopeSharesManage}
+
+var (
+	ErrInvalidKey = errors.New("Invalid API key")
+	ErrExpiredKey = errors.New("API key has expired")
+)
+
+// Generate returns a new key and the hash to store for it.
+func Generate() (string, []byte, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+
+	key := Prefix + base64.RawURLEncoding.EncodeToString(buf)
+	return key, Hash(key), nil
+}
+
+func Hash(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+// IsKey reports whether the bearer credential is an API key.
+func IsKey(credential string) bool {
+	return strings.HasPrefix(credential, Prefix)
+}
+
+func ValidScope(scope string) bool {
+	for _, valid := range Scopes {
+		if scope == valid {
+			return true
+		}
+	}
+	return false
+}
+
+func HasScope(key db.ApiKey, scope string) bool {
+	for _, granted := range key.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate looks up the stored key for credential.
+func Authenticate(ctx context.Context, store *db.Queries, credential string) (db.ApiKey, error) {
+	key, err := store.GetApiKeyByHash(ctx, Hash(credential))
+	return checkKey(key, err)
+}
+
+// Get looks up a key by id, for tokens that were minted with it.
+func Get(ctx context.Context, store *db.Queries, id uuid.UUID) (db.ApiKey, error) {
+	key, err := store.GetApiKey(ctx, id)
+	return checkKey(key, err)
+}
+
+func checkKey(key db.ApiKey, err error) (db.ApiKey, error) {
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return key, ErrInvalidKey
+		}
+		return key, err
+	}
+
+	if key.ExpiresAt.Valid && time.Now().After(key.ExpiresAt.Time) {
+		return key, ErrExpiredKey
+	}
+
+	return key, nil
+}
@@ -0,0 +1,52 @@
+package apikey
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+)
+
+func TestGenerate(t *testing.T) {
+	key, hash, err := Generate()
+	require.NoError(t, err)
+	require.True(t, IsKey(key))
+	require.Greater(t, len(key), PrefixLength)
+	require.Equal(t, Hash(key), hash)
+
+	other, _, err := Generate()
+	require.NoError(t, err)
+	require.NotEqual(t, key, other)
+	require.NotEqual(t, Hash(key), Hash(other))
+}
+
+func TestIsKey(t *testing.T) {
+	require.True(t, IsKey("dbk_abc"))
+	require.False(t, IsKey("v2.local.abc"))
+	require.False(t, IsKey(""))
+}
+
+func TestScopes(t *testing.T) {
+	key := db.ApiKey{Scopes: []string{ScopeFilesRead}}
+
+	testCases := []struct {
+		scope string
+		valid bool
+		has   bool
+	}{
+		{ScopeFilesRead, true, true},
+		{ScopeFilesWrite, true, false},
+		{ScopeSharesManage, true, false},
+		{"files:*", false, false},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.scope, func(t *testing.T) {
+			require.Equal(t, tc.valid, ValidScope(tc.scope))
+			require.Equal(t, tc.has, HasScope(key, tc.scope))
+		})
+	}
+}
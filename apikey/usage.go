@@ -0,0 +1,65 @@
+package apikey
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+)
+
+// UsageRecorder collects when keys were used and writes it in one statement
+// per interval, so requests made with a key do not each cost an UPDATE.
+type UsageRecorder struct {
+	store *db.Queries
+	mu    sync.Mutex
+	used  map[uuid.UUID]time.Time
+}
+
+func NewUsageRecorder(store *db.Queries) *UsageRecorder {
+	return &UsageRecorder{store: store, used: map[uuid.UUID]time.Time{}}
+}
+
+func (recorder *UsageRecorder) Touch(keyID uuid.UUID) {
+	recorder.mu.Lock()
+	recorder.used[keyID] = time.Now()
+	recorder.mu.Unlock()
+}
+
+func (recorder *UsageRecorder) Flush(ctx context.Context) error {
+	recorder.mu.Lock()
+	used := recorder.used
+	recorder.used = map[uuid.UUID]time.Time{}
+	recorder.mu.Unlock()
+
+	if len(used) == 0 {
+		return nil
+	}
+
+	arg := db.UpdateApiKeysLastUsedParams{
+		Ids:         make([]uuid.UUID, 0, len(used)),
+		LastUsedAts: make([]time.Time, 0, len(used)),
+	}
+	for keyID, lastUsed := range used {
+		arg.Ids = append(arg.Ids, keyID)
+		arg.LastUsedAts = append(arg.LastUsedAts, lastUsed)
+	}
+
+	return recorder.store.UpdateApiKeysLastUsed(ctx, arg)
+}
+
+func (recorder *UsageRecorder) Start(interval time.Duration) {
+	ticker := time.Tick(interval)
+
+	go func() {
+		for {
+			<-ticker
+			if err := recorder.Flush(context.Background()); err != nil {
+				log.Println("Failed to update API key last used", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,89 @@
+// Package authenticator checks login credentials. Each provider checks them
+// against its own source, the password stored in the database or an LDAP
+// directory, and returns the account they log in to.
+package authenticator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/util"
+)
+
+// ErrInvalidCredentials is returned for unknown emails and wrong passwords
+// alike.
+var ErrInvalidCredentials = errors.New("Invalid email or password")
+
+type Authenticator interface {
+	// Authenticate returns the account email and password log in to. With
+	// ErrInvalidCredentials the account is still returned when the provider
+	// knows it, so the failure can be recorded against it.
+	Authenticate(ctx context.Context, email string, password string) (db.User, error)
+}
+
+// Chain tries each provider in turn until one accepts the credentials. A
+// provider that fails is logged and skipped, so one that is down can't make
+// the emails it knows answer differently.
+type Chain []Authenticator
+
+func (chain Chain) Authenticate(ctx context.Context, email string, password string) (db.User, error) {
+	var known db.User
+	for _, provider := range chain {
+		user, err := provider.Authenticate(ctx, email, password)
+		if err == nil {
+			return user, nil
+		}
+		if err != ErrInvalidCredentials {
+			log.Println("Login provider failed", err)
+			continue
+		}
+		if known.ID == uuid.Nil {
+			known = user
+		}
+	}
+	return known, ErrInvalidCredentials
+}
+
+// New chains the providers listed in LOGIN_PROVIDERS, the database password
+// alone if none are.
+func New(config util.Config, store *db.Queries) (Authenticator, error) {
+	var chain Chain
+	for _, name := range strings.Split(config.LoginProviders, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "password":
+			chain = append(chain, NewPassword(store))
+		case "ldap":
+			roleGroups, err := ParseRoleGroups(config.LDAPRoleGroups)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, NewLDAP(store, LDAPConfig{
+				URL:            config.LDAPUrl,
+				StartTLS:       config.LDAPStartTLS,
+				BindDN:         config.LDAPBindDN,
+				BindPassword:   config.LDAPBindPassword,
+				BaseDN:         config.LDAPBaseDN,
+				UserFilter:     config.LDAPUserFilter,
+				IDAttribute:    config.LDAPIDAttribute,
+				EmailAttribute: config.LDAPEmailAttribute,
+				NameAttribute:  config.LDAPNameAttribute,
+				GroupAttribute: config.LDAPGroupAttribute,
+				RoleGroups:     roleGroups,
+			}))
+		default:
+			return nil, fmt.Errorf("Unknown login provider %q", name)
+		}
+	}
+
+	if len(chain) == 0 {
+		return NewPassword(store), nil
+	}
+	return chain, nil
+}
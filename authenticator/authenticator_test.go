@@ -0,0 +1,87 @@
+package authenticator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+)
+
+type stubAuthenticator struct {
+	user db.User
+	err  error
+}
+
+func (stub stubAuthenticator) Authenticate(ctx context.Context, email string, password string) (db.User, error) {
+	return stub.user, stub.err
+}
+
+func TestChain(t *testing.T) {
+	known := db.User{ID: uuid.New()}
+	accepted := db.User{ID: uuid.New()}
+	unavailable := errors.New("directory unavailable")
+
+	testCases := []struct {
+		name  string
+		chain Chain
+		user  db.User
+		err   error
+	}{
+		{
+			name: "FirstAccepts",
+			chain: Chain{
+				stubAuthenticator{user: accepted},
+				stubAuthenticator{err: unavailable},
+			},
+			user: accepted,
+		},
+		{
+			name: "FallsThrough",
+			chain: Chain{
+				stubAuthenticator{user: known, err: ErrInvalidCredentials},
+				stubAuthenticator{user: accepted},
+			},
+			user: accepted,
+		},
+		{
+			name: "AllReject",
+			chain: Chain{
+				stubAuthenticator{err: ErrInvalidCredentials},
+				stubAuthenticator{user: known, err: ErrInvalidCredentials},
+			},
+			user: known,
+			err:  ErrInvalidCredentials,
+		},
+		{
+			name: "ProviderErrorSkipped",
+			chain: Chain{
+				stubAuthenticator{err: unavailable},
+				stubAuthenticator{user: accepted},
+			},
+			user: accepted,
+		},
+		{
+			name: "ProviderErrorHidden",
+			chain: Chain{
+				stubAuthenticator{user: known, err: ErrInvalidCredentials},
+				stubAuthenticator{err: unavailable},
+			},
+			user: known,
+			err:  ErrInvalidCredentials,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			user, err := tc.chain.Authenticate(context.Background(), "alice@example.com", "secret")
+			require.Equal(t, tc.err, err)
+			require.Equal(t, tc.user.ID, user.ID)
+		})
+	}
+}
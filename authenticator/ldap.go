@@ -0,0 +1,336 @@
+package authenticator
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/util"
+)
+
+// ldapTimeout bounds dialing and every request, a slow directory shouldn't
+// hold logins up for long.
+const ldapTimeout = 10 * time.Second
+
+type LDAPConfig struct {
+	URL      string
+	StartTLS bool
+	// BindDN and BindPassword are the service account users are searched
+	// with, anonymously if BindDN is empty.
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter finds the entry of the email logging in, which replaces
+	// the %s, for example "(mail=%s)".
+	UserFilter string
+	// IDAttribute holds an identifier that survives renames and email
+	// changes, entryUUID on most servers. Accounts are linked by it.
+	IDAttribute    string
+	EmailAttribute string
+	NameAttribute  string
+	GroupAttribute string
+	// RoleGroups maps lowercase group DNs to the role their members get.
+	RoleGroups map[string]string
+}
+
+// LDAPStore is the part of the database the LDAP provider uses, *db.Queries
+// in production.
+type LDAPStore interface {
+	GetUser(ctx context.Context, id uuid.UUID) (db.User, error)
+	GetUserByEmail(ctx context.Context, email string) (db.User, error)
+	CreateUser(ctx context.Context, arg db.CreateUserParams) (db.User, error)
+	VerifyUserEmail(ctx context.Context, arg db.VerifyUserEmailParams) (int64, error)
+	UpdateUserRole(ctx context.Context, arg db.UpdateUserRoleParams) error
+	GetUserIdentity(ctx context.Context, arg db.GetUserIdentityParams) (db.UserIdentitie, error)
+	CreateUserIdentity(ctx context.Context, arg db.CreateUserIdentityParams) (db.UserIdentitie, error)
+}
+
+// ldapIdentityProvider names directory accounts in user_identities.
+const ldapIdentityProvider = "ldap"
+
+// LDAP finds the user in the directory with the service account, then binds
+// as them to check the password. Accounts are created on first login and
+// linked to the directory entry, and when a mapped group grants a role the
+// account gets it on every login.
+type LDAP struct {
+	store  LDAPStore
+	config LDAPConfig
+}
+
+type directoryUser struct {
+	ID     string
+	DN     string
+	Email  string
+	Name   string
+	Groups []string
+}
+
+func NewLDAP(store LDAPStore, config LDAPConfig) *LDAP {
+	return &LDAP{store: store, config: config}
+}
+
+// Authenticate treats an unreachable or misconfigured directory like wrong
+// credentials, a 500 for emails only the directory knows would tell them
+// apart from local accounts.
+func (provider *LDAP) Authenticate(ctx context.Context, email string, password string) (db.User, error) {
+	entry, err := provider.lookup(email, password)
+	if err != nil {
+		if err != ErrInvalidCredentials {
+			log.Println("LDAP login failed", err)
+		}
+		return db.User{}, ErrInvalidCredentials
+	}
+	return provider.provision(ctx, entry)
+}
+
+// lookup returns the directory entry of email once password binds to it.
+func (provider *LDAP) lookup(email string, password string) (directoryUser, error) {
+	// Most servers treat a bind without a password as anonymous and let it
+	// through.
+	if password == "" {
+		return directoryUser{}, ErrInvalidCredentials
+	}
+
+	conn, err := provider.dial()
+	if err != nil {
+		return directoryUser{}, err
+	}
+	defer conn.Close()
+
+	if provider.config.BindDN != "" {
+		err := conn.Bind(provider.config.BindDN, provider.config.BindPassword)
+		if err != nil {
+			return directoryUser{}, fmt.Errorf("Failed to bind LDAP service account: %w", err)
+		}
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		provider.config.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		// Two is enough to tell an ambiguous filter apart.
+		2,
+		int(ldapTimeout.Seconds()),
+		false,
+		fmt.Sprintf(provider.config.UserFilter, ldap.EscapeFilter(email)),
+		[]string{
+			provider.config.IDAttribute,
+			provider.config.EmailAttribute,
+			provider.config.NameAttribute,
+			provider.config.GroupAttribute,
+		},
+		nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return directoryUser{}, ErrInvalidCredentials
+		}
+		return directoryUser{}, fmt.Errorf("Failed to search LDAP: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		return directoryUser{}, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return directoryUser{}, ErrInvalidCredentials
+		}
+		return directoryUser{}, fmt.Errorf("Failed to bind LDAP user: %w", err)
+	}
+
+	user := directoryUser{
+		ID:     directoryID(entry, provider.config.IDAttribute),
+		DN:     entry.DN,
+		Email:  entry.GetAttributeValue(provider.config.EmailAttribute),
+		Name:   entry.GetAttributeValue(provider.config.NameAttribute),
+		Groups: entry.GetAttributeValues(provider.config.GroupAttribute),
+	}
+	if user.Email == "" {
+		user.Email = email
+	}
+	if user.Name == "" {
+		user.Name = user.Email
+	}
+	return user, nil
+}
+
+func (provider *LDAP) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(
+		provider.config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to LDAP: %w", err)
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if provider.config.StartTLS {
+		serverUrl, err := url.Parse(provider.config.URL)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: serverUrl.Hostname()}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("Failed to start LDAP TLS: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+// provision returns the account linked to entry, creating it on first login.
+// An existing account with the same email is never taken over, the directory
+// may hand out addresses it doesn't own, so such users keep logging in with
+// their own password.
+func (provider *LDAP) provision(ctx context.Context, entry directoryUser) (db.User, error) {
+	user, err := provider.linkedUser(ctx, entry)
+	if err != nil {
+		return db.User{}, err
+	}
+
+	if role, ok := provider.roleFor(entry.Groups); ok && user.Role != role {
+		err := provider.store.UpdateUserRole(ctx, db.UpdateUserRoleParams{ID: user.ID, Role: role})
+		if err != nil {
+			return db.User{}, err
+		}
+	}
+
+	return provider.store.GetUser(ctx, user.ID)
+}
+
+func (provider *LDAP) linkedUser(ctx context.Context, entry directoryUser) (db.User, error) {
+	linked, err := provider.store.GetUserIdentity(ctx, db.GetUserIdentityParams{
+		Provider: ldapIdentityProvider,
+		Subject:  entry.ID,
+	})
+	if err == nil {
+		return provider.store.GetUser(ctx, linked.UserID)
+	}
+	if err != pgx.ErrNoRows {
+		return db.User{}, err
+	}
+
+	_, err = provider.store.GetUserByEmail(ctx, entry.Email)
+	if err == nil {
+		log.Printf("LDAP entry %s matches an existing account for %s, not linking it", entry.DN, entry.Email)
+		return db.User{}, ErrInvalidCredentials
+	}
+	if err != pgx.ErrNoRows {
+		return db.User{}, err
+	}
+
+	user, err := provider.createUser(ctx, entry)
+	if err != nil {
+		return db.User{}, err
+	}
+
+	_, err = provider.store.CreateUserIdentity(ctx, db.CreateUserIdentityParams{
+		UserID:   user.ID,
+		Provider: ldapIdentityProvider,
+		Subject:  entry.ID,
+		Email:    entry.Email,
+	})
+	return user, err
+}
+
+func (provider *LDAP) createUser(ctx context.Context, entry directoryUser) (db.User, error) {
+	hashedPassword, err := unusablePassword()
+	if err != nil {
+		return db.User{}, err
+	}
+
+	user, err := provider.store.CreateUser(ctx, db.CreateUserParams{
+		FullName:       entry.Name,
+		Email:          entry.Email,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		return db.User{}, err
+	}
+
+	_, err = provider.store.VerifyUserEmail(ctx, db.VerifyUserEmailParams{ID: user.ID, Email: user.Email})
+	return user, err
+}
+
+// roleFor picks admin if any group grants it, otherwise the first mapped
+// role. It returns false when no group is mapped, the role is then managed in
+// the app and left alone.
+func (provider *LDAP) roleFor(groups []string) (string, bool) {
+	role := ""
+	for _, group := range groups {
+		groupRole, ok := provider.config.RoleGroups[strings.ToLower(group)]
+		if !ok {
+			continue
+		}
+		if groupRole == util.RoleAdmin {
+			return groupRole, true
+		}
+		if role == "" {
+			role = groupRole
+		}
+	}
+	return role, role != ""
+}
+
+// directoryID reads the stable identifier of entry. Binary ones such as
+// Active Directory's objectGUID are base64 encoded. Without one the DN is the
+// best there is.
+func directoryID(entry *ldap.Entry, attribute string) string {
+	raw := entry.GetRawAttributeValue(attribute)
+	if len(raw) == 0 {
+		return strings.ToLower(entry.DN)
+	}
+	if utf8.Valid(raw) {
+		return string(raw)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// ParseRoleGroups reads role:group DN pairs separated by semicolons, since the
+// DNs themselves contain commas.
+func ParseRoleGroups(spec string) (map[string]string, error) {
+	roleGroups := make(map[string]string)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		role, group, ok := strings.Cut(entry, ":")
+		role, group = strings.TrimSpace(role), strings.TrimSpace(group)
+		if !ok || group == "" {
+			return nil, fmt.Errorf("Invalid LDAP role group %q", entry)
+		}
+		if !util.ValidRole(role) {
+			return nil, fmt.Errorf("Unknown role %q", role)
+		}
+
+		roleGroups[strings.ToLower(group)] = role
+	}
+	return roleGroups, nil
+}
+
+// unusablePassword returns a hash no password matches, directory users log
+// in through the directory.
+func unusablePassword() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return util.HashPassword(base64.RawURLEncoding.EncodeToString(buf))
+}
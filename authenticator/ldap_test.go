@@ -0,0 +1,523 @@
+package authenticator
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/util"
+)
+
+const (
+	serviceDN       = "cn=dropbyte,ou=services,dc=example,dc=com"
+	servicePassword = "service secret"
+	adminsGroup     = "cn=admins,ou=groups,dc=example,dc=com"
+	aliceID         = "5b1c3f3e-8d1e-4a57-9f8a-2f4a3c7d9e01"
+	staffGroup      = "cn=staff,ou=groups,dc=example,dc=com"
+)
+
+type directoryEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// fakeDirectory is an in-process stand-in for an LDAP server. It answers
+// simple binds and searches on the mail attribute, which is all the provider
+// uses.
+type fakeDirectory struct {
+	entries []directoryEntry
+}
+
+func newFakeDirectory(t *testing.T, entries ...directoryEntry) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	directory := &fakeDirectory{entries: entries}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go directory.serve(conn)
+		}
+	}()
+
+	return "ldap://" + listener.Addr().String()
+}
+
+func (directory *fakeDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+
+		switch request.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := request.Children[1].Value.(string)
+			password := request.Children[2].Data.String()
+
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			if directory.bind(dn, password) {
+				code = ldap.LDAPResultSuccess
+			}
+			reply(conn, id, result(ldap.ApplicationBindResponse, code))
+
+		case ldap.ApplicationSearchRequest:
+			sizeLimit := request.Children[3].Value.(int64)
+			filter, err := ldap.DecompileFilter(request.Children[6])
+			if err != nil {
+				reply(conn, id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError))
+				continue
+			}
+
+			matches := directory.search(filter)
+			if sizeLimit > 0 && int64(len(matches)) > sizeLimit {
+				reply(conn, id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSizeLimitExceeded))
+				continue
+			}
+			for _, entry := range matches {
+				reply(conn, id, searchEntry(entry))
+			}
+			reply(conn, id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+
+		default:
+			return
+		}
+	}
+}
+
+func (directory *fakeDirectory) bind(dn string, password string) bool {
+	if dn == serviceDN {
+		return password == servicePassword
+	}
+	for _, entry := range directory.entries {
+		if entry.dn == dn {
+			return entry.password == password
+		}
+	}
+	return false
+}
+
+func (directory *fakeDirectory) search(filter string) []directoryEntry {
+	var matches []directoryEntry
+	for _, entry := range directory.entries {
+		for _, mail := range entry.attributes["mail"] {
+			if filter == "(mail="+ldap.EscapeFilter(mail)+")" {
+				matches = append(matches, entry)
+			}
+		}
+	}
+	return matches
+}
+
+func reply(conn net.Conn, id int64, response *ber.Packet) {
+	packet := ber.NewSequence("LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	packet.AppendChild(response)
+	conn.Write(packet.Bytes())
+}
+
+func result(tag ber.Tag, code uint16) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Code"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "MatchedDN"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Message"))
+	return packet
+}
+
+func searchEntry(entry directoryEntry) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Entry")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "DN"))
+
+	attributes := ber.NewSequence("Attributes")
+	for name, values := range entry.attributes {
+		attribute := ber.NewSequence("Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	packet.AppendChild(attributes)
+
+	return packet
+}
+
+func newTestLDAP(t *testing.T) *LDAP {
+	url := newFakeDirectory(t,
+		directoryEntry{
+			dn:       "uid=alice,ou=people,dc=example,dc=com",
+			password: "alice password",
+			attributes: map[string][]string{
+				"entryUUID": {aliceID},
+				"mail":      {"alice@example.com"},
+				"cn":        {"Alice Liddell"},
+				"memberOf":  {staffGroup, "CN=Admins,OU=Groups,DC=example,DC=com"},
+			},
+		},
+		directoryEntry{
+			dn:       "uid=bob,ou=people,dc=example,dc=com",
+			password: "bob password",
+			attributes: map[string][]string{
+				"mail": {"bob@example.com"},
+			},
+		},
+		directoryEntry{
+			dn:         "uid=twin1,ou=people,dc=example,dc=com",
+			password:   "twin password",
+			attributes: map[string][]string{"mail": {"twin@example.com"}},
+		},
+		directoryEntry{
+			dn:         "uid=twin2,ou=people,dc=example,dc=com",
+			password:   "twin password",
+			attributes: map[string][]string{"mail": {"twin@example.com"}},
+		},
+	)
+
+	roleGroups, err := ParseRoleGroups("admin:" + adminsGroup + "; user:" + staffGroup)
+	require.NoError(t, err)
+
+	return NewLDAP(nil, LDAPConfig{
+		URL:            url,
+		BindDN:         serviceDN,
+		BindPassword:   servicePassword,
+		BaseDN:         "dc=example,dc=com",
+		UserFilter:     "(mail=%s)",
+		IDAttribute:    "entryUUID",
+		EmailAttribute: "mail",
+		NameAttribute:  "cn",
+		GroupAttribute: "memberOf",
+		RoleGroups:     roleGroups,
+	})
+}
+
+func TestLDAPLookup(t *testing.T) {
+	provider := newTestLDAP(t)
+
+	testCases := []struct {
+		name          string
+		email         string
+		password      string
+		checkResponse func(t *testing.T, user directoryUser, err error)
+	}{
+		{
+			name:     "OK",
+			email:    "alice@example.com",
+			password: "alice password",
+			checkResponse: func(t *testing.T, user directoryUser, err error) {
+				require.NoError(t, err)
+				require.Equal(t, aliceID, user.ID)
+				require.Equal(t, "uid=alice,ou=people,dc=example,dc=com", user.DN)
+				require.Equal(t, "alice@example.com", user.Email)
+				require.Equal(t, "Alice Liddell", user.Name)
+				require.Len(t, user.Groups, 2)
+
+				role, ok := provider.roleFor(user.Groups)
+				require.True(t, ok)
+				require.Equal(t, util.RoleAdmin, role)
+			},
+		},
+		{
+			name:     "NoNameOrGroups",
+			email:    "bob@example.com",
+			password: "bob password",
+			checkResponse: func(t *testing.T, user directoryUser, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "uid=bob,ou=people,dc=example,dc=com", user.ID)
+				require.Equal(t, "bob@example.com", user.Name)
+
+				_, ok := provider.roleFor(user.Groups)
+				require.False(t, ok)
+			},
+		},
+		{
+			name:     "WrongPassword",
+			email:    "alice@example.com",
+			password: "bob password",
+			checkResponse: func(t *testing.T, user directoryUser, err error) {
+				require.ErrorIs(t, err, ErrInvalidCredentials)
+			},
+		},
+		{
+			name:     "EmptyPassword",
+			email:    "alice@example.com",
+			password: "",
+			checkResponse: func(t *testing.T, user directoryUser, err error) {
+				require.ErrorIs(t, err, ErrInvalidCredentials)
+			},
+		},
+		{
+			name:     "UnknownUser",
+			email:    "carol@example.com",
+			password: "alice password",
+			checkResponse: func(t *testing.T, user directoryUser, err error) {
+				require.ErrorIs(t, err, ErrInvalidCredentials)
+			},
+		},
+		{
+			name:     "FilterInjection",
+			email:    "*",
+			password: "alice password",
+			checkResponse: func(t *testing.T, user directoryUser, err error) {
+				require.ErrorIs(t, err, ErrInvalidCredentials)
+			},
+		},
+		{
+			name:     "Ambiguous",
+			email:    "twin@example.com",
+			password: "twin password",
+			checkResponse: func(t *testing.T, user directoryUser, err error) {
+				require.ErrorIs(t, err, ErrInvalidCredentials)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			user, err := provider.lookup(tc.email, tc.password)
+			tc.checkResponse(t, user, err)
+		})
+	}
+}
+
+func TestLDAPServiceAccount(t *testing.T) {
+	provider := newTestLDAP(t)
+	provider.config.BindPassword = "wrong"
+
+	_, err := provider.lookup("alice@example.com", "alice password")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrInvalidCredentials)
+}
+
+// memoryStore keeps the users and identities the LDAP provider touches.
+type memoryStore struct {
+	users      map[uuid.UUID]db.User
+	identities []db.UserIdentitie
+}
+
+func newMemoryStore(users ...db.User) *memoryStore {
+	store := &memoryStore{users: make(map[uuid.UUID]db.User)}
+	for _, user := range users {
+		store.users[user.ID] = user
+	}
+	return store
+}
+
+func (store *memoryStore) GetUser(ctx context.Context, id uuid.UUID) (db.User, error) {
+	user, ok := store.users[id]
+	if !ok {
+		return db.User{}, pgx.ErrNoRows
+	}
+	return user, nil
+}
+
+func (store *memoryStore) GetUserByEmail(ctx context.Context, email string) (db.User, error) {
+	for _, user := range store.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return db.User{}, pgx.ErrNoRows
+}
+
+func (store *memoryStore) CreateUser(ctx context.Context, arg db.CreateUserParams) (db.User, error) {
+	user := db.User{
+		ID:             uuid.New(),
+		FullName:       arg.FullName,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+		Role:           util.RoleUser,
+	}
+	store.users[user.ID] = user
+	return user, nil
+}
+
+func (store *memoryStore) VerifyUserEmail(ctx context.Context, arg db.VerifyUserEmailParams) (int64, error) {
+	user := store.users[arg.ID]
+	user.EmailVerifiedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	store.users[arg.ID] = user
+	return 1, nil
+}
+
+func (store *memoryStore) UpdateUserRole(ctx context.Context, arg db.UpdateUserRoleParams) error {
+	user := store.users[arg.ID]
+	user.Role = arg.Role
+	store.users[arg.ID] = user
+	return nil
+}
+
+func (store *memoryStore) GetUserIdentity(ctx context.Context, arg db.GetUserIdentityParams) (db.UserIdentitie, error) {
+	for _, identity := range store.identities {
+		if identity.Provider == arg.Provider && identity.Subject == arg.Subject {
+			return identity, nil
+		}
+	}
+	return db.UserIdentitie{}, pgx.ErrNoRows
+}
+
+func (store *memoryStore) CreateUserIdentity(ctx context.Context, arg db.CreateUserIdentityParams) (db.UserIdentitie, error) {
+	identity := db.UserIdentitie{
+		ID:       uuid.New(),
+		UserID:   arg.UserID,
+		Provider: arg.Provider,
+		Subject:  arg.Subject,
+		Email:    arg.Email,
+	}
+	store.identities = append(store.identities, identity)
+	return identity, nil
+}
+
+func TestLDAPProvision(t *testing.T) {
+	alice := directoryUser{
+		ID:     aliceID,
+		DN:     "uid=alice,ou=people,dc=example,dc=com",
+		Email:  "alice@example.com",
+		Name:   "Alice Liddell",
+		Groups: []string{adminsGroup},
+	}
+	bob := directoryUser{
+		ID:    "uid=bob,ou=people,dc=example,dc=com",
+		DN:    "uid=bob,ou=people,dc=example,dc=com",
+		Email: "bob@example.com",
+		Name:  "bob@example.com",
+	}
+	linkedAdmin := db.User{ID: uuid.New(), Email: "bob@example.com", Role: util.RoleAdmin}
+	linkedBob := db.UserIdentitie{UserID: linkedAdmin.ID, Provider: ldapIdentityProvider, Subject: bob.ID}
+
+	testCases := []struct {
+		name          string
+		entry         directoryUser
+		users         []db.User
+		identities    []db.UserIdentitie
+		checkResponse func(t *testing.T, store *memoryStore, user db.User, err error)
+	}{
+		{
+			name:  "FirstLogin",
+			entry: alice,
+			checkResponse: func(t *testing.T, store *memoryStore, user db.User, err error) {
+				require.NoError(t, err)
+				require.Equal(t, alice.Email, user.Email)
+				require.Equal(t, alice.Name, user.FullName)
+				require.True(t, user.EmailVerifiedAt.Valid)
+				require.Equal(t, util.RoleAdmin, user.Role)
+				require.ErrorIs(t, util.CheckPassword("", user.HashedPassword), util.ErrPasswordMismatch)
+
+				require.Len(t, store.identities, 1)
+				require.Equal(t, user.ID, store.identities[0].UserID)
+				require.Equal(t, aliceID, store.identities[0].Subject)
+			},
+		},
+		{
+			name:       "LinkedByID",
+			entry:      directoryUser{ID: aliceID, Email: "alice.renamed@example.com", Groups: alice.Groups},
+			users:      []db.User{{ID: linkedAdmin.ID, Email: alice.Email, Role: util.RoleUser}},
+			identities: []db.UserIdentitie{{UserID: linkedAdmin.ID, Provider: ldapIdentityProvider, Subject: aliceID}},
+			checkResponse: func(t *testing.T, store *memoryStore, user db.User, err error) {
+				require.NoError(t, err)
+				require.Equal(t, linkedAdmin.ID, user.ID)
+				require.Equal(t, alice.Email, user.Email)
+				require.Equal(t, util.RoleAdmin, user.Role)
+				require.Len(t, store.users, 1)
+			},
+		},
+		{
+			name:       "RoleKeptWithoutMappedGroup",
+			entry:      bob,
+			users:      []db.User{linkedAdmin},
+			identities: []db.UserIdentitie{linkedBob},
+			checkResponse: func(t *testing.T, store *memoryStore, user db.User, err error) {
+				require.NoError(t, err)
+				require.Equal(t, util.RoleAdmin, user.Role)
+			},
+		},
+		{
+			name:  "UnverifiedLocalAccountNotClaimed",
+			entry: bob,
+			users: []db.User{{ID: linkedAdmin.ID, Email: bob.Email, HashedPassword: "local", Role: util.RoleUser}},
+			checkResponse: func(t *testing.T, store *memoryStore, user db.User, err error) {
+				require.ErrorIs(t, err, ErrInvalidCredentials)
+				require.Empty(t, store.identities)
+				require.Len(t, store.users, 1)
+
+				local := store.users[linkedAdmin.ID]
+				require.Equal(t, "local", local.HashedPassword)
+				require.False(t, local.EmailVerifiedAt.Valid)
+			},
+		},
+		{
+			name:  "VerifiedLocalAccountNotLinked",
+			entry: bob,
+			users: []db.User{{
+				ID:              linkedAdmin.ID,
+				Email:           bob.Email,
+				EmailVerifiedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+			}},
+			checkResponse: func(t *testing.T, store *memoryStore, user db.User, err error) {
+				require.ErrorIs(t, err, ErrInvalidCredentials)
+				require.Empty(t, store.identities)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			roleGroups, err := ParseRoleGroups("admin:" + adminsGroup + "; user:" + staffGroup)
+			require.NoError(t, err)
+
+			store := newMemoryStore(tc.users...)
+			store.identities = tc.identities
+			provider := NewLDAP(store, LDAPConfig{RoleGroups: roleGroups})
+
+			user, err := provider.provision(context.Background(), tc.entry)
+			tc.checkResponse(t, store, user, err)
+		})
+	}
+}
+
+func TestLDAPUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	url := "ldap://" + listener.Addr().String()
+	listener.Close()
+
+	provider := NewLDAP(newMemoryStore(), LDAPConfig{URL: url, UserFilter: "(mail=%s)"})
+	_, err = provider.Authenticate(context.Background(), "alice@example.com", "alice password")
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestParseRoleGroups(t *testing.T) {
+	roleGroups, err := ParseRoleGroups("admin:CN=Admins,DC=example,DC=com;;user:cn=staff,dc=example,dc=com")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"cn=admins,dc=example,dc=com": util.RoleAdmin,
+		"cn=staff,dc=example,dc=com":  util.RoleUser,
+	}, roleGroups)
+
+	for _, spec := range []string{"admin", "admin:", "owner:cn=owners,dc=example,dc=com"} {
+		_, err := ParseRoleGroups(spec)
+		require.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,63 @@
+package authenticator
+
+import (
+	"context"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/util"
+)
+
+// Password checks the password hash stored with the account.
+type Password struct {
+	store *db.Queries
+}
+
+func NewPassword(store *db.Queries) *Password {
+	return &Password{store: store}
+}
+
+func (provider *Password) Authenticate(ctx context.Context, email string, password string) (db.User, error) {
+	user, err := provider.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			// Take as long as a real check so the email can't be told apart.
+			util.CheckDummyPassword(password)
+			return db.User{}, ErrInvalidCredentials
+		}
+		return db.User{}, err
+	}
+
+	if err := util.CheckPassword(password, user.HashedPassword); err != nil {
+		return user, ErrInvalidCredentials
+	}
+
+	provider.rehash(ctx, user, password)
+	return user, nil
+}
+
+// rehash upgrades a legacy or outdated password hash once the password is
+// known to be right. The update is skipped if the password changed since user
+// was loaded.
+func (provider *Password) rehash(ctx context.Context, user db.User, password string) {
+	if !util.NeedsRehash(user.HashedPassword) {
+		return
+	}
+
+	hashedPassword, err := util.HashPassword(password)
+	if err != nil {
+		log.Println("Failed to rehash password", user.ID, err)
+		return
+	}
+
+	_, err = provider.store.RehashUserPassword(ctx, db.RehashUserPasswordParams{
+		HashedPassword:        hashedPassword,
+		ID:                    user.ID,
+		CurrentHashedPassword: user.HashedPassword,
+	})
+	if err != nil {
+		log.Println("Failed to rehash password", user.ID, err)
+	}
+}
@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS "files" DROP COLUMN IF EXISTS "blob_id";
+DROP TABLE IF EXISTS blobs;
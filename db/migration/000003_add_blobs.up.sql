@@ -0,0 +1,17 @@
+CREATE TABLE "blobs" (
+  "id" uuid PRIMARY KEY DEFAULT (uuid_generate_v4()),
+  "sha1" varchar NOT NULL,
+  "size" bigint NOT NULL,
+  "file_id" varchar NOT NULL,
+  "bucket_id" varchar NOT NULL,
+  "file_name" varchar NOT NULL,
+  "content_type" varchar NOT NULL,
+  "ref_count" bigint NOT NULL DEFAULT 0,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE UNIQUE INDEX ON "blobs" ("sha1", "size");
+
+ALTER TABLE "files" ADD COLUMN "blob_id" uuid REFERENCES "blobs" ("id");
+
+CREATE INDEX ON "files" ("blob_id");
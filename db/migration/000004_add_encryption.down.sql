@@ -0,0 +1,6 @@
+ALTER TABLE IF EXISTS "files" DROP COLUMN IF EXISTS "wrapped_key";
+
+ALTER TABLE IF EXISTS "blobs" DROP COLUMN IF EXISTS "encryption_header";
+ALTER TABLE IF EXISTS "blobs" DROP COLUMN IF EXISTS "wrapped_key";
+
+ALTER TABLE IF EXISTS "users" DROP COLUMN IF EXISTS "wrapped_kek";
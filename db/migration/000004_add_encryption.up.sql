@@ -0,0 +1,6 @@
+ALTER TABLE "users" ADD COLUMN "wrapped_kek" bytea;
+
+ALTER TABLE "blobs" ADD COLUMN "wrapped_key" bytea;
+ALTER TABLE "blobs" ADD COLUMN "encryption_header" bytea;
+
+ALTER TABLE "files" ADD COLUMN "wrapped_key" bytea;
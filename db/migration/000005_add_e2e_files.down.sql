@@ -0,0 +1,4 @@
+ALTER TABLE IF EXISTS "files" DROP COLUMN IF EXISTS "key_hint";
+ALTER TABLE IF EXISTS "files" DROP COLUMN IF EXISTS "chunk_size";
+ALTER TABLE IF EXISTS "files" DROP COLUMN IF EXISTS "encrypted_name";
+ALTER TABLE IF EXISTS "files" DROP COLUMN IF EXISTS "e2e";
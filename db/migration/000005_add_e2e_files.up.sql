@@ -0,0 +1,4 @@
+ALTER TABLE "files" ADD COLUMN "e2e" bool NOT NULL DEFAULT false;
+ALTER TABLE "files" ADD COLUMN "encrypted_name" varchar NOT NULL DEFAULT '';
+ALTER TABLE "files" ADD COLUMN "chunk_size" integer NOT NULL DEFAULT 0;
+ALTER TABLE "files" ADD COLUMN "key_hint" varchar NOT NULL DEFAULT '';
@@ -0,0 +1,18 @@
+CREATE TABLE "uploads" (
+  "id" uuid PRIMARY KEY DEFAULT (uuid_generate_v4()),
+  "owner" uuid,
+  "length" bigint NOT NULL,
+  "upload_offset" bigint NOT NULL DEFAULT 0,
+  "metadata" varchar NOT NULL DEFAULT '',
+  "file_name" varchar NOT NULL,
+  "large_file_id" varchar NOT NULL DEFAULT '',
+  "part_sha1s" varchar[] NOT NULL DEFAULT '{}',
+  "pending" bytea NOT NULL DEFAULT '',
+  "sha1_state" bytea NOT NULL,
+  "wrapped_key" bytea NOT NULL,
+  "encryption_header" bytea NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "uploads" ("expires_at");
@@ -0,0 +1,16 @@
+CREATE TABLE "direct_uploads" (
+  "id" uuid PRIMARY KEY DEFAULT (uuid_generate_v4()),
+  "owner" uuid,
+  "file_name" varchar NOT NULL,
+  "name" varchar NOT NULL,
+  "size" bigint NOT NULL,
+  "sha1" varchar NOT NULL,
+  "e2e" bool NOT NULL DEFAULT false,
+  "encrypted_name" varchar NOT NULL DEFAULT '',
+  "chunk_size" integer NOT NULL DEFAULT 0,
+  "key_hint" varchar NOT NULL DEFAULT '',
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "direct_uploads" ("expires_at");
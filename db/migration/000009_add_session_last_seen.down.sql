@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS "sessions" DROP COLUMN IF EXISTS "last_seen_at";
@@ -0,0 +1,26 @@
+CREATE TABLE "webauthn_credentials" (
+  "id" uuid PRIMARY KEY DEFAULT (uuid_generate_v4()),
+  "user_id" uuid NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+  "credential_id" bytea UNIQUE NOT NULL,
+  "public_key" bytea NOT NULL,
+  "attestation_type" varchar NOT NULL,
+  "transports" text[] NOT NULL DEFAULT '{}',
+  "aaguid" bytea NOT NULL,
+  "sign_count" bigint NOT NULL DEFAULT 0,
+  "backup_eligible" boolean NOT NULL DEFAULT false,
+  "backup_state" boolean NOT NULL DEFAULT false,
+  "name" varchar NOT NULL,
+  "last_used_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "webauthn_credentials" ("user_id");
+
+CREATE TABLE "webauthn_challenges" (
+  "id" uuid PRIMARY KEY DEFAULT (uuid_generate_v4()),
+  "user_id" uuid NOT NULL,
+  "ceremony" varchar NOT NULL,
+  "session_data" bytea NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
@@ -0,0 +1,13 @@
+CREATE TABLE "api_keys" (
+  "id" uuid PRIMARY KEY DEFAULT (uuid_generate_v4()),
+  "user_id" uuid NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+  "name" varchar NOT NULL,
+  "prefix" varchar NOT NULL,
+  "key_hash" bytea UNIQUE NOT NULL,
+  "scopes" text[] NOT NULL,
+  "expires_at" timestamptz,
+  "last_used_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "api_keys" ("user_id");
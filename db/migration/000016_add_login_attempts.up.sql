@@ -0,0 +1,19 @@
+CREATE TABLE "login_attempts" (
+  "id" uuid PRIMARY KEY DEFAULT (uuid_generate_v4()),
+  "user_id" uuid NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+  "client_ip" varchar NOT NULL,
+  "user_agent" varchar NOT NULL,
+  "success" boolean NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "login_attempts" ("user_id", "created_at");
+
+-- Failed logins are counted per key, an email address or a client IP, so
+-- unknown emails are throttled the same way as real accounts.
+CREATE TABLE "login_throttles" (
+  "key" varchar PRIMARY KEY,
+  "failures" integer NOT NULL DEFAULT 0,
+  "locked_until" timestamptz,
+  "last_failure_at" timestamptz NOT NULL DEFAULT (now())
+);
@@ -0,0 +1,10 @@
+CREATE TABLE "magic_links" (
+  "id" uuid PRIMARY KEY DEFAULT (uuid_generate_v4()),
+  "email" varchar NOT NULL,
+  "token_hash" bytea UNIQUE NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "used_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "magic_links" ("email");
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS admin_audit_logs;
+ALTER TABLE IF EXISTS "users" DROP COLUMN IF EXISTS "storage_quota";
+ALTER TABLE IF EXISTS "users" DROP COLUMN IF EXISTS "suspended_at";
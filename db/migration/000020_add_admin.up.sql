@@ -0,0 +1,15 @@
+ALTER TABLE "users" ADD COLUMN "suspended_at" timestamptz;
+ALTER TABLE "users" ADD COLUMN "storage_quota" bigint;
+
+CREATE TABLE "admin_audit_logs" (
+  "id" uuid PRIMARY KEY DEFAULT (uuid_generate_v4()),
+  "admin_id" uuid NOT NULL,
+  "action" varchar NOT NULL,
+  "target_user_id" uuid,
+  "details" jsonb NOT NULL DEFAULT ('{}'),
+  "client_ip" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "admin_audit_logs" ("created_at");
+CREATE INDEX ON "admin_audit_logs" ("target_user_id");
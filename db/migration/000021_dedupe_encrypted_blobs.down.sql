@@ -0,0 +1,3 @@
+DROP INDEX "blobs_sha1_size_idx";
+
+CREATE UNIQUE INDEX ON "blobs" ("sha1", "size");
@@ -0,0 +1,5 @@
+-- Only encrypted blobs are shared. Blobs stored as sent, by direct uploads or
+-- before encryption at rest, keep one owner each.
+DROP INDEX "blobs_sha1_size_idx";
+
+CREATE UNIQUE INDEX ON "blobs" ("sha1", "size") WHERE "encryption_header" IS NOT NULL;
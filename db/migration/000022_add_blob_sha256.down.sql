@@ -0,0 +1,7 @@
+ALTER TABLE "uploads" DROP COLUMN "sha256_state";
+
+DROP INDEX "blobs_sha256_size_idx";
+
+CREATE UNIQUE INDEX ON "blobs" ("sha1", "size") WHERE "encryption_header" IS NOT NULL;
+
+ALTER TABLE "blobs" DROP COLUMN "sha256";
@@ -0,0 +1,9 @@
+-- Blobs are shared by SHA-256 instead of SHA-1. Existing blobs have no SHA-256
+-- and are no longer shared with new uploads.
+ALTER TABLE "blobs" ADD COLUMN "sha256" varchar;
+
+DROP INDEX "blobs_sha1_size_idx";
+
+CREATE UNIQUE INDEX ON "blobs" ("sha256", "size") WHERE "encryption_header" IS NOT NULL;
+
+ALTER TABLE "uploads" ADD COLUMN "sha256_state" bytea;
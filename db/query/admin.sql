@@ -0,0 +1,48 @@
+-- name: ListUsers :many
+SELECT * FROM users
+WHERE sqlc.arg(search)::text = ''
+  OR email ILIKE '%' || sqlc.arg(search)::text || '%'
+  OR full_name ILIKE '%' || sqlc.arg(search)::text || '%'
+ORDER BY created_at DESC
+LIMIT sqlc.arg(limit)
+OFFSET sqlc.arg(offset);
+
+-- name: SuspendUser :execrows
+UPDATE users
+  set suspended_at = now()
+WHERE id = $1 AND suspended_at IS NULL;
+
+-- name: UnsuspendUser :execrows
+UPDATE users
+  set suspended_at = NULL
+WHERE id = $1 AND suspended_at IS NOT NULL;
+
+-- name: UpdateUserStorageQuota :exec
+UPDATE users
+  set storage_quota = $2
+WHERE id = $1;
+
+-- name: GetUserUsage :one
+SELECT
+  COUNT(*)::bigint AS file_count,
+  COALESCE(SUM(size::bigint), 0)::bigint AS used_bytes
+FROM files
+WHERE owner = $1;
+
+-- name: CreateAdminAuditLog :one
+INSERT INTO admin_audit_logs (
+  admin_id,
+  action,
+  target_user_id,
+  details,
+  client_ip
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: ListAdminAuditLogs :many
+SELECT * FROM admin_audit_logs
+ORDER BY created_at DESC
+LIMIT $1
+OFFSET $2;
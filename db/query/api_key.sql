@@ -0,0 +1,47 @@
+-- name: CreateApiKey :one
+INSERT INTO api_keys (
+  user_id,
+  name,
+  prefix,
+  key_hash,
+  scopes,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: GetApiKeyByHash :one
+SELECT * FROM api_keys
+WHERE key_hash = $1 AND NOT EXISTS (
+  SELECT 1 FROM users
+  WHERE users.id = api_keys.user_id AND users.suspended_at IS NOT NULL
+)
+LIMIT 1;
+
+-- name: GetApiKey :one
+SELECT * FROM api_keys
+WHERE id = $1 AND NOT EXISTS (
+  SELECT 1 FROM users
+  WHERE users.id = api_keys.user_id AND users.suspended_at IS NOT NULL
+)
+LIMIT 1;
+
+-- name: ListApiKeys :many
+SELECT * FROM api_keys
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteApiKey :execrows
+DELETE FROM api_keys
+WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteUserApiKeys :exec
+DELETE FROM api_keys
+WHERE user_id = $1;
+
+-- name: UpdateApiKeysLastUsed :exec
+UPDATE api_keys
+  set last_used_at = used.last_used_at
+FROM unnest(sqlc.arg(ids)::uuid[], sqlc.arg(last_used_ats)::timestamptz[]) AS used(id, last_used_at)
+WHERE api_keys.id = used.id;
@@ -0,0 +1,48 @@
+-- name: CreateBlob :one
+INSERT INTO blobs (
+  sha1,
+  sha256,
+  size,
+  file_id,
+  bucket_id,
+  file_name,
+  content_type,
+  wrapped_key,
+  encryption_header,
+  ref_count
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, 1
+)
+ON CONFLICT (sha256, size) WHERE encryption_header IS NOT NULL DO UPDATE
+  set ref_count = blobs.ref_count + 1
+RETURNING *;
+
+-- name: GetBlob :one
+SELECT * FROM blobs
+WHERE id = $1 LIMIT 1;
+
+-- name: AcquireBlob :one
+UPDATE blobs
+  set ref_count = ref_count + 1
+WHERE sha256 = $1 AND size = $2 AND encryption_header IS NOT NULL
+RETURNING *;
+
+-- name: ReleaseBlob :one
+UPDATE blobs
+  set ref_count = ref_count - 1
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteUnreferencedBlob :one
+DELETE FROM blobs
+WHERE id = $1 AND ref_count <= 0
+RETURNING *;
+
+-- name: ListBlobKeys :many
+SELECT id, wrapped_key FROM blobs
+WHERE wrapped_key IS NOT NULL;
+
+-- name: UpdateBlobKey :exec
+UPDATE blobs
+  set wrapped_key = $2
+WHERE id = $1;
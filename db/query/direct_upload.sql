@@ -0,0 +1,33 @@
+-- name: CreateDirectUpload :one
+INSERT INTO direct_uploads (
+  owner,
+  file_name,
+  name,
+  size,
+  sha1,
+  e2e,
+  encrypted_name,
+  chunk_size,
+  key_hint,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
+)
+RETURNING *;
+
+-- name: GetDirectUpload :one
+SELECT * FROM direct_uploads
+WHERE id = $1 LIMIT 1;
+
+-- name: ClaimDirectUpload :one
+DELETE FROM direct_uploads
+WHERE id = $1
+RETURNING *;
+
+-- name: ListExpiredDirectUploads :many
+SELECT * FROM direct_uploads
+WHERE expires_at < now();
+
+-- name: DeleteDirectUpload :exec
+DELETE FROM direct_uploads
+WHERE id = $1;
@@ -5,9 +5,15 @@ INSERT INTO files (
   owner,
   name,
   size,
-  file_type
+  file_type,
+  blob_id,
+  wrapped_key,
+  e2e,
+  encrypted_name,
+  chunk_size,
+  key_hint
 ) VALUES (
-  $1, $2, $3, $4, $5, $6
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
 )
 RETURNING *;
 
@@ -15,6 +21,12 @@ RETURNING *;
 SELECT * FROM files
 WHERE id = $1 LIMIT 1;
 
+-- name: GetFileByFileId :one
+SELECT * FROM files
+WHERE owner = $1 AND file_id = $2
+ORDER BY created_at
+LIMIT 1;
+
 -- name: ListFiles :many
 SELECT * FROM files
 WHERE owner = $1
@@ -30,4 +42,18 @@ RETURNING *;
 
 -- name: DeleteFile :exec
 DELETE FROM files
-WHERE file_id = $1;
+WHERE id = $1;
+
+-- name: DeleteFilesByOwner :many
+DELETE FROM files
+WHERE owner = $1
+RETURNING *;
+
+-- name: ListFileKeys :many
+SELECT id, wrapped_key FROM files
+WHERE owner = $1 AND wrapped_key IS NOT NULL;
+
+-- name: UpdateFileKey :exec
+UPDATE files
+  set wrapped_key = $2
+WHERE id = $1;
@@ -0,0 +1,53 @@
+-- name: CreateLoginAttempt :exec
+INSERT INTO login_attempts (
+  user_id,
+  client_ip,
+  user_agent,
+  success
+) VALUES (
+  $1, $2, $3, $4
+);
+
+-- name: ListLoginAttempts :many
+SELECT * FROM login_attempts
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: DeleteOldLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE created_at < $1;
+
+-- name: ListLoginThrottles :many
+SELECT * FROM login_throttles
+WHERE key = ANY(sqlc.arg(keys)::varchar[]);
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_throttles (
+  key,
+  failures,
+  last_failure_at
+) VALUES (
+  sqlc.arg(key), 1, now()
+)
+ON CONFLICT (key) DO UPDATE
+  set failures = CASE
+    WHEN login_throttles.last_failure_at < sqlc.arg(reset_before) THEN 1
+    ELSE login_throttles.failures + 1
+  END,
+  last_failure_at = now()
+RETURNING *;
+
+-- name: LockLoginThrottle :exec
+UPDATE login_throttles
+  set locked_until = $2
+WHERE key = $1;
+
+-- name: ResetLoginThrottle :exec
+DELETE FROM login_throttles
+WHERE key = $1;
+
+-- name: DeleteStaleLoginThrottles :exec
+DELETE FROM login_throttles
+WHERE last_failure_at < $1
+AND (locked_until IS NULL OR locked_until < now());
@@ -0,0 +1,24 @@
+-- name: CreateMagicLink :one
+INSERT INTO magic_links (
+  email,
+  token_hash,
+  expires_at
+) VALUES (
+  $1, $2, $3
+)
+RETURNING *;
+
+-- name: UseMagicLink :one
+UPDATE magic_links
+  set used_at = now()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+RETURNING *;
+
+-- name: InvalidateMagicLinks :exec
+UPDATE magic_links
+  set used_at = now()
+WHERE email = $1 AND used_at IS NULL;
+
+-- name: DeleteExpiredMagicLinks :exec
+DELETE FROM magic_links
+WHERE expires_at < now();
@@ -0,0 +1,39 @@
+-- name: CreateOidcLogin :one
+INSERT INTO oidc_logins (
+  state,
+  provider,
+  nonce,
+  code_verifier,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: ClaimOidcLogin :one
+DELETE FROM oidc_logins
+WHERE state = $1
+RETURNING *;
+
+-- name: DeleteExpiredOidcLogins :exec
+DELETE FROM oidc_logins
+WHERE expires_at < now();
+
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (
+  user_id,
+  provider,
+  subject,
+  email
+) VALUES (
+  $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities
+WHERE provider = $1 AND subject = $2 LIMIT 1;
+
+-- name: DeleteUserIdentities :exec
+DELETE FROM user_identities
+WHERE user_id = $1;
@@ -0,0 +1,25 @@
+-- name: CreatePasswordReset :one
+INSERT INTO password_resets (
+  user_id,
+  token_hash,
+  expires_at
+) VALUES (
+  $1, $2, $3
+)
+RETURNING *;
+
+-- name: GetPasswordReset :one
+SELECT * FROM password_resets
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+LIMIT 1;
+
+-- name: UsePasswordReset :one
+UPDATE password_resets
+  set used_at = now()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+RETURNING *;
+
+-- name: InvalidatePasswordResets :exec
+UPDATE password_resets
+  set used_at = now()
+WHERE user_id = $1 AND used_at IS NULL;
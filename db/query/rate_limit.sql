@@ -0,0 +1,27 @@
+-- name: TakeRateLimitToken :one
+INSERT INTO rate_limits AS bucket (
+  key,
+  tokens,
+  allowed,
+  updated_at
+) VALUES (
+  sqlc.arg(key), sqlc.arg(burst)::float8 - 1, true, now()
+)
+ON CONFLICT (key) DO UPDATE
+  set tokens = LEAST(
+    sqlc.arg(burst)::float8,
+    bucket.tokens + EXTRACT(EPOCH FROM now() - bucket.updated_at)::float8 * sqlc.arg(rate)::float8
+  ) - (LEAST(
+    sqlc.arg(burst)::float8,
+    bucket.tokens + EXTRACT(EPOCH FROM now() - bucket.updated_at)::float8 * sqlc.arg(rate)::float8
+  ) >= 1)::int,
+  allowed = LEAST(
+    sqlc.arg(burst)::float8,
+    bucket.tokens + EXTRACT(EPOCH FROM now() - bucket.updated_at)::float8 * sqlc.arg(rate)::float8
+  ) >= 1,
+  updated_at = now()
+RETURNING tokens, allowed;
+
+-- name: DeleteIdleRateLimits :exec
+DELETE FROM rate_limits
+WHERE updated_at < $1;
@@ -0,0 +1,15 @@
+-- name: CreateRecoveryCodes :exec
+INSERT INTO recovery_codes (
+  user_id,
+  code_hash
+)
+SELECT sqlc.arg(user_id), unnest(sqlc.arg(code_hashes)::bytea[]);
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+  set used_at = now()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
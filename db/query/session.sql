@@ -0,0 +1,52 @@
+-- name: CreateSession :one
+INSERT INTO sessions (
+  id,
+  user_id,
+  family_id,
+  refresh_token,
+  user_agent,
+  client_ip,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+)
+RETURNING *;
+
+-- name: GetSession :one
+SELECT * FROM sessions
+WHERE id = $1 LIMIT 1;
+
+-- name: RotateSession :execrows
+UPDATE sessions
+  set rotated_at = now()
+WHERE id = $1 AND rotated_at IS NULL AND is_blocked = false;
+
+-- name: BlockSessionFamily :exec
+UPDATE sessions
+  set is_blocked = true
+WHERE family_id = $1;
+
+-- name: BlockUserSessions :exec
+UPDATE sessions
+  set is_blocked = true
+WHERE user_id = $1 AND is_blocked = false;
+
+-- name: ListActiveSessions :many
+SELECT * FROM sessions
+WHERE user_id = $1
+  AND is_blocked = false
+  AND rotated_at IS NULL
+  AND expires_at > now()
+ORDER BY last_seen_at DESC;
+
+-- name: UpdateSessionsLastSeen :exec
+UPDATE sessions
+  set last_seen_at = seen.last_seen_at
+FROM unnest(sqlc.arg(family_ids)::uuid[], sqlc.arg(last_seen_ats)::timestamptz[]) AS seen(family_id, last_seen_at)
+WHERE sessions.family_id = seen.family_id
+  AND sessions.last_seen_at < seen.last_seen_at;
+
+-- name: BlockOtherUserSessions :exec
+UPDATE sessions
+  set is_blocked = true
+WHERE user_id = $1 AND family_id <> $2 AND is_blocked = false;
@@ -0,0 +1,45 @@
+-- name: CreateUpload :one
+INSERT INTO uploads (
+  owner,
+  length,
+  metadata,
+  file_name,
+  sha1_state,
+  sha256_state,
+  wrapped_key,
+  encryption_header,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9
+)
+RETURNING *;
+
+-- name: GetUpload :one
+SELECT * FROM uploads
+WHERE id = $1 LIMIT 1;
+
+-- name: UpdateUploadProgress :execrows
+UPDATE uploads
+  set upload_offset = sqlc.arg(upload_offset),
+  pending = sqlc.arg(pending),
+  sha1_state = sqlc.arg(sha1_state),
+  sha256_state = sqlc.arg(sha256_state),
+  large_file_id = sqlc.arg(large_file_id),
+  part_sha1s = sqlc.arg(part_sha1s)
+WHERE id = sqlc.arg(id) AND upload_offset = sqlc.arg(previous_offset);
+
+-- name: ListExpiredUploads :many
+SELECT * FROM uploads
+WHERE expires_at < now();
+
+-- name: DeleteUpload :exec
+DELETE FROM uploads
+WHERE id = $1;
+
+-- name: ListUploadKeys :many
+SELECT id, wrapped_key FROM uploads;
+
+-- name: UpdateUploadKey :exec
+UPDATE uploads
+  set wrapped_key = $2
+WHERE id = $1;
@@ -16,3 +16,85 @@ WHERE id = $1 LIMIT 1;
 SELECT * FROM users
 WHERE email = $1 LIMIT 1;
 
+-- name: InitUserKey :execrows
+UPDATE users
+  set wrapped_kek = $2
+WHERE id = $1 AND wrapped_kek IS NULL;
+
+-- name: UpdateUserKey :exec
+UPDATE users
+  set wrapped_kek = $2
+WHERE id = $1;
+
+-- name: ListUserKeys :many
+SELECT id, wrapped_kek FROM users
+WHERE wrapped_kek IS NOT NULL;
+
+-- name: VerifyUserEmail :execrows
+UPDATE users
+  set email_verified_at = now()
+WHERE id = $1 AND email = $2 AND email_verified_at IS NULL;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+  set hashed_password = $2
+WHERE id = $1;
+
+-- name: UpdateUserRole :exec
+UPDATE users
+  set role = $2
+WHERE id = $1;
+
+-- name: RehashUserPassword :execrows
+UPDATE users
+  set hashed_password = sqlc.arg(hashed_password)
+WHERE id = sqlc.arg(id) AND hashed_password = sqlc.arg(current_hashed_password);
+
+-- name: UpdateUserFullName :one
+UPDATE users
+  set full_name = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: UpdateUserEmail :one
+UPDATE users
+  set email = $2,
+  email_verified_at = NULL
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteUser :exec
+DELETE FROM users
+WHERE id = $1;
+
+-- name: SetUserTotpSecret :execrows
+UPDATE users
+  set totp_secret = $2,
+  totp_last_step = 0
+WHERE id = $1 AND totp_enabled_at IS NULL;
+
+-- name: EnableUserTotp :execrows
+UPDATE users
+  set totp_enabled_at = now()
+WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL;
+
+-- name: DisableUserTotp :exec
+UPDATE users
+  set totp_secret = NULL,
+  totp_enabled_at = NULL,
+  totp_last_step = 0
+WHERE id = $1;
+
+-- name: UseUserTotpStep :execrows
+UPDATE users
+  set totp_last_step = $2
+WHERE id = $1 AND totp_last_step < $2;
+
+-- name: ListUserTotpSecrets :many
+SELECT id, totp_secret FROM users
+WHERE totp_secret IS NOT NULL;
+
+-- name: UpdateUserTotpSecret :exec
+UPDATE users
+  set totp_secret = $2
+WHERE id = $1;
@@ -0,0 +1,61 @@
+-- name: CreateWebauthnCredential :one
+INSERT INTO webauthn_credentials (
+  user_id,
+  credential_id,
+  public_key,
+  attestation_type,
+  transports,
+  aaguid,
+  sign_count,
+  backup_eligible,
+  backup_state,
+  name
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
+)
+RETURNING *;
+
+-- name: ListWebauthnCredentials :many
+SELECT * FROM webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: GetWebauthnCredentialByCredentialID :one
+SELECT * FROM webauthn_credentials
+WHERE credential_id = $1 LIMIT 1;
+
+-- name: UseWebauthnCredential :execrows
+UPDATE webauthn_credentials
+  set sign_count = sqlc.arg(sign_count),
+  backup_state = sqlc.arg(backup_state),
+  last_used_at = now()
+WHERE id = sqlc.arg(id)
+  AND (sign_count < sqlc.arg(sign_count) OR (sign_count = 0 AND sqlc.arg(sign_count) = 0));
+
+-- name: DeleteWebauthnCredential :execrows
+DELETE FROM webauthn_credentials
+WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteUserWebauthnCredentials :exec
+DELETE FROM webauthn_credentials
+WHERE user_id = $1;
+
+-- name: CreateWebauthnChallenge :one
+INSERT INTO webauthn_challenges (
+  user_id,
+  ceremony,
+  session_data,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: ClaimWebauthnChallenge :one
+DELETE FROM webauthn_challenges
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteExpiredWebauthnChallenges :exec
+DELETE FROM webauthn_challenges
+WHERE expires_at < now();
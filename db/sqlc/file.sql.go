@@ -18,20 +18,32 @@ INSERT INTO files (
   owner,
   name,
   size,
-  file_type
+  file_type,
+  blob_id,
+  wrapped_key,
+  e2e,
+  encrypted_name,
+  chunk_size,
+  key_hint
 ) VALUES (
-  $1, $2, $3, $4, $5, $6
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
 )
-RETURNING id, file_id, bucket_id, owner, name, size, favourite, file_type, last_modified, created_at
+RETURNING id, file_id, bucket_id, owner, name, size, favourite, file_type, last_modified, created_at, blob_id, wrapped_key, e2e, encrypted_name, chunk_size, key_hint
 `
 
 type CreateFileParams struct {
-	FileID   string    `json:"file_id"`
-	BucketID string    `json:"bucket_id"`
-	Owner    uuid.UUID `json:"owner"`
-	Name     string    `json:"name"`
-	Size     string    `json:"size"`
-	FileType string    `json:"file_type"`
+	FileID        string    `json:"file_id"`
+	BucketID      string    `json:"bucket_id"`
+	Owner         uuid.UUID `json:"owner"`
+	Name          string    `json:"name"`
+	Size          string    `json:"size"`
+	FileType      string    `json:"file_type"`
+	BlobID        uuid.UUID `json:"blob_id"`
+	WrappedKey    []byte    `json:"wrapped_key"`
+	E2e           bool      `json:"e2e"`
+	EncryptedName string    `json:"encrypted_name"`
+	ChunkSize     int32     `json:"chunk_size"`
+	KeyHint       string    `json:"key_hint"`
 }
 
 func (q *Queries) CreateFile(ctx context.Context, arg CreateFileParams) (File, error) {
@@ -42,6 +54,12 @@ func (q *Queries) CreateFile(ctx context.Context, arg CreateFileParams) (File, e
 		arg.Name,
 		arg.Size,
 		arg.FileType,
+		arg.BlobID,
+		arg.WrappedKey,
+		arg.E2e,
+		arg.EncryptedName,
+		arg.ChunkSize,
+		arg.KeyHint,
 	)
 	var i File
 	err := row.Scan(
@@ -55,22 +73,71 @@ func (q *Queries) CreateFile(ctx context.Context, arg CreateFileParams) (File, e
 		&i.FileType,
 		&i.LastModified,
 		&i.CreatedAt,
+		&i.BlobID,
+		&i.WrappedKey,
+		&i.E2e,
+		&i.EncryptedName,
+		&i.ChunkSize,
+		&i.KeyHint,
 	)
 	return i, err
 }
 
 const deleteFile = `-- name: DeleteFile :exec
 DELETE FROM files
-WHERE file_id = $1
+WHERE id = $1
 `
 
-func (q *Queries) DeleteFile(ctx context.Context, fileID string) error {
-	_, err := q.db.Exec(ctx, deleteFile, fileID)
+func (q *Queries) DeleteFile(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteFile, id)
 	return err
 }
 
+const deleteFilesByOwner = `-- name: DeleteFilesByOwner :many
+DELETE FROM files
+WHERE owner = $1
+RETURNING id, file_id, bucket_id, owner, name, size, favourite, file_type, last_modified, created_at, blob_id, wrapped_key, e2e, encrypted_name, chunk_size, key_hint
+`
+
+func (q *Queries) DeleteFilesByOwner(ctx context.Context, owner uuid.UUID) ([]File, error) {
+	rows, err := q.db.Query(ctx, deleteFilesByOwner, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []File{}
+	for rows.Next() {
+		var i File
+		if err := rows.Scan(
+			&i.ID,
+			&i.FileID,
+			&i.BucketID,
+			&i.Owner,
+			&i.Name,
+			&i.Size,
+			&i.Favourite,
+			&i.FileType,
+			&i.LastModified,
+			&i.CreatedAt,
+			&i.BlobID,
+			&i.WrappedKey,
+			&i.E2e,
+			&i.EncryptedName,
+			&i.ChunkSize,
+			&i.KeyHint,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getFile = `-- name: GetFile :one
-SELECT id, file_id, bucket_id, owner, name, size, favourite, file_type, last_modified, created_at FROM files
+SELECT id, file_id, bucket_id, owner, name, size, favourite, file_type, last_modified, created_at, blob_id, wrapped_key, e2e, encrypted_name, chunk_size, key_hint FROM files
 WHERE id = $1 LIMIT 1
 `
 
@@ -88,12 +155,87 @@ func (q *Queries) GetFile(ctx context.Context, id uuid.UUID) (File, error) {
 		&i.FileType,
 		&i.LastModified,
 		&i.CreatedAt,
+		&i.BlobID,
+		&i.WrappedKey,
+		&i.E2e,
+		&i.EncryptedName,
+		&i.ChunkSize,
+		&i.KeyHint,
+	)
+	return i, err
+}
+
+const getFileByFileId = `-- name: GetFileByFileId :one
+SELECT id, file_id, bucket_id, owner, name, size, favourite, file_type, last_modified, created_at, blob_id, wrapped_key, e2e, encrypted_name, chunk_size, key_hint FROM files
+WHERE owner = $1 AND file_id = $2
+ORDER BY created_at
+LIMIT 1
+`
+
+type GetFileByFileIdParams struct {
+	Owner  uuid.UUID `json:"owner"`
+	FileID string    `json:"file_id"`
+}
+
+func (q *Queries) GetFileByFileId(ctx context.Context, arg GetFileByFileIdParams) (File, error) {
+	row := q.db.QueryRow(ctx, getFileByFileId, arg.Owner, arg.FileID)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.FileID,
+		&i.BucketID,
+		&i.Owner,
+		&i.Name,
+		&i.Size,
+		&i.Favourite,
+		&i.FileType,
+		&i.LastModified,
+		&i.CreatedAt,
+		&i.BlobID,
+		&i.WrappedKey,
+		&i.E2e,
+		&i.EncryptedName,
+		&i.ChunkSize,
+		&i.KeyHint,
 	)
 	return i, err
 }
 
+const listFileKeys = `-- name: ListFileKeys :many
+SELECT id, wrapped_key FROM files
+WHERE owner = $1 AND wrapped_key IS NOT NULL
+`
+
+type ListFileKeysRow struct {
+	ID         uuid.UUID `json:"id"`
+	WrappedKey []byte    `json:"wrapped_key"`
+}
+
+func (q *Queries) ListFileKeys(ctx context.Context, owner uuid.UUID) ([]ListFileKeysRow, error) {
+	rows, err := q.db.Query(ctx, listFileKeys, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListFileKeysRow{}
+	for rows.Next() {
+		var i ListFileKeysRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.WrappedKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listFiles = `-- name: ListFiles :many
-SELECT id, file_id, bucket_id, owner, name, size, favourite, file_type, last_modified, created_at FROM files
+SELECT id, file_id, bucket_id, owner, name, size, favourite, file_type, last_modified, created_at, blob_id, wrapped_key, e2e, encrypted_name, chunk_size, key_hint FROM files
 WHERE owner = $1
 ORDER BY created_at DESC
 LIMIT $2
@@ -126,6 +268,12 @@ func (q *Queries) ListFiles(ctx context.Context, arg ListFilesParams) ([]File, e
 			&i.FileType,
 			&i.LastModified,
 			&i.CreatedAt,
+			&i.BlobID,
+			&i.WrappedKey,
+			&i.E2e,
+			&i.EncryptedName,
+			&i.ChunkSize,
+			&i.KeyHint,
 		); err != nil {
 			return nil, err
 		}
@@ -141,7 +289,7 @@ const updateFile = `-- name: UpdateFile :one
 UPDATE files
   set name = $2
 WHERE id = $1
-RETURNING id, file_id, bucket_id, owner, name, size, favourite, file_type, last_modified, created_at
+RETURNING id, file_id, bucket_id, owner, name, size, favourite, file_type, last_modified, created_at, blob_id, wrapped_key, e2e, encrypted_name, chunk_size, key_hint
 `
 
 type UpdateFileParams struct {
@@ -163,6 +311,28 @@ func (q *Queries) UpdateFile(ctx context.Context, arg UpdateFileParams) (File, e
 		&i.FileType,
 		&i.LastModified,
 		&i.CreatedAt,
+		&i.BlobID,
+		&i.WrappedKey,
+		&i.E2e,
+		&i.EncryptedName,
+		&i.ChunkSize,
+		&i.KeyHint,
 	)
 	return i, err
 }
+
+const updateFileKey = `-- name: UpdateFileKey :exec
+UPDATE files
+  set wrapped_key = $2
+WHERE id = $1
+`
+
+type UpdateFileKeyParams struct {
+	ID         uuid.UUID `json:"id"`
+	WrappedKey []byte    `json:"wrapped_key"`
+}
+
+func (q *Queries) UpdateFileKey(ctx context.Context, arg UpdateFileKeyParams) error {
+	_, err := q.db.Exec(ctx, updateFileKey, arg.ID, arg.WrappedKey)
+	return err
+}
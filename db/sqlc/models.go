@@ -8,25 +8,216 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AdminAuditLog struct {
+	ID           uuid.UUID   `json:"id"`
+	AdminID      uuid.UUID   `json:"admin_id"`
+	Action       string      `json:"action"`
+	TargetUserID pgtype.UUID `json:"target_user_id"`
+	Details      []byte      `json:"details"`
+	ClientIp     string      `json:"client_ip"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+type ApiKey struct {
+	ID         uuid.UUID          `json:"id"`
+	UserID     uuid.UUID          `json:"user_id"`
+	Name       string             `json:"name"`
+	Prefix     string             `json:"prefix"`
+	KeyHash    []byte             `json:"key_hash"`
+	Scopes     []string           `json:"scopes"`
+	ExpiresAt  pgtype.Timestamptz `json:"expires_at"`
+	LastUsedAt pgtype.Timestamptz `json:"last_used_at"`
+	CreatedAt  time.Time          `json:"created_at"`
+}
+
+type Blob struct {
+	ID               uuid.UUID   `json:"id"`
+	Sha1             string      `json:"sha1"`
+	Size             int64       `json:"size"`
+	FileID           string      `json:"file_id"`
+	BucketID         string      `json:"bucket_id"`
+	FileName         string      `json:"file_name"`
+	ContentType      string      `json:"content_type"`
+	RefCount         int64       `json:"ref_count"`
+	CreatedAt        time.Time   `json:"created_at"`
+	WrappedKey       []byte      `json:"wrapped_key"`
+	EncryptionHeader []byte      `json:"encryption_header"`
+	Sha256           pgtype.Text `json:"sha256"`
+}
+
+type DirectUpload struct {
+	ID            uuid.UUID `json:"id"`
+	Owner         uuid.UUID `json:"owner"`
+	FileName      string    `json:"file_name"`
+	Name          string    `json:"name"`
+	Size          int64     `json:"size"`
+	Sha1          string    `json:"sha1"`
+	E2e           bool      `json:"e2e"`
+	EncryptedName string    `json:"encrypted_name"`
+	ChunkSize     int32     `json:"chunk_size"`
+	KeyHint       string    `json:"key_hint"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
 type File struct {
-	ID           uuid.UUID `json:"id"`
-	FileID       string    `json:"file_id"`
-	BucketID     string    `json:"bucket_id"`
-	Owner        uuid.UUID `json:"owner"`
-	Name         string    `json:"name"`
-	Size         string    `json:"size"`
-	Favourite    bool      `json:"favourite"`
-	FileType     string    `json:"file_type"`
-	LastModified string    `json:"last_modified"`
+	ID            uuid.UUID `json:"id"`
+	FileID        string    `json:"file_id"`
+	BucketID      string    `json:"bucket_id"`
+	Owner         uuid.UUID `json:"owner"`
+	Name          string    `json:"name"`
+	Size          string    `json:"size"`
+	Favourite     bool      `json:"favourite"`
+	FileType      string    `json:"file_type"`
+	LastModified  string    `json:"last_modified"`
+	CreatedAt     time.Time `json:"created_at"`
+	BlobID        uuid.UUID `json:"blob_id"`
+	WrappedKey    []byte    `json:"wrapped_key"`
+	E2e           bool      `json:"e2e"`
+	EncryptedName string    `json:"encrypted_name"`
+	ChunkSize     int32     `json:"chunk_size"`
+	KeyHint       string    `json:"key_hint"`
+}
+
+type LoginAttempt struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	ClientIp  string    `json:"client_ip"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type LoginThrottle struct {
+	Key           string             `json:"key"`
+	Failures      int32              `json:"failures"`
+	LockedUntil   pgtype.Timestamptz `json:"locked_until"`
+	LastFailureAt time.Time          `json:"last_failure_at"`
+}
+
+type MagicLink struct {
+	ID        uuid.UUID          `json:"id"`
+	Email     string             `json:"email"`
+	TokenHash []byte             `json:"token_hash"`
+	ExpiresAt time.Time          `json:"expires_at"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+type OidcLogin struct {
+	State        string    `json:"state"`
+	Provider     string    `json:"provider"`
+	Nonce        string    `json:"nonce"`
+	CodeVerifier string    `json:"code_verifier"`
+	ExpiresAt    time.Time `json:"expires_at"`
 	CreatedAt    time.Time `json:"created_at"`
 }
 
+type PasswordReset struct {
+	ID        uuid.UUID          `json:"id"`
+	UserID    uuid.UUID          `json:"user_id"`
+	TokenHash []byte             `json:"token_hash"`
+	ExpiresAt time.Time          `json:"expires_at"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+type RateLimit struct {
+	Key       string    `json:"key"`
+	Tokens    float64   `json:"tokens"`
+	Allowed   bool      `json:"allowed"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID          `json:"id"`
+	UserID    uuid.UUID          `json:"user_id"`
+	CodeHash  []byte             `json:"code_hash"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+type Session struct {
+	ID           uuid.UUID          `json:"id"`
+	UserID       uuid.UUID          `json:"user_id"`
+	FamilyID     uuid.UUID          `json:"family_id"`
+	RefreshToken string             `json:"refresh_token"`
+	UserAgent    string             `json:"user_agent"`
+	ClientIp     string             `json:"client_ip"`
+	IsBlocked    bool               `json:"is_blocked"`
+	RotatedAt    pgtype.Timestamptz `json:"rotated_at"`
+	ExpiresAt    time.Time          `json:"expires_at"`
+	CreatedAt    time.Time          `json:"created_at"`
+	LastSeenAt   time.Time          `json:"last_seen_at"`
+}
+
+type Upload struct {
+	ID               uuid.UUID `json:"id"`
+	Owner            uuid.UUID `json:"owner"`
+	Length           int64     `json:"length"`
+	UploadOffset     int64     `json:"upload_offset"`
+	Metadata         string    `json:"metadata"`
+	FileName         string    `json:"file_name"`
+	LargeFileID      string    `json:"large_file_id"`
+	PartSha1s        []string  `json:"part_sha1s"`
+	Pending          []byte    `json:"pending"`
+	Sha1State        []byte    `json:"sha1_state"`
+	WrappedKey       []byte    `json:"wrapped_key"`
+	EncryptionHeader []byte    `json:"encryption_header"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	CreatedAt        time.Time `json:"created_at"`
+	Sha256State      []byte    `json:"sha256_state"`
+}
+
 type User struct {
-	ID             uuid.UUID `json:"id"`
-	HashedPassword string    `json:"hashed_password"`
-	FullName       string    `json:"full_name"`
-	Email          string    `json:"email"`
-	CreatedAt      time.Time `json:"created_at"`
+	ID              uuid.UUID          `json:"id"`
+	HashedPassword  string             `json:"hashed_password"`
+	FullName        string             `json:"full_name"`
+	Email           string             `json:"email"`
+	CreatedAt       time.Time          `json:"created_at"`
+	WrappedKek      []byte             `json:"wrapped_kek"`
+	EmailVerifiedAt pgtype.Timestamptz `json:"email_verified_at"`
+	TotpSecret      []byte             `json:"totp_secret"`
+	TotpEnabledAt   pgtype.Timestamptz `json:"totp_enabled_at"`
+	TotpLastStep    int64              `json:"totp_last_step"`
+	Role            string             `json:"role"`
+	SuspendedAt     pgtype.Timestamptz `json:"suspended_at"`
+	StorageQuota    pgtype.Int8        `json:"storage_quota"`
+}
+
+type UserIdentitie struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebauthnChallenge struct {
+	ID          uuid.UUID `json:"id"`
+	UserID      uuid.UUID `json:"user_id"`
+	Ceremony    string    `json:"ceremony"`
+	SessionData []byte    `json:"session_data"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type WebauthnCredential struct {
+	ID              uuid.UUID          `json:"id"`
+	UserID          uuid.UUID          `json:"user_id"`
+	CredentialID    []byte             `json:"credential_id"`
+	PublicKey       []byte             `json:"public_key"`
+	AttestationType string             `json:"attestation_type"`
+	Transports      []string           `json:"transports"`
+	Aaguid          []byte             `json:"aaguid"`
+	SignCount       int64              `json:"sign_count"`
+	BackupEligible  bool               `json:"backup_eligible"`
+	BackupState     bool               `json:"backup_state"`
+	Name            string             `json:"name"`
+	LastUsedAt      pgtype.Timestamptz `json:"last_used_at"`
+	CreatedAt       time.Time          `json:"created_at"`
 }
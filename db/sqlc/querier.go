@@ -6,19 +6,117 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type Querier interface {
+	AcquireBlob(ctx context.Context, arg AcquireBlobParams) (Blob, error)
+	BlockOtherUserSessions(ctx context.Context, arg BlockOtherUserSessionsParams) error
+	BlockSessionFamily(ctx context.Context, familyID uuid.UUID) error
+	BlockUserSessions(ctx context.Context, userID uuid.UUID) error
+	ClaimDirectUpload(ctx context.Context, id uuid.UUID) (DirectUpload, error)
+	ClaimOidcLogin(ctx context.Context, state string) (OidcLogin, error)
+	ClaimWebauthnChallenge(ctx context.Context, id uuid.UUID) (WebauthnChallenge, error)
+	CreateAdminAuditLog(ctx context.Context, arg CreateAdminAuditLogParams) (AdminAuditLog, error)
+	CreateApiKey(ctx context.Context, arg CreateApiKeyParams) (ApiKey, error)
+	CreateBlob(ctx context.Context, arg CreateBlobParams) (Blob, error)
+	CreateDirectUpload(ctx context.Context, arg CreateDirectUploadParams) (DirectUpload, error)
 	CreateFile(ctx context.Context, arg CreateFileParams) (File, error)
+	CreateLoginAttempt(ctx context.Context, arg CreateLoginAttemptParams) error
+	CreateMagicLink(ctx context.Context, arg CreateMagicLinkParams) (MagicLink, error)
+	CreateOidcLogin(ctx context.Context, arg CreateOidcLoginParams) (OidcLogin, error)
+	CreatePasswordReset(ctx context.Context, arg CreatePasswordResetParams) (PasswordReset, error)
+	CreateRecoveryCodes(ctx context.Context, arg CreateRecoveryCodesParams) error
+	CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error)
+	CreateUpload(ctx context.Context, arg CreateUploadParams) (Upload, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
-	DeleteFile(ctx context.Context, fileID string) error
+	CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) (UserIdentitie, error)
+	CreateWebauthnChallenge(ctx context.Context, arg CreateWebauthnChallengeParams) (WebauthnChallenge, error)
+	CreateWebauthnCredential(ctx context.Context, arg CreateWebauthnCredentialParams) (WebauthnCredential, error)
+	DeleteApiKey(ctx context.Context, arg DeleteApiKeyParams) (int64, error)
+	DeleteDirectUpload(ctx context.Context, id uuid.UUID) error
+	DeleteExpiredMagicLinks(ctx context.Context) error
+	DeleteExpiredOidcLogins(ctx context.Context) error
+	DeleteExpiredWebauthnChallenges(ctx context.Context) error
+	DeleteFile(ctx context.Context, id uuid.UUID) error
+	DeleteFilesByOwner(ctx context.Context, owner uuid.UUID) ([]File, error)
+	DeleteIdleRateLimits(ctx context.Context, updatedAt time.Time) error
+	DeleteOldLoginAttempts(ctx context.Context, createdAt time.Time) error
+	DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error
+	DeleteStaleLoginThrottles(ctx context.Context, lastFailureAt time.Time) error
+	DeleteUnreferencedBlob(ctx context.Context, id uuid.UUID) (Blob, error)
+	DeleteUpload(ctx context.Context, id uuid.UUID) error
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+	DeleteUserApiKeys(ctx context.Context, userID uuid.UUID) error
+	DeleteUserIdentities(ctx context.Context, userID uuid.UUID) error
+	DeleteUserWebauthnCredentials(ctx context.Context, userID uuid.UUID) error
+	DeleteWebauthnCredential(ctx context.Context, arg DeleteWebauthnCredentialParams) (int64, error)
+	DisableUserTotp(ctx context.Context, id uuid.UUID) error
+	EnableUserTotp(ctx context.Context, id uuid.UUID) (int64, error)
+	GetApiKey(ctx context.Context, id uuid.UUID) (ApiKey, error)
+	GetApiKeyByHash(ctx context.Context, keyHash []byte) (ApiKey, error)
+	GetBlob(ctx context.Context, id uuid.UUID) (Blob, error)
+	GetDirectUpload(ctx context.Context, id uuid.UUID) (DirectUpload, error)
 	GetFile(ctx context.Context, id uuid.UUID) (File, error)
+	GetFileByFileId(ctx context.Context, arg GetFileByFileIdParams) (File, error)
+	GetPasswordReset(ctx context.Context, tokenHash []byte) (PasswordReset, error)
+	GetSession(ctx context.Context, id uuid.UUID) (Session, error)
+	GetUpload(ctx context.Context, id uuid.UUID) (Upload, error)
 	GetUser(ctx context.Context, id uuid.UUID) (User, error)
 	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (UserIdentitie, error)
+	GetUserUsage(ctx context.Context, owner uuid.UUID) (GetUserUsageRow, error)
+	GetWebauthnCredentialByCredentialID(ctx context.Context, credentialID []byte) (WebauthnCredential, error)
+	InitUserKey(ctx context.Context, arg InitUserKeyParams) (int64, error)
+	InvalidateMagicLinks(ctx context.Context, email string) error
+	InvalidatePasswordResets(ctx context.Context, userID uuid.UUID) error
+	ListActiveSessions(ctx context.Context, userID uuid.UUID) ([]Session, error)
+	ListAdminAuditLogs(ctx context.Context, arg ListAdminAuditLogsParams) ([]AdminAuditLog, error)
+	ListApiKeys(ctx context.Context, userID uuid.UUID) ([]ApiKey, error)
+	ListBlobKeys(ctx context.Context) ([]ListBlobKeysRow, error)
+	ListExpiredDirectUploads(ctx context.Context) ([]DirectUpload, error)
+	ListExpiredUploads(ctx context.Context) ([]Upload, error)
+	ListFileKeys(ctx context.Context, owner uuid.UUID) ([]ListFileKeysRow, error)
 	ListFiles(ctx context.Context, arg ListFilesParams) ([]File, error)
+	ListLoginAttempts(ctx context.Context, arg ListLoginAttemptsParams) ([]LoginAttempt, error)
+	ListLoginThrottles(ctx context.Context, keys []string) ([]LoginThrottle, error)
+	ListUploadKeys(ctx context.Context) ([]ListUploadKeysRow, error)
+	ListUserKeys(ctx context.Context) ([]ListUserKeysRow, error)
+	ListUserTotpSecrets(ctx context.Context) ([]ListUserTotpSecretsRow, error)
+	ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error)
+	ListWebauthnCredentials(ctx context.Context, userID uuid.UUID) ([]WebauthnCredential, error)
+	LockLoginThrottle(ctx context.Context, arg LockLoginThrottleParams) error
+	RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (LoginThrottle, error)
+	RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) (int64, error)
+	ReleaseBlob(ctx context.Context, id uuid.UUID) (Blob, error)
+	ResetLoginThrottle(ctx context.Context, key string) error
+	RotateSession(ctx context.Context, id uuid.UUID) (int64, error)
+	SetUserTotpSecret(ctx context.Context, arg SetUserTotpSecretParams) (int64, error)
+	SuspendUser(ctx context.Context, id uuid.UUID) (int64, error)
+	TakeRateLimitToken(ctx context.Context, arg TakeRateLimitTokenParams) (TakeRateLimitTokenRow, error)
+	UnsuspendUser(ctx context.Context, id uuid.UUID) (int64, error)
+	UpdateApiKeysLastUsed(ctx context.Context, arg UpdateApiKeysLastUsedParams) error
+	UpdateBlobKey(ctx context.Context, arg UpdateBlobKeyParams) error
 	UpdateFile(ctx context.Context, arg UpdateFileParams) (File, error)
+	UpdateFileKey(ctx context.Context, arg UpdateFileKeyParams) error
+	UpdateSessionsLastSeen(ctx context.Context, arg UpdateSessionsLastSeenParams) error
+	UpdateUploadKey(ctx context.Context, arg UpdateUploadKeyParams) error
+	UpdateUploadProgress(ctx context.Context, arg UpdateUploadProgressParams) (int64, error)
+	UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) (User, error)
+	UpdateUserFullName(ctx context.Context, arg UpdateUserFullNameParams) (User, error)
+	UpdateUserKey(ctx context.Context, arg UpdateUserKeyParams) error
+	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error
+	UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) error
+	UpdateUserStorageQuota(ctx context.Context, arg UpdateUserStorageQuotaParams) error
+	UpdateUserTotpSecret(ctx context.Context, arg UpdateUserTotpSecretParams) error
+	UseMagicLink(ctx context.Context, tokenHash []byte) (MagicLink, error)
+	UsePasswordReset(ctx context.Context, tokenHash []byte) (PasswordReset, error)
+	UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error)
+	UseUserTotpStep(ctx context.Context, arg UseUserTotpStepParams) (int64, error)
+	UseWebauthnCredential(ctx context.Context, arg UseWebauthnCredentialParams) (int64, error)
+	VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (int64, error)
 }
 
 var _ Querier = (*Queries)(nil)
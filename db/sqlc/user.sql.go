@@ -19,7 +19,7 @@ INSERT INTO users (
 ) VALUES (
   $1, $2, $3
 )
-RETURNING id, hashed_password, full_name, email, created_at
+RETURNING id, hashed_password, full_name, email, created_at, wrapped_kek, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role, suspended_at, storage_quota
 `
 
 type CreateUserParams struct {
@@ -37,12 +37,57 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.FullName,
 		&i.Email,
 		&i.CreatedAt,
+		&i.WrappedKek,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.StorageQuota,
 	)
 	return i, err
 }
 
+const deleteUser = `-- name: DeleteUser :exec
+DELETE FROM users
+WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteUser, id)
+	return err
+}
+
+const disableUserTotp = `-- name: DisableUserTotp :exec
+UPDATE users
+  set totp_secret = NULL,
+  totp_enabled_at = NULL,
+  totp_last_step = 0
+WHERE id = $1
+`
+
+func (q *Queries) DisableUserTotp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, disableUserTotp, id)
+	return err
+}
+
+const enableUserTotp = `-- name: EnableUserTotp :execrows
+UPDATE users
+  set totp_enabled_at = now()
+WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL
+`
+
+func (q *Queries) EnableUserTotp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, enableUserTotp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const getUser = `-- name: GetUser :one
-SELECT id, hashed_password, full_name, email, created_at FROM users
+SELECT id, hashed_password, full_name, email, created_at, wrapped_kek, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role, suspended_at, storage_quota FROM users
 WHERE id = $1 LIMIT 1
 `
 
@@ -55,12 +100,20 @@ func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.FullName,
 		&i.Email,
 		&i.CreatedAt,
+		&i.WrappedKek,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.StorageQuota,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, hashed_password, full_name, email, created_at FROM users
+SELECT id, hashed_password, full_name, email, created_at, wrapped_kek, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role, suspended_at, storage_quota FROM users
 WHERE email = $1 LIMIT 1
 `
 
@@ -73,6 +126,308 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.FullName,
 		&i.Email,
 		&i.CreatedAt,
+		&i.WrappedKek,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.StorageQuota,
+	)
+	return i, err
+}
+
+const initUserKey = `-- name: InitUserKey :execrows
+UPDATE users
+  set wrapped_kek = $2
+WHERE id = $1 AND wrapped_kek IS NULL
+`
+
+type InitUserKeyParams struct {
+	ID         uuid.UUID `json:"id"`
+	WrappedKek []byte    `json:"wrapped_kek"`
+}
+
+func (q *Queries) InitUserKey(ctx context.Context, arg InitUserKeyParams) (int64, error) {
+	result, err := q.db.Exec(ctx, initUserKey, arg.ID, arg.WrappedKek)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const listUserKeys = `-- name: ListUserKeys :many
+SELECT id, wrapped_kek FROM users
+WHERE wrapped_kek IS NOT NULL
+`
+
+type ListUserKeysRow struct {
+	ID         uuid.UUID `json:"id"`
+	WrappedKek []byte    `json:"wrapped_kek"`
+}
+
+func (q *Queries) ListUserKeys(ctx context.Context) ([]ListUserKeysRow, error) {
+	rows, err := q.db.Query(ctx, listUserKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListUserKeysRow{}
+	for rows.Next() {
+		var i ListUserKeysRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.WrappedKek,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserTotpSecrets = `-- name: ListUserTotpSecrets :many
+SELECT id, totp_secret FROM users
+WHERE totp_secret IS NOT NULL
+`
+
+type ListUserTotpSecretsRow struct {
+	ID         uuid.UUID `json:"id"`
+	TotpSecret []byte    `json:"totp_secret"`
+}
+
+func (q *Queries) ListUserTotpSecrets(ctx context.Context) ([]ListUserTotpSecretsRow, error) {
+	rows, err := q.db.Query(ctx, listUserTotpSecrets)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListUserTotpSecretsRow{}
+	for rows.Next() {
+		var i ListUserTotpSecretsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.TotpSecret,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const rehashUserPassword = `-- name: RehashUserPassword :execrows
+UPDATE users
+  set hashed_password = $1
+WHERE id = $2 AND hashed_password = $3
+`
+
+type RehashUserPasswordParams struct {
+	HashedPassword        string    `json:"hashed_password"`
+	ID                    uuid.UUID `json:"id"`
+	CurrentHashedPassword string    `json:"current_hashed_password"`
+}
+
+func (q *Queries) RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) (int64, error) {
+	result, err := q.db.Exec(ctx, rehashUserPassword, arg.HashedPassword, arg.ID, arg.CurrentHashedPassword)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const setUserTotpSecret = `-- name: SetUserTotpSecret :execrows
+UPDATE users
+  set totp_secret = $2,
+  totp_last_step = 0
+WHERE id = $1 AND totp_enabled_at IS NULL
+`
+
+type SetUserTotpSecretParams struct {
+	ID         uuid.UUID `json:"id"`
+	TotpSecret []byte    `json:"totp_secret"`
+}
+
+func (q *Queries) SetUserTotpSecret(ctx context.Context, arg SetUserTotpSecretParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setUserTotpSecret, arg.ID, arg.TotpSecret)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateUserEmail = `-- name: UpdateUserEmail :one
+UPDATE users
+  set email = $2,
+  email_verified_at = NULL
+WHERE id = $1
+RETURNING id, hashed_password, full_name, email, created_at, wrapped_kek, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role, suspended_at, storage_quota
+`
+
+type UpdateUserEmailParams struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+}
+
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserEmail, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.CreatedAt,
+		&i.WrappedKek,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.StorageQuota,
 	)
 	return i, err
 }
+
+const updateUserFullName = `-- name: UpdateUserFullName :one
+UPDATE users
+  set full_name = $2
+WHERE id = $1
+RETURNING id, hashed_password, full_name, email, created_at, wrapped_kek, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role, suspended_at, storage_quota
+`
+
+type UpdateUserFullNameParams struct {
+	ID       uuid.UUID `json:"id"`
+	FullName string    `json:"full_name"`
+}
+
+func (q *Queries) UpdateUserFullName(ctx context.Context, arg UpdateUserFullNameParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserFullName, arg.ID, arg.FullName)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.CreatedAt,
+		&i.WrappedKek,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.StorageQuota,
+	)
+	return i, err
+}
+
+const updateUserKey = `-- name: UpdateUserKey :exec
+UPDATE users
+  set wrapped_kek = $2
+WHERE id = $1
+`
+
+type UpdateUserKeyParams struct {
+	ID         uuid.UUID `json:"id"`
+	WrappedKek []byte    `json:"wrapped_kek"`
+}
+
+func (q *Queries) UpdateUserKey(ctx context.Context, arg UpdateUserKeyParams) error {
+	_, err := q.db.Exec(ctx, updateUserKey, arg.ID, arg.WrappedKek)
+	return err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+  set hashed_password = $2
+WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID             uuid.UUID `json:"id"`
+	HashedPassword string    `json:"hashed_password"`
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.Exec(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :exec
+UPDATE users
+  set role = $2
+WHERE id = $1
+`
+
+type UpdateUserRoleParams struct {
+	ID   uuid.UUID `json:"id"`
+	Role string    `json:"role"`
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) error {
+	_, err := q.db.Exec(ctx, updateUserRole, arg.ID, arg.Role)
+	return err
+}
+
+const updateUserTotpSecret = `-- name: UpdateUserTotpSecret :exec
+UPDATE users
+  set totp_secret = $2
+WHERE id = $1
+`
+
+type UpdateUserTotpSecretParams struct {
+	ID         uuid.UUID `json:"id"`
+	TotpSecret []byte    `json:"totp_secret"`
+}
+
+func (q *Queries) UpdateUserTotpSecret(ctx context.Context, arg UpdateUserTotpSecretParams) error {
+	_, err := q.db.Exec(ctx, updateUserTotpSecret, arg.ID, arg.TotpSecret)
+	return err
+}
+
+const useUserTotpStep = `-- name: UseUserTotpStep :execrows
+UPDATE users
+  set totp_last_step = $2
+WHERE id = $1 AND totp_last_step < $2
+`
+
+type UseUserTotpStepParams struct {
+	ID           uuid.UUID `json:"id"`
+	TotpLastStep int64     `json:"totp_last_step"`
+}
+
+func (q *Queries) UseUserTotpStep(ctx context.Context, arg UseUserTotpStepParams) (int64, error) {
+	result, err := q.db.Exec(ctx, useUserTotpStep, arg.ID, arg.TotpLastStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :execrows
+UPDATE users
+  set email_verified_at = now()
+WHERE id = $1 AND email = $2 AND email_verified_at IS NULL
+`
+
+type VerifyUserEmailParams struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (int64, error) {
+	result, err := q.db.Exec(ctx, verifyUserEmail, arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
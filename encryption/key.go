@@ -0,0 +1,53 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/aead/chacha20poly1305"
+)
+
+// NewKey returns a random key suitable for both data and key-encryption keys.
+func NewKey() ([]byte, error) {
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// WrapKey encrypts key under kek. The random nonce is prepended to the result.
+func WrapKey(kek []byte, key []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewXCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(key)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, key, nil), nil
+}
+
+// UnwrapKey reverses WrapKey.
+func UnwrapKey(kek []byte, wrapped []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewXCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrapped) < aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("Wrapped key is too short")
+	}
+
+	nonce, ciphertext := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	key, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unwrap key: %w", err)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,83 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aead/chacha20poly1305"
+	"github.com/google/uuid"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+)
+
+// Keyring resolves key-encryption keys. Every user gets a random KEK wrapped
+// by the master key; data keys of guest uploads are wrapped by the master key
+// directly.
+type Keyring struct {
+	masterKey []byte
+	db        *db.Queries
+}
+
+func NewKeyring(masterKey string, db *db.Queries) (*Keyring, error) {
+	if len(masterKey) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf(
+			"Invalid master key size: must be exactly %d characters",
+			chacha20poly1305.KeySize,
+		)
+	}
+	return &Keyring{masterKey: []byte(masterKey), db: db}, nil
+}
+
+// WrapBlobKey wraps the data key kept on a blob so that deduplicated uploads
+// from other users can share it.
+func (keyring *Keyring) WrapBlobKey(dataKey []byte) ([]byte, error) {
+	return WrapKey(keyring.masterKey, dataKey)
+}
+
+func (keyring *Keyring) UnwrapBlobKey(wrapped []byte) ([]byte, error) {
+	return UnwrapKey(keyring.masterKey, wrapped)
+}
+
+// WrapSecret protects small per-user secrets, like TOTP seeds, at rest.
+func (keyring *Keyring) WrapSecret(secret []byte) ([]byte, error) {
+	return WrapKey(keyring.masterKey, secret)
+}
+
+func (keyring *Keyring) UnwrapSecret(wrapped []byte) ([]byte, error) {
+	return UnwrapKey(keyring.masterKey, wrapped)
+}
+
+// UserKey returns the KEK of owner, creating it on first use.
+func (keyring *Keyring) UserKey(ctx context.Context, owner uuid.UUID) ([]byte, error) {
+	if owner == uuid.Nil {
+		return keyring.masterKey, nil
+	}
+
+	user, err := keyring.db.GetUser(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	if user.WrappedKek != nil {
+		return UnwrapKey(keyring.masterKey, user.WrappedKek)
+	}
+
+	kek, err := NewKey()
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := WrapKey(keyring.masterKey, kek)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := keyring.db.InitUserKey(ctx, db.InitUserKeyParams{ID: owner, WrappedKek: wrapped})
+	if err != nil {
+		return nil, err
+	}
+	// Lost the race against a concurrent request, use the stored key.
+	if rows == 0 {
+		return keyring.UserKey(ctx, owner)
+	}
+
+	return kek, nil
+}
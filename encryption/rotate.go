@@ -0,0 +1,182 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+)
+
+// RotateKeys gives every user a fresh KEK and re-wraps all data keys under the
+// new KEKs and master key, including those of uploads still in progress, along
+// with the TOTP secrets. Stored objects are left
+// untouched. Keys still wrapped by previousMasterKey are accepted, so a
+// rotation interrupted half way can simply be run again.
+func RotateKeys(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	previousMasterKey string,
+	masterKey string,
+) error {
+	master := []byte(masterKey)
+	masters := [][]byte{master}
+	if previousMasterKey != "" && previousMasterKey != masterKey {
+		masters = append(masters, []byte(previousMasterKey))
+	}
+
+	query := db.New(pool)
+
+	users, err := query.ListUserKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		oldKek, err := unwrapWithAny(masters, user.WrappedKek)
+		if err != nil {
+			return fmt.Errorf("User %s: %w", user.ID, err)
+		}
+
+		newKek, err := NewKey()
+		if err != nil {
+			return err
+		}
+
+		err = execTx(ctx, pool, func(q *db.Queries) error {
+			if err := rewrapFileKeys(ctx, q, user.ID, [][]byte{oldKek}, newKek); err != nil {
+				return err
+			}
+
+			wrapped, err := WrapKey(master, newKek)
+			if err != nil {
+				return err
+			}
+			return q.UpdateUserKey(ctx, db.UpdateUserKeyParams{ID: user.ID, WrappedKek: wrapped})
+		})
+		if err != nil {
+			return fmt.Errorf("User %s: %w", user.ID, err)
+		}
+	}
+	log.Printf("Rotated key-encryption keys of %d users", len(users))
+
+	err = execTx(ctx, pool, func(q *db.Queries) error {
+		if err := rewrapFileKeys(ctx, q, uuid.Nil, masters, master); err != nil {
+			return err
+		}
+
+		blobs, err := q.ListBlobKeys(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, blob := range blobs {
+			wrapped, err := rewrap(masters, master, blob.WrappedKey)
+			if err != nil {
+				return fmt.Errorf("Blob %s: %w", blob.ID, err)
+			}
+
+			err = q.UpdateBlobKey(ctx, db.UpdateBlobKeyParams{ID: blob.ID, WrappedKey: wrapped})
+			if err != nil {
+				return err
+			}
+		}
+
+		uploads, err := q.ListUploadKeys(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, upload := range uploads {
+			wrapped, err := rewrap(masters, master, upload.WrappedKey)
+			if err != nil {
+				return fmt.Errorf("Upload %s: %w", upload.ID, err)
+			}
+
+			err = q.UpdateUploadKey(ctx, db.UpdateUploadKeyParams{ID: upload.ID, WrappedKey: wrapped})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Println("Re-wrapped guest, blob and upload data keys")
+
+	secrets, err := query.ListUserTotpSecrets(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range secrets {
+		wrapped, err := rewrap(masters, master, user.TotpSecret)
+		if err != nil {
+			return fmt.Errorf("TOTP secret of user %s: %w", user.ID, err)
+		}
+
+		err = query.UpdateUserTotpSecret(ctx, db.UpdateUserTotpSecretParams{ID: user.ID, TotpSecret: wrapped})
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Re-wrapped TOTP secrets of %d users", len(secrets))
+
+	return nil
+}
+
+func rewrapFileKeys(
+	ctx context.Context,
+	q *db.Queries,
+	owner uuid.UUID,
+	oldKeks [][]byte,
+	newKek []byte,
+) error {
+	files, err := q.ListFileKeys(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		wrapped, err := rewrap(oldKeks, newKek, file.WrappedKey)
+		if err != nil {
+			return fmt.Errorf("File %s: %w", file.ID, err)
+		}
+
+		err = q.UpdateFileKey(ctx, db.UpdateFileKeyParams{ID: file.ID, WrappedKey: wrapped})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func rewrap(oldKeks [][]byte, newKek []byte, wrapped []byte) ([]byte, error) {
+	dataKey, err := unwrapWithAny(oldKeks, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return WrapKey(newKek, dataKey)
+}
+
+func unwrapWithAny(keks [][]byte, wrapped []byte) (key []byte, err error) {
+	for _, kek := range keks {
+		key, err = UnwrapKey(kek, wrapped)
+		if err == nil {
+			return key, nil
+		}
+	}
+	return nil, err
+}
+
+func execTx(ctx context.Context, pool *pgxpool.Pool, fn func(*db.Queries) error) error {
+	return pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		return fn(db.New(tx))
+	})
+}
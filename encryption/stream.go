@@ -0,0 +1,220 @@
+package encryption
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/aead/chacha20poly1305"
+)
+
+// Encrypted objects start with a header followed by independently sealed
+// chunks, so any byte range can be decrypted without reading the whole object.
+//
+//	header: magic (4) | chunk size (4, big endian) | nonce prefix (19)
+//	chunk:  XChaCha20-Poly1305(plaintext chunk), nonce = prefix | index (4) | last (1)
+//
+// Marking the final chunk in its nonce stops truncated objects from decrypting.
+const (
+	HeaderSize       = 4 + 4 + noncePrefixSize
+	DefaultChunkSize = 64 * 1024
+	noncePrefixSize  = 19
+	tagSize          = 16
+)
+
+var magic = [4]byte{'d', 'b', 'e', '1'}
+
+type Header struct {
+	ChunkSize   uint32
+	NoncePrefix [noncePrefixSize]byte
+}
+
+// NewHeader returns a header with a fresh random nonce prefix.
+func NewHeader(chunkSize uint32) (Header, error) {
+	header := Header{ChunkSize: chunkSize}
+	if _, err := rand.Read(header.NoncePrefix[:]); err != nil {
+		return header, err
+	}
+	return header, nil
+}
+
+func (header Header) Marshal() []byte {
+	buf := make([]byte, HeaderSize)
+	copy(buf, magic[:])
+	binary.BigEndian.PutUint32(buf[4:8], header.ChunkSize)
+	copy(buf[8:], header.NoncePrefix[:])
+	return buf
+}
+
+func ParseHeader(buf []byte) (Header, error) {
+	var header Header
+	if len(buf) < HeaderSize || [4]byte(buf[:4]) != magic {
+		return header, errors.New("Invalid encryption header")
+	}
+
+	header.ChunkSize = binary.BigEndian.Uint32(buf[4:8])
+	if header.ChunkSize == 0 {
+		return header, errors.New("Invalid encryption chunk size")
+	}
+	copy(header.NoncePrefix[:], buf[8:HeaderSize])
+
+	return header, nil
+}
+
+// Stream seals and opens the chunks of a single encrypted object.
+type Stream struct {
+	aead   cipher.AEAD
+	header Header
+}
+
+func NewStream(key []byte, header Header) (*Stream, error) {
+	aead, err := chacha20poly1305.NewXCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Stream{aead: aead, header: header}, nil
+}
+
+func (stream *Stream) nonce(index uint64, last bool) []byte {
+	nonce := make([]byte, stream.aead.NonceSize())
+	copy(nonce, stream.header.NoncePrefix[:])
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], uint32(index))
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+func (stream *Stream) SealChunk(index uint64, last bool, plaintext []byte) []byte {
+	return stream.aead.Seal(nil, stream.nonce(index, last), plaintext, nil)
+}
+
+func (stream *Stream) OpenChunk(index uint64, last bool, ciphertext []byte) ([]byte, error) {
+	return stream.aead.Open(nil, stream.nonce(index, last), ciphertext, nil)
+}
+
+// Encrypt returns the complete encrypted object for plaintext, header included.
+func (stream *Stream) Encrypt(plaintext []byte) []byte {
+	out := make([]byte, 0, CiphertextSize(int64(len(plaintext)), stream.header.ChunkSize))
+	out = append(out, stream.header.Marshal()...)
+	return append(out, stream.EncryptChunks(plaintext, 0, true)...)
+}
+
+// EncryptChunks seals plaintext as consecutive chunks starting at index first,
+// so objects can be produced piece by piece. Unless final is set, plaintext
+// must be a whole number of chunks.
+func (stream *Stream) EncryptChunks(plaintext []byte, first uint64, final bool) []byte {
+	size := int64(len(plaintext))
+	chunkSize := int64(stream.header.ChunkSize)
+	chunks := size / chunkSize
+	if final {
+		chunks = ChunkCount(size, stream.header.ChunkSize)
+	}
+
+	out := make([]byte, 0, size+chunks*tagSize)
+	for i := int64(0); i < chunks; i++ {
+		end := (i + 1) * chunkSize
+		if end > size {
+			end = size
+		}
+		last := final && i == chunks-1
+		out = append(out, stream.SealChunk(first+uint64(i), last, plaintext[i*chunkSize:end])...)
+	}
+
+	return out
+}
+
+// ChunkCount returns how many chunks hold plainSize bytes. Empty objects still
+// carry one (empty) final chunk.
+func ChunkCount(plainSize int64, chunkSize uint32) int64 {
+	if plainSize == 0 {
+		return 1
+	}
+	return (plainSize + int64(chunkSize) - 1) / int64(chunkSize)
+}
+
+func CiphertextSize(plainSize int64, chunkSize uint32) int64 {
+	return HeaderSize + plainSize + ChunkCount(plainSize, chunkSize)*tagSize
+}
+
+// CiphertextRange maps the inclusive plaintext range [start, end] to the
+// inclusive range of object bytes holding the chunks it spans.
+func (stream *Stream) CiphertextRange(plainSize int64, start int64, end int64) (int64, int64) {
+	chunkSize := int64(stream.header.ChunkSize)
+	first := start / chunkSize
+	last := end / chunkSize
+
+	cipherStart := HeaderSize + first*(chunkSize+tagSize)
+	cipherEnd := HeaderSize + last*(chunkSize+tagSize) + stream.chunkLen(plainSize, last) - 1
+
+	return cipherStart, cipherEnd
+}
+
+func (stream *Stream) chunkLen(plainSize int64, index int64) int64 {
+	chunkSize := int64(stream.header.ChunkSize)
+	if index == ChunkCount(plainSize, stream.header.ChunkSize)-1 {
+		return plainSize - index*chunkSize + tagSize
+	}
+	return chunkSize + tagSize
+}
+
+type rangeReader struct {
+	stream    *Stream
+	src       io.Reader
+	plainSize int64
+	index     int64
+	skip      int64
+	remaining int64
+	buf       []byte
+}
+
+// NewRangeReader decrypts the plaintext range [start, end] from src, which
+// must yield the object bytes returned by CiphertextRange for the same range.
+func (stream *Stream) NewRangeReader(src io.Reader, plainSize int64, start int64, end int64) io.Reader {
+	chunkSize := int64(stream.header.ChunkSize)
+	return &rangeReader{
+		stream:    stream,
+		src:       src,
+		plainSize: plainSize,
+		index:     start / chunkSize,
+		skip:      start % chunkSize,
+		remaining: end - start + 1,
+	}
+}
+
+func (reader *rangeReader) Read(p []byte) (int, error) {
+	if reader.remaining <= 0 {
+		return 0, io.EOF
+	}
+
+	if len(reader.buf) == 0 {
+		chunk := make([]byte, reader.stream.chunkLen(reader.plainSize, reader.index))
+		if _, err := io.ReadFull(reader.src, chunk); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+
+		last := reader.index == ChunkCount(reader.plainSize, reader.stream.header.ChunkSize)-1
+		plaintext, err := reader.stream.OpenChunk(uint64(reader.index), last, chunk)
+		if err != nil {
+			return 0, err
+		}
+
+		reader.index++
+		reader.buf = plaintext[reader.skip:]
+		reader.skip = 0
+	}
+
+	n := copy(p, reader.buf)
+	if int64(n) > reader.remaining {
+		n = int(reader.remaining)
+	}
+	reader.buf = reader.buf[n:]
+	reader.remaining -= int64(n)
+
+	return n, nil
+}
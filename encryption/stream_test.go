@@ -0,0 +1,150 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStream(t *testing.T, chunkSize uint32) *Stream {
+	key, err := NewKey()
+	require.NoError(t, err)
+
+	header, err := NewHeader(chunkSize)
+	require.NoError(t, err)
+
+	stream, err := NewStream(key, header)
+	require.NoError(t, err)
+
+	return stream
+}
+
+func TestStreamRange(t *testing.T) {
+	plaintext := make([]byte, 1000)
+	_, err := rand.Read(plaintext)
+	require.NoError(t, err)
+
+	stream := newTestStream(t, 64)
+	object := stream.Encrypt(plaintext)
+	require.Len(t, object, int(CiphertextSize(int64(len(plaintext)), 64)))
+
+	header, err := ParseHeader(object)
+	require.NoError(t, err)
+	require.Equal(t, stream.header, header)
+
+	testCases := []struct {
+		name  string
+		start int64
+		end   int64
+	}{
+		{name: "Whole", start: 0, end: 999},
+		{name: "WithinChunk", start: 3, end: 10},
+		{name: "ChunkBoundary", start: 63, end: 64},
+		{name: "SpanningChunks", start: 100, end: 700},
+		{name: "LastChunk", start: 980, end: 999},
+		{name: "LastByte", start: 999, end: 999},
+	}
+
+	for i := range testCases {
+		testCase := testCases[i]
+
+		t.Run(testCase.name, func(t *testing.T) {
+			size := int64(len(plaintext))
+			cipherStart, cipherEnd := stream.CiphertextRange(size, testCase.start, testCase.end)
+			src := bytes.NewReader(object[cipherStart : cipherEnd+1])
+
+			got, err := io.ReadAll(stream.NewRangeReader(src, size, testCase.start, testCase.end))
+			require.NoError(t, err)
+			require.Equal(t, plaintext[testCase.start:testCase.end+1], got)
+		})
+	}
+}
+
+func TestStreamEncryptChunks(t *testing.T) {
+	plaintext := make([]byte, 300)
+	_, err := rand.Read(plaintext)
+	require.NoError(t, err)
+
+	stream := newTestStream(t, 64)
+
+	// Sealing piece by piece must give the same object as sealing at once.
+	object := stream.header.Marshal()
+	object = append(object, stream.EncryptChunks(plaintext[:128], 0, false)...)
+	object = append(object, stream.EncryptChunks(plaintext[128:], 2, true)...)
+
+	size := int64(len(plaintext))
+	got, err := io.ReadAll(stream.NewRangeReader(bytes.NewReader(object[HeaderSize:]), size, 0, size-1))
+	require.NoError(t, err)
+	require.Equal(t, plaintext, got)
+}
+
+func TestStreamRejectsTampering(t *testing.T) {
+	plaintext := bytes.Repeat([]byte("dropbyte"), 40)
+	size := int64(len(plaintext))
+	stream := newTestStream(t, 64)
+
+	testCases := []struct {
+		name   string
+		size   int64
+		mutate func(object []byte) []byte
+	}{
+		{
+			name: "FlippedBit",
+			size: size,
+			mutate: func(object []byte) []byte {
+				object[HeaderSize+5] ^= 1
+				return object
+			},
+		},
+		{
+			name: "Truncated",
+			size: size,
+			mutate: func(object []byte) []byte {
+				return object[:HeaderSize+4*(64+tagSize)]
+			},
+		},
+		{
+			name: "TruncatedAtChunkBoundary",
+			size: 4 * 64,
+			mutate: func(object []byte) []byte {
+				// The fourth chunk was not sealed as the final one.
+				return object[:HeaderSize+4*(64+tagSize)]
+			},
+		},
+	}
+
+	for i := range testCases {
+		testCase := testCases[i]
+
+		t.Run(testCase.name, func(t *testing.T) {
+			object := testCase.mutate(stream.Encrypt(plaintext))
+			src := bytes.NewReader(object[HeaderSize:])
+			reader := stream.NewRangeReader(src, testCase.size, 0, testCase.size-1)
+
+			_, err := io.ReadAll(reader)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestWrapKey(t *testing.T) {
+	kek, err := NewKey()
+	require.NoError(t, err)
+	key, err := NewKey()
+	require.NoError(t, err)
+
+	wrapped, err := WrapKey(kek, key)
+	require.NoError(t, err)
+
+	unwrapped, err := UnwrapKey(kek, wrapped)
+	require.NoError(t, err)
+	require.Equal(t, key, unwrapped)
+
+	otherKek, err := NewKey()
+	require.NoError(t, err)
+	_, err = UnwrapKey(otherKek, wrapped)
+	require.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package gapi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/token"
+)
+
+const (
+	authorizationHeader = "authorization"
+	authorizationBearer = "bearer"
+)
+
+// authorizeUser checks the bearer access token in the request metadata and
+// that its session has not been revoked. Only full session tokens are
+// accepted, not ones narrowed to a scope or resource.
+func (server *Server) authorizeUser(ctx context.Context) (*token.Payload, db.Session, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, db.Session{}, err
+	}
+
+	payload, err := server.token.VerifyToken(accessToken, token.AccessToken)
+	if err != nil {
+		return nil, db.Session{}, fmt.Errorf("Invalid access token: %s", err)
+	}
+
+	if err := payload.CheckAudience(token.AudienceWeb, token.AudienceCLI); err != nil {
+		return nil, db.Session{}, err
+	}
+	if payload.Restricted() {
+		return nil, db.Session{}, fmt.Errorf("Scoped tokens cannot be used here")
+	}
+
+	session, err := server.db.GetSession(ctx, payload.SessionId)
+	if err != nil {
+		return nil, db.Session{}, fmt.Errorf("Session not found: %s", err)
+	}
+
+	if session.IsBlocked || session.UserID != payload.UserId {
+		return nil, db.Session{}, fmt.Errorf("Session has been revoked")
+	}
+
+	return payload, session, nil
+}
+
+// bearerToken reads the bearer credential from the request metadata.
+func bearerToken(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", fmt.Errorf("Missing metadata")
+	}
+
+	values := md.Get(authorizationHeader)
+	if len(values) == 0 {
+		return "", fmt.Errorf("Missing authorization header")
+	}
+
+	fields := strings.Fields(values[0])
+	if len(fields) < 2 {
+		return "", fmt.Errorf("Invalid authorization header format")
+	}
+
+	if authType := strings.ToLower(fields[0]); authType != authorizationBearer {
+		return "", fmt.Errorf("Unsupported authorization type %s", authType)
+	}
+
+	return fields[1], nil
+}
@@ -9,8 +9,23 @@ import (
 
 func convertUser(user db.User) *pb.User {
 	return &pb.User{
-		FullName:  user.FullName,
-		Email:     user.Email,
-		CreatedAt: timestamppb.New(user.CreatedAt),
+		FullName:      user.FullName,
+		Email:         user.Email,
+		CreatedAt:     timestamppb.New(user.CreatedAt),
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		TotpEnabled:   user.TotpEnabledAt.Valid,
+	}
+}
+
+func convertFile(file db.File) *pb.File {
+	return &pb.File{
+		Id:           file.ID.String(),
+		Name:         file.Name,
+		Size:         file.Size,
+		Favourite:    file.Favourite,
+		FileType:     file.FileType,
+		LastModified: file.LastModified,
+		CreatedAt:    timestamppb.New(file.CreatedAt),
+		E2E:          file.E2e,
 	}
 }
@@ -0,0 +1,42 @@
+package gapi
+
+import (
+	"context"
+	"log"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/liquiddev99/dropbyte-backend/lockout"
+)
+
+// checkLockout returns ResourceExhausted while the email or client IP of
+// attempt is locked.
+func (server *Server) checkLockout(ctx context.Context, attempt lockout.Attempt) error {
+	err := server.lockout.Check(ctx, attempt.Email, attempt.ClientIP)
+	if err == nil {
+		return nil
+	}
+
+	if locked, ok := err.(*lockout.LockedError); ok {
+		return status.Errorf(
+			codes.ResourceExhausted,
+			"%s, retry in %d seconds",
+			locked,
+			int(locked.RetryAfter.Seconds())+1,
+		)
+	}
+	return status.Errorf(codes.Internal, "Failed to check lockout: %s", err)
+}
+
+func (server *Server) loginFailed(ctx context.Context, attempt lockout.Attempt) {
+	if err := server.lockout.Fail(ctx, attempt); err != nil {
+		log.Println("Failed to record failed login", err)
+	}
+}
+
+func (server *Server) loginSucceeded(ctx context.Context, attempt lockout.Attempt) {
+	if err := server.lockout.Succeed(ctx, attempt); err != nil {
+		log.Println("Failed to record login", err)
+	}
+}
@@ -0,0 +1,56 @@
+package gapi
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/liquiddev99/dropbyte-backend/util"
+)
+
+const (
+	grpcGatewayUserAgentHeader = "grpcgateway-user-agent"
+	userAgentHeader            = "user-agent"
+	xForwardedForHeader        = "x-forwarded-for"
+)
+
+type Metadata struct {
+	UserAgent string
+	ClientIP  string
+}
+
+// extractMetadata reads the client details recorded on sessions, whether the
+// call came through the gateway or straight over gRPC. X-Forwarded-For is only
+// believed as far as the hops were added by trusted proxies.
+func (server *Server) extractMetadata(ctx context.Context) *Metadata {
+	mtdt := &Metadata{}
+	var forwarded []string
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if userAgents := md.Get(grpcGatewayUserAgentHeader); len(userAgents) > 0 {
+			mtdt.UserAgent = userAgents[0]
+		}
+
+		if userAgents := md.Get(userAgentHeader); len(userAgents) > 0 && mtdt.UserAgent == "" {
+			mtdt.UserAgent = userAgents[0]
+		}
+
+		forwarded = util.SplitForwarded(md.Get(xForwardedForHeader))
+	}
+
+	// The gateway serves calls in process, so there is no gRPC peer. It
+	// appends the address of the HTTP connection as the last hop instead.
+	var remoteAddr string
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	} else if len(forwarded) > 0 {
+		remoteAddr = strings.TrimSpace(forwarded[len(forwarded)-1])
+		forwarded = forwarded[:len(forwarded)-1]
+	}
+
+	mtdt.ClientIP = util.ClientIP(remoteAddr, forwarded, server.proxies)
+
+	return mtdt
+}
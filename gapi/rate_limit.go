@@ -0,0 +1,93 @@
+package gapi
+
+import (
+	"context"
+	"log"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/liquiddev99/dropbyte-backend/apikey"
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/pb"
+	"github.com/liquiddev99/dropbyte-backend/token"
+)
+
+// methodRateLimits names the rate limit policy of the RPCs that don't use the
+// general api one.
+var methodRateLimits = map[string]string{
+	pb.Dropbyte_CreateUser_FullMethodName: "signup",
+	pb.Dropbyte_LoginUser_FullMethodName:  "login",
+	pb.Dropbyte_LoginMFA_FullMethodName:   "login",
+}
+
+type rateLimitedContextKey struct{}
+
+// RateLimitInterceptor takes a token from the method's bucket for the caller,
+// keyed the same way as the HTTP API. It runs after AuthInterceptor so API
+// keys have been looked up.
+func (server *Server) RateLimitInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if err := server.checkRateLimit(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+
+	return handler(context.WithValue(ctx, rateLimitedContextKey{}, true), req)
+}
+
+// checkRateLimit takes a token from the method's bucket unless the interceptor
+// already did. Calls from the HTTP gateway don't pass through the interceptor,
+// so every handler calls it too.
+func (server *Server) checkRateLimit(ctx context.Context, method string) error {
+	if ctx.Value(rateLimitedContextKey{}) != nil {
+		return nil
+	}
+
+	policy, ok := methodRateLimits[method]
+	if !ok {
+		policy = "api"
+	}
+
+	allowed, retryAfter, err := server.limiter.Allow(ctx, policy, server.rateLimitKey(ctx))
+	if err != nil {
+		log.Println("Failed to check rate limit", err)
+		return nil
+	}
+
+	if !allowed {
+		return status.Errorf(
+			codes.ResourceExhausted,
+			"Too many requests, retry in %d seconds",
+			int(retryAfter.Seconds())+1,
+		)
+	}
+
+	return nil
+}
+
+func (server *Server) rateLimitKey(ctx context.Context) string {
+	if key, ok := ctx.Value(apiKeyContextKey{}).(db.ApiKey); ok {
+		return "key:" + key.ID.String()
+	}
+
+	credential, err := bearerToken(ctx)
+	if err == nil && apikey.IsKey(credential) {
+		// Gateway calls haven't been through AuthInterceptor.
+		if key, err := apikey.Authenticate(ctx, server.db, credential); err == nil {
+			return "key:" + key.ID.String()
+		}
+	} else if err == nil {
+		// Only the signature is checked, a revoked session still counts
+		// against its own user rather than the client IP.
+		if payload, err := server.token.VerifyToken(credential, token.AccessToken); err == nil {
+			return "user:" + payload.UserId.String()
+		}
+	}
+
+	return "ip:" + server.extractMetadata(ctx).ClientIP
+}
@@ -0,0 +1,84 @@
+package gapi
+
+import (
+	"context"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/pb"
+	"github.com/liquiddev99/dropbyte-backend/util"
+	"github.com/liquiddev99/dropbyte-backend/validation"
+)
+
+// ChangePassword keeps the calling session and revokes every other one.
+func (server *Server) ChangePassword(
+	ctx context.Context,
+	req *pb.ChangePasswordRequest,
+) (*pb.ChangePasswordResponse, error) {
+	if err := server.checkRateLimit(ctx, pb.Dropbyte_ChangePassword_FullMethodName); err != nil {
+		return nil, err
+	}
+
+	authPayload, session, err := server.authorizeUser(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "Unauthorized: %s", err)
+	}
+
+	violations := validateChangePasswordRequest(req)
+	if violations != nil {
+		return nil, invalidArgumentError(violations)
+	}
+
+	user, err := server.db.GetUser(ctx, authPayload.UserId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to get user: %s", err)
+	}
+
+	err = util.CheckPassword(req.GetCurrentPassword(), user.HashedPassword)
+	if err != nil {
+		return nil, status.Errorf(codes.PermissionDenied, "Current password is incorrect")
+	}
+
+	err = validation.ValidatePersonalInfo(req.GetNewPassword(), user.Email, user.FullName)
+	if err != nil {
+		return nil, invalidArgumentError([]*errdetails.BadRequest_FieldViolation{
+			fieldViolation("new_password", err),
+		})
+	}
+
+	hashedPassword, err := util.HashPassword(req.GetNewPassword())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to hash password, %s", err)
+	}
+
+	err = server.db.UpdateUserPassword(ctx, db.UpdateUserPasswordParams{
+		ID:             user.ID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to update password: %s", err)
+	}
+
+	err = server.db.BlockOtherUserSessions(ctx, db.BlockOtherUserSessionsParams{
+		UserID:   user.ID,
+		FamilyID: session.FamilyID,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to revoke sessions: %s", err)
+	}
+
+	return &pb.ChangePasswordResponse{}, nil
+}
+
+func validateChangePasswordRequest(
+	req *pb.ChangePasswordRequest,
+) (violations []*errdetails.BadRequest_FieldViolation) {
+	if err := validation.ValidateNewPassword(req.GetNewPassword()); err != nil {
+		violations = append(violations, fieldViolation("new_password", err))
+	}
+
+	return violations
+}
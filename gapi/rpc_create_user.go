@@ -19,6 +19,10 @@ func (server *Server) CreateUser(
 	ctx context.Context,
 	req *pb.CreateUserRequest,
 ) (*pb.CreateUserResponse, error) {
+	if err := server.checkRateLimit(ctx, pb.Dropbyte_CreateUser_FullMethodName); err != nil {
+		return nil, err
+	}
+
 	violations := validateCreateUserRequest(req)
 	if violations != nil {
 		return nil, invalidArgumentError(violations)
@@ -59,7 +63,8 @@ func validateCreateUserRequest(
 		violations = append(violations, fieldViolation("full_name", err))
 	}
 
-	if err := validation.ValidatePassword(req.GetPassword()); err != nil {
+	err := validation.ValidateNewPassword(req.GetPassword(), req.GetEmail(), req.GetFullName())
+	if err != nil {
 		violations = append(violations, fieldViolation("password", err))
 	}
 
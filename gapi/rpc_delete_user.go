@@ -0,0 +1,144 @@
+package gapi
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/lockout"
+	"github.com/liquiddev99/dropbyte-backend/pb"
+	"github.com/liquiddev99/dropbyte-backend/request"
+	"github.com/liquiddev99/dropbyte-backend/util"
+)
+
+// DeleteUser removes the account right away and purges its files from
+// storage in the background.
+func (server *Server) DeleteUser(
+	ctx context.Context,
+	req *pb.DeleteUserRequest,
+) (*pb.DeleteUserResponse, error) {
+	if err := server.checkRateLimit(ctx, pb.Dropbyte_DeleteUser_FullMethodName); err != nil {
+		return nil, err
+	}
+
+	authPayload, session, err := server.authorizeUser(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "Unauthorized: %s", err)
+	}
+
+	user, err := server.db.GetUser(ctx, authPayload.UserId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to get user: %s", err)
+	}
+
+	if err := server.checkCurrentPassword(ctx, user, session, req.GetPassword()); err != nil {
+		return nil, err
+	}
+
+	var files []db.File
+	err = server.execTx(ctx, func(q *db.Queries) error {
+		var err error
+		files, err = q.DeleteFilesByOwner(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		return q.DeleteUser(ctx, user.ID)
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to delete user: %s", err)
+	}
+	go server.purgeFiles(files)
+
+	return &pb.DeleteUserResponse{}, nil
+}
+
+// checkCurrentPassword checks that password is the user's, or without one
+// that the session's login happened within REAUTH_DURATION, since accounts
+// created through LDAP, OIDC or a login link don't have a password. Wrong
+// passwords count towards the login lockout.
+func (server *Server) checkCurrentPassword(
+	ctx context.Context,
+	user db.User,
+	session db.Session,
+	password string,
+) error {
+	if password == "" {
+		// The first session of a family is the login itself.
+		login, err := server.db.GetSession(ctx, session.FamilyID)
+		if err != nil {
+			return status.Errorf(codes.Internal, "Failed to get session: %s", err)
+		}
+		if time.Since(login.CreatedAt) > server.config.ReauthDuration {
+			return status.Errorf(codes.PermissionDenied, "Enter your password or log in again to continue")
+		}
+		return nil
+	}
+
+	mtdt := server.extractMetadata(ctx)
+	attempt := lockout.Attempt{
+		UserID:    user.ID,
+		Email:     user.Email,
+		ClientIP:  mtdt.ClientIP,
+		UserAgent: mtdt.UserAgent,
+	}
+	if err := server.checkLockout(ctx, attempt); err != nil {
+		return err
+	}
+
+	if err := util.CheckPassword(password, user.HashedPassword); err != nil {
+		server.loginFailed(ctx, attempt)
+		return status.Errorf(codes.PermissionDenied, "Password is incorrect")
+	}
+	return nil
+}
+
+// purgeFiles releases the blobs of deleted files and removes the ones nothing
+// references anymore from B2.
+func (server *Server) purgeFiles(files []db.File) {
+	ctx := context.Background()
+
+	authResponse, err := request.AuthorizeAccount(
+		server.config.B2ApplicationKeyId,
+		server.config.B2ApplicationKey,
+	)
+	if err != nil {
+		log.Println("Failed to authorize b2 account", err)
+		return
+	}
+
+	for _, file := range files {
+		fileId, fileName := file.FileID, file.Name
+
+		// Files uploaded before deduplication own their B2 object outright.
+		if file.BlobID != uuid.Nil {
+			blob, err := server.db.ReleaseBlob(ctx, file.BlobID)
+			if err != nil {
+				log.Println("Failed to release blob", file.BlobID, err)
+				continue
+			}
+			if blob.RefCount > 0 {
+				continue
+			}
+
+			blob, err = server.db.DeleteUnreferencedBlob(ctx, file.BlobID)
+			if err != nil {
+				if err != pgx.ErrNoRows {
+					log.Println("Failed to delete blob", file.BlobID, err)
+				}
+				continue
+			}
+			fileId, fileName = blob.FileID, blob.FileName
+		}
+
+		_, err := request.DeleteFileById(fileId, fileName, authResponse.AuthorizationToken)
+		if err != nil {
+			log.Println("Failed to delete file from b2", fileId, err)
+		}
+	}
+}
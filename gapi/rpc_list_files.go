@@ -0,0 +1,65 @@
+package gapi
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/liquiddev99/dropbyte-backend/apikey"
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/pb"
+)
+
+const defaultPageSize = 50
+
+func (server *Server) ListFiles(
+	ctx context.Context,
+	req *pb.ListFilesRequest,
+) (*pb.ListFilesResponse, error) {
+	if err := server.checkRateLimit(ctx, pb.Dropbyte_ListFiles_FullMethodName); err != nil {
+		return nil, err
+	}
+
+	userId, err := server.authorizeScope(ctx, apikey.ScopeFilesRead)
+	if err != nil {
+		return nil, err
+	}
+
+	if violations := validateListFilesRequest(req); violations != nil {
+		return nil, invalidArgumentError(violations)
+	}
+
+	pageSize := req.GetPageSize()
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+
+	files, err := server.db.ListFiles(ctx, db.ListFilesParams{
+		Owner:  userId,
+		Limit:  pageSize,
+		Offset: req.GetPage() * pageSize,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to list files: %s", err)
+	}
+
+	rsp := &pb.ListFilesResponse{Files: make([]*pb.File, len(files))}
+	for i, file := range files {
+		rsp.Files[i] = convertFile(file)
+	}
+
+	return rsp, nil
+}
+
+func validateListFilesRequest(req *pb.ListFilesRequest) (violations []*errdetails.BadRequest_FieldViolation) {
+	if pageSize := req.GetPageSize(); pageSize < 0 || pageSize > 100 {
+		violations = append(violations, fieldViolation("page_size", fmt.Errorf("Must be between 0 and 100")))
+	}
+	if req.GetPage() < 0 {
+		violations = append(violations, fieldViolation("page", fmt.Errorf("Must not be negative")))
+	}
+	return violations
+}
@@ -0,0 +1,95 @@
+package gapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/liquiddev99/dropbyte-backend/lockout"
+	"github.com/liquiddev99/dropbyte-backend/pb"
+	"github.com/liquiddev99/dropbyte-backend/token"
+	"github.com/liquiddev99/dropbyte-backend/totp"
+)
+
+// LoginMFA finishes a login started with LoginUser by checking the second
+// factor.
+func (server *Server) LoginMFA(
+	ctx context.Context,
+	req *pb.LoginMFARequest,
+) (*pb.LoginUserResponse, error) {
+	if err := server.checkRateLimit(ctx, pb.Dropbyte_LoginMFA_FullMethodName); err != nil {
+		return nil, err
+	}
+
+	violations := validateLoginMFARequest(req)
+	if violations != nil {
+		return nil, invalidArgumentError(violations)
+	}
+
+	mfaPayload, err := server.token.VerifyToken(req.GetMfaToken(), token.MFAToken)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "Invalid mfa token: %s", err)
+	}
+
+	user, err := server.db.GetUser(ctx, mfaPayload.UserId)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, status.Errorf(codes.Unauthenticated, "User not found: %s", err)
+		}
+		return nil, status.Errorf(codes.Internal, "Failed to get user: %s", err)
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		return nil, status.Errorf(codes.Unauthenticated, "Two-factor authentication is not enabled")
+	}
+	if user.SuspendedAt.Valid {
+		return nil, status.Errorf(codes.PermissionDenied, "Account is suspended")
+	}
+
+	mtdt := server.extractMetadata(ctx)
+	attempt := lockout.Attempt{
+		UserID:    user.ID,
+		Email:     user.Email,
+		ClientIP:  mtdt.ClientIP,
+		UserAgent: mtdt.UserAgent,
+	}
+	if err := server.checkLockout(ctx, attempt); err != nil {
+		return nil, err
+	}
+
+	err = totp.CheckSecondFactor(ctx, server.db, server.keyring, user, req.GetCode(), req.GetRecoveryCode())
+	if err != nil {
+		if err == totp.ErrInvalidSecondFactor {
+			server.loginFailed(ctx, attempt)
+			return nil, status.Errorf(codes.Unauthenticated, "%s", err)
+		}
+		return nil, status.Errorf(codes.Internal, "Failed to check authentication code: %s", err)
+	}
+
+	server.loginSucceeded(ctx, attempt)
+
+	rsp, err := server.createSession(ctx, user)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to create session: %s", err)
+	}
+
+	return rsp, nil
+}
+
+func validateLoginMFARequest(
+	req *pb.LoginMFARequest,
+) (violations []*errdetails.BadRequest_FieldViolation) {
+	if req.GetMfaToken() == "" {
+		violations = append(violations, fieldViolation("mfa_token", fmt.Errorf("Must be provided")))
+	}
+
+	if req.GetCode() == "" && req.GetRecoveryCode() == "" {
+		violations = append(violations, fieldViolation("code", fmt.Errorf("Either code or recovery_code must be provided")))
+	}
+
+	return violations
+}
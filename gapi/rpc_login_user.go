@@ -3,13 +3,16 @@ package gapi
 import (
 	"context"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/google/uuid"
 	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/liquiddev99/dropbyte-backend/authenticator"
+	"github.com/liquiddev99/dropbyte-backend/lockout"
 	"github.com/liquiddev99/dropbyte-backend/pb"
-	"github.com/liquiddev99/dropbyte-backend/util"
+	"github.com/liquiddev99/dropbyte-backend/token"
 	"github.com/liquiddev99/dropbyte-backend/validation"
 )
 
@@ -17,28 +20,62 @@ func (server *Server) LoginUser(
 	ctx context.Context,
 	req *pb.LoginUserRequest,
 ) (*pb.LoginUserResponse, error) {
+	if err := server.checkRateLimit(ctx, pb.Dropbyte_LoginUser_FullMethodName); err != nil {
+		return nil, err
+	}
+
 	violations := validateLoginUserRequest(req)
 	if violations != nil {
 		return nil, invalidArgumentError(violations)
 	}
 
-	user, err := server.db.GetUserByEmail(ctx, req.Email)
+	mtdt := server.extractMetadata(ctx)
+	attempt := lockout.Attempt{
+		Email:     req.GetEmail(),
+		ClientIP:  mtdt.ClientIP,
+		UserAgent: mtdt.UserAgent,
+	}
+	if err := server.checkLockout(ctx, attempt); err != nil {
+		return nil, err
+	}
+
+	user, err := server.authenticator.Authenticate(ctx, req.GetEmail(), req.GetPassword())
+	attempt.UserID = user.ID
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, status.Errorf(codes.NotFound, "Email doesn't exists: %s", err)
+		if err == authenticator.ErrInvalidCredentials {
+			server.loginFailed(ctx, attempt)
+			return nil, status.Errorf(codes.Unauthenticated, "Invalid email or password")
 		}
-		return nil, status.Errorf(codes.Internal, "Failed to get user: %s", err)
+		return nil, status.Errorf(codes.Internal, "Failed to authenticate: %s", err)
+	}
+	if user.SuspendedAt.Valid {
+		return nil, status.Errorf(codes.PermissionDenied, "Account is suspended")
 	}
 
-	err = util.CheckPassword(req.GetPassword(), user.HashedPassword)
-	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "Password not match: %s", err)
+	if user.TotpEnabledAt.Valid {
+		mfaToken, mfaPayload, err := server.token.CreateToken(
+			user.ID,
+			uuid.Nil,
+			token.MFAToken,
+			server.config.MFAChallengeDuration,
+		)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Failed to create mfa token: %s", err)
+		}
+
+		rsp := &pb.LoginUserResponse{
+			MfaRequired:       true,
+			MfaToken:          mfaToken,
+			MfaTokenExpiresAt: timestamppb.New(mfaPayload.ExpiredAt),
+		}
+		return rsp, nil
 	}
 
-	//	token, err := server.token.CreateToken(user.ID, server.config.AccessTokenDuration)
+	server.loginSucceeded(ctx, attempt)
 
-	rsp := &pb.LoginUserResponse{
-		User: convertUser(user),
+	rsp, err := server.createSession(ctx, user)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to create session: %s", err)
 	}
 
 	return rsp, nil
@@ -0,0 +1,127 @@
+package gapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/mailer"
+	"github.com/liquiddev99/dropbyte-backend/pb"
+	"github.com/liquiddev99/dropbyte-backend/token"
+	"github.com/liquiddev99/dropbyte-backend/util"
+	"github.com/liquiddev99/dropbyte-backend/validation"
+)
+
+func (server *Server) UpdateUser(
+	ctx context.Context,
+	req *pb.UpdateUserRequest,
+) (*pb.UpdateUserResponse, error) {
+	if err := server.checkRateLimit(ctx, pb.Dropbyte_UpdateUser_FullMethodName); err != nil {
+		return nil, err
+	}
+
+	authPayload, _, err := server.authorizeUser(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "Unauthorized: %s", err)
+	}
+
+	violations := validateUpdateUserRequest(req)
+	if violations != nil {
+		return nil, invalidArgumentError(violations)
+	}
+
+	user, err := server.db.GetUser(ctx, authPayload.UserId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to get user: %s", err)
+	}
+
+	if req.FullName != nil {
+		user, err = server.db.UpdateUserFullName(ctx, db.UpdateUserFullNameParams{
+			ID:       user.ID,
+			FullName: req.GetFullName(),
+		})
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Failed to update user: %s", err)
+		}
+	}
+
+	if req.Email != nil && req.GetEmail() != user.Email {
+		err = util.CheckPassword(req.GetCurrentPassword(), user.HashedPassword)
+		if err != nil {
+			return nil, status.Errorf(codes.PermissionDenied, "Current password is incorrect")
+		}
+
+		previous := user
+		user, err = server.db.UpdateUserEmail(ctx, db.UpdateUserEmailParams{
+			ID:    user.ID,
+			Email: req.GetEmail(),
+		})
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) {
+				return nil, status.Errorf(codes.AlreadyExists, "Email already exists: %s", err)
+			}
+			return nil, status.Errorf(codes.Internal, "Failed to update email: %s", err)
+		}
+
+		server.sendEmailChanged(previous, user)
+	}
+
+	rsp := &pb.UpdateUserResponse{
+		User: convertUser(user),
+	}
+
+	return rsp, nil
+}
+
+// sendEmailChanged asks the new address to verify itself and tells the old
+// one about the change.
+func (server *Server) sendEmailChanged(previous db.User, user db.User) {
+	link := token.EmailVerificationLink(
+		server.config.PublicUrl,
+		[]byte(server.config.SymmetricKey),
+		user.ID,
+		user.Email,
+		time.Now().Add(server.config.EmailVerificationDuration),
+	)
+
+	err := server.mailer.Send(mailer.VerificationMessage(
+		user.Email,
+		user.FullName,
+		link,
+		server.config.EmailVerificationDuration,
+	))
+	if err != nil {
+		log.Println("Failed to send verification email", user.ID, err)
+	}
+
+	err = server.mailer.Send(mailer.EmailChangedMessage(previous.Email, previous.FullName, user.Email))
+	if err != nil {
+		log.Println("Failed to notify previous email", user.ID, err)
+	}
+}
+
+func validateUpdateUserRequest(
+	req *pb.UpdateUserRequest,
+) (violations []*errdetails.BadRequest_FieldViolation) {
+	if req.FullName != nil {
+		if err := validation.ValidateFullName(req.GetFullName()); err != nil {
+			violations = append(violations, fieldViolation("full_name", err))
+		}
+	}
+
+	if req.Email != nil {
+		if err := validation.ValidateEmail(req.GetEmail()); err != nil {
+			violations = append(violations, fieldViolation("email", err))
+		}
+	}
+
+	return violations
+}
@@ -1,28 +1,105 @@
 package gapi
 
 import (
+	"context"
 	"log"
+	"net/netip"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/liquiddev99/dropbyte-backend/apikey"
+	"github.com/liquiddev99/dropbyte-backend/authenticator"
 	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/encryption"
+	"github.com/liquiddev99/dropbyte-backend/lockout"
+	"github.com/liquiddev99/dropbyte-backend/mailer"
 	"github.com/liquiddev99/dropbyte-backend/pb"
+	"github.com/liquiddev99/dropbyte-backend/ratelimit"
 	"github.com/liquiddev99/dropbyte-backend/token"
 	"github.com/liquiddev99/dropbyte-backend/util"
 )
 
 type Server struct {
 	pb.UnimplementedDropbyteServer
-	config util.Config
-	db     *db.Queries
-	token  token.Token
+	config        util.Config
+	db            *db.Queries
+	pool          *pgxpool.Pool
+	token         token.Token
+	keyring       *encryption.Keyring
+	mailer        mailer.Mailer
+	keyUsage      *apikey.UsageRecorder
+	lockout       *lockout.Guard
+	limiter       *ratelimit.Limiter
+	authenticator authenticator.Authenticator
+	proxies       []netip.Prefix
 }
 
 // Create a new gRPC server
-func NewServer(config util.Config, db *db.Queries) (*Server, error) {
-	token, err := token.NewMaker(config.SymmetricKey)
+func NewServer(config util.Config, db *db.Queries, pool *pgxpool.Pool) (*Server, error) {
+	token, err := token.New(config.SymmetricKey, config.TokenSigningKey, config.TokenRetiredKeys)
+	if err != nil {
+		log.Fatal("Cannot create token maker", err)
+	}
+	keyring, err := encryption.NewKeyring(config.MasterKey, db)
+	if err != nil {
+		log.Fatal("Cannot create keyring")
+	}
+	mailer, err := mailer.New(config.Mailer, mailer.Config{
+		From:        config.MailFrom,
+		SMTPAddress: config.SMTPAddress,
+		Username:    config.SMTPUsername,
+		Password:    config.SMTPPassword,
+		Directory:   config.MailDirectory,
+	})
+	if err != nil {
+		log.Fatal("Cannot create mailer", err)
+	}
+	policies, err := ratelimit.ParsePolicies(config.RateLimits)
+	if err != nil {
+		log.Fatal("Cannot parse rate limits", err)
+	}
+	limitStore, err := ratelimit.NewStore(config.RateLimitStore, db)
+	if err != nil {
+		log.Fatal("Cannot create rate limit store", err)
+	}
+	authenticator, err := authenticator.New(config, db)
+	if err != nil {
+		log.Fatal("Cannot create authenticator", err)
+	}
+	proxies, err := util.ParseTrustedProxies(config.TrustedProxies)
 	if err != nil {
-		log.Fatal("Cannot create token maker")
+		log.Fatal("Cannot parse trusted proxies", err)
+	}
+	server := &Server{
+		config:   config,
+		db:       db,
+		pool:     pool,
+		token:    token,
+		keyring:  keyring,
+		mailer:   mailer,
+		keyUsage: apikey.NewUsageRecorder(db),
+		lockout: lockout.New(db, lockout.Config{
+			MaxAttempts:   config.LoginMaxAttempts,
+			MaxIPAttempts: config.LoginMaxIPAttempts,
+			Delay:         config.LoginLockoutDuration,
+			MaxDelay:      config.LoginMaxLockoutDuration,
+			Window:        config.LoginAttemptWindow,
+		}),
+		limiter:       ratelimit.New(limitStore, policies),
+		authenticator: authenticator,
+		proxies:       proxies,
 	}
-	server := &Server{config: config, db: db, token: token}
+	server.keyUsage.Start(time.Minute)
 
 	return server, nil
 }
+
+// execTx runs fn on queries bound to a single transaction, which commits when
+// fn returns nil.
+func (server *Server) execTx(ctx context.Context, fn func(*db.Queries) error) error {
+	return pgx.BeginFunc(ctx, server.pool, func(tx pgx.Tx) error {
+		return fn(db.New(tx))
+	})
+}
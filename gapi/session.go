@@ -0,0 +1,62 @@
+package gapi
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/pb"
+	"github.com/liquiddev99/dropbyte-backend/token"
+)
+
+// createSession starts a new session family for user and returns the login
+// response carrying its tokens.
+func (server *Server) createSession(ctx context.Context, user db.User) (*pb.LoginUserResponse, error) {
+	sessionID := uuid.New()
+
+	accessToken, accessPayload, err := server.token.CreateScopedToken(
+		user.ID,
+		sessionID,
+		token.AccessToken,
+		token.Claims{Audience: token.AudienceCLI},
+		server.config.AccessTokenDuration,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshPayload, err := server.token.CreateToken(
+		user.ID,
+		sessionID,
+		token.RefreshToken,
+		server.config.RefreshTokenDuration,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	mtdt := server.extractMetadata(ctx)
+	_, err = server.db.CreateSession(ctx, db.CreateSessionParams{
+		ID:           sessionID,
+		UserID:       user.ID,
+		FamilyID:     sessionID,
+		RefreshToken: refreshToken,
+		UserAgent:    mtdt.UserAgent,
+		ClientIp:     mtdt.ClientIP,
+		ExpiresAt:    refreshPayload.ExpiredAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.LoginUserResponse{
+		User:                  convertUser(user),
+		SessionId:             sessionID.String(),
+		AccessToken:           accessToken,
+		RefreshToken:          refreshToken,
+		AccessTokenExpiresAt:  timestamppb.New(accessPayload.ExpiredAt),
+		RefreshTokenExpiresAt: timestamppb.New(refreshPayload.ExpiredAt),
+	}, nil
+}
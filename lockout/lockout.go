@@ -0,0 +1,179 @@
+// Package lockout slows down password guessing. Failed logins are counted per
+// email address and per client IP, and once either passes its limit it is
+// locked for a delay that doubles with every further failure. Unknown emails
+// are counted like real ones, so lockouts don't reveal which accounts exist.
+package lockout
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+)
+
+type Config struct {
+	// MaxAttempts is how many failures an email gets before it is locked.
+	MaxAttempts int32
+	// MaxIPAttempts is the same for a client IP, which tries many emails
+	// when credential stuffing.
+	MaxIPAttempts int32
+	// Delay is the first lockout, MaxDelay caps the doubling.
+	Delay    time.Duration
+	MaxDelay time.Duration
+	// Failures further apart than Window don't add up.
+	Window time.Duration
+}
+
+// LockedError is returned while an email or client IP is locked.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (err *LockedError) Error() string {
+	return "Too many failed login attempts, try again later"
+}
+
+// Attempt describes a login. UserID is uuid.Nil when the email has no
+// account, such attempts are throttled but there's no history to add them to.
+type Attempt struct {
+	UserID    uuid.UUID
+	Email     string
+	ClientIP  string
+	UserAgent string
+}
+
+// Store is the part of the database the guard uses, *db.Queries in
+// production.
+type Store interface {
+	ListLoginThrottles(ctx context.Context, keys []string) ([]db.LoginThrottle, error)
+	RecordLoginFailure(ctx context.Context, arg db.RecordLoginFailureParams) (db.LoginThrottle, error)
+	LockLoginThrottle(ctx context.Context, arg db.LockLoginThrottleParams) error
+	ResetLoginThrottle(ctx context.Context, key string) error
+	DeleteStaleLoginThrottles(ctx context.Context, lastFailureAt time.Time) error
+	CreateLoginAttempt(ctx context.Context, arg db.CreateLoginAttemptParams) error
+	DeleteOldLoginAttempts(ctx context.Context, createdAt time.Time) error
+}
+
+type Guard struct {
+	store  Store
+	config Config
+}
+
+func New(store Store, config Config) *Guard {
+	return &Guard{store: store, config: config}
+}
+
+// Check returns a *LockedError if the email or the client IP is locked.
+func (guard *Guard) Check(ctx context.Context, email string, clientIP string) error {
+	throttles, err := guard.store.ListLoginThrottles(ctx, []string{emailKey(email), ipKey(clientIP)})
+	if err != nil {
+		return err
+	}
+
+	var retryAfter time.Duration
+	for _, throttle := range throttles {
+		if !throttle.LockedUntil.Valid {
+			continue
+		}
+		if wait := time.Until(throttle.LockedUntil.Time); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+
+	if retryAfter > 0 {
+		return &LockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Fail counts a failed login against the email and the client IP, locking
+// them once they pass their limit, and adds it to the user's login history.
+func (guard *Guard) Fail(ctx context.Context, attempt Attempt) error {
+	err := guard.recordFailure(ctx, emailKey(attempt.Email), guard.config.MaxAttempts)
+	if err != nil {
+		return err
+	}
+
+	err = guard.recordFailure(ctx, ipKey(attempt.ClientIP), guard.config.MaxIPAttempts)
+	if err != nil {
+		return err
+	}
+
+	if attempt.UserID == uuid.Nil {
+		return nil
+	}
+	return guard.recordAttempt(ctx, attempt, false)
+}
+
+// Succeed clears the failures of the email and adds the login to the user's
+// history. The client IP keeps its count, a stuffing list usually has a few
+// valid credentials in it.
+func (guard *Guard) Succeed(ctx context.Context, attempt Attempt) error {
+	if err := guard.store.ResetLoginThrottle(ctx, emailKey(attempt.Email)); err != nil {
+		return err
+	}
+	return guard.recordAttempt(ctx, attempt, true)
+}
+
+// Prune drops throttles whose failures no longer count and history older than
+// retention.
+func (guard *Guard) Prune(ctx context.Context, retention time.Duration) error {
+	err := guard.store.DeleteStaleLoginThrottles(ctx, time.Now().Add(-guard.config.Window))
+	if err != nil {
+		return err
+	}
+	return guard.store.DeleteOldLoginAttempts(ctx, time.Now().Add(-retention))
+}
+
+func (guard *Guard) recordFailure(ctx context.Context, key string, maxAttempts int32) error {
+	throttle, err := guard.store.RecordLoginFailure(ctx, db.RecordLoginFailureParams{
+		Key:         key,
+		ResetBefore: time.Now().Add(-guard.config.Window),
+	})
+	if err != nil {
+		return err
+	}
+
+	if throttle.Failures < maxAttempts {
+		return nil
+	}
+
+	lockedUntil := time.Now().Add(guard.delay(throttle.Failures - maxAttempts))
+	return guard.store.LockLoginThrottle(ctx, db.LockLoginThrottleParams{
+		Key:         key,
+		LockedUntil: pgtype.Timestamptz{Time: lockedUntil, Valid: true},
+	})
+}
+
+func (guard *Guard) recordAttempt(ctx context.Context, attempt Attempt, success bool) error {
+	return guard.store.CreateLoginAttempt(ctx, db.CreateLoginAttemptParams{
+		UserID:    attempt.UserID,
+		ClientIp:  attempt.ClientIP,
+		UserAgent: attempt.UserAgent,
+		Success:   success,
+	})
+}
+
+// delay is the lockout after excess failures past the limit.
+func (guard *Guard) delay(excess int32) time.Duration {
+	delay := guard.config.Delay
+	for i := int32(0); i < excess && delay < guard.config.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > guard.config.MaxDelay {
+		delay = guard.config.MaxDelay
+	}
+	return delay
+}
+
+func emailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(clientIP string) string {
+	return "ip:" + clientIP
+}
@@ -0,0 +1,282 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+)
+
+func TestDelay(t *testing.T) {
+	guard := New(nil, Config{Delay: time.Minute, MaxDelay: time.Hour})
+
+	require.Equal(t, time.Minute, guard.delay(0))
+	require.Equal(t, 2*time.Minute, guard.delay(1))
+	require.Equal(t, 32*time.Minute, guard.delay(5))
+	require.Equal(t, time.Hour, guard.delay(6))
+	require.Equal(t, time.Hour, guard.delay(1000))
+}
+
+func TestKeys(t *testing.T) {
+	require.Equal(t, emailKey("alice@example.com"), emailKey(" Alice@Example.com "))
+	require.NotEqual(t, emailKey("127.0.0.1"), ipKey("127.0.0.1"))
+}
+
+func TestLockedError(t *testing.T) {
+	var err error = &LockedError{RetryAfter: time.Minute}
+	require.EqualError(t, err, "Too many failed login attempts, try again later")
+}
+
+// memoryStore mirrors the login throttle queries in memory.
+type memoryStore struct {
+	throttles map[string]db.LoginThrottle
+	attempts  []db.CreateLoginAttemptParams
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{throttles: make(map[string]db.LoginThrottle)}
+}
+
+func (store *memoryStore) ListLoginThrottles(ctx context.Context, keys []string) ([]db.LoginThrottle, error) {
+	var throttles []db.LoginThrottle
+	for _, key := range keys {
+		if throttle, ok := store.throttles[key]; ok {
+			throttles = append(throttles, throttle)
+		}
+	}
+	return throttles, nil
+}
+
+func (store *memoryStore) RecordLoginFailure(ctx context.Context, arg db.RecordLoginFailureParams) (db.LoginThrottle, error) {
+	throttle, ok := store.throttles[arg.Key]
+	if !ok || throttle.LastFailureAt.Before(arg.ResetBefore) {
+		throttle = db.LoginThrottle{Key: arg.Key, LockedUntil: throttle.LockedUntil}
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = time.Now()
+	store.throttles[arg.Key] = throttle
+	return throttle, nil
+}
+
+func (store *memoryStore) LockLoginThrottle(ctx context.Context, arg db.LockLoginThrottleParams) error {
+	throttle := store.throttles[arg.Key]
+	throttle.LockedUntil = arg.LockedUntil
+	store.throttles[arg.Key] = throttle
+	return nil
+}
+
+func (store *memoryStore) ResetLoginThrottle(ctx context.Context, key string) error {
+	delete(store.throttles, key)
+	return nil
+}
+
+func (store *memoryStore) DeleteStaleLoginThrottles(ctx context.Context, lastFailureAt time.Time) error {
+	for key, throttle := range store.throttles {
+		locked := throttle.LockedUntil.Valid && throttle.LockedUntil.Time.After(time.Now())
+		if throttle.LastFailureAt.Before(lastFailureAt) && !locked {
+			delete(store.throttles, key)
+		}
+	}
+	return nil
+}
+
+func (store *memoryStore) CreateLoginAttempt(ctx context.Context, arg db.CreateLoginAttemptParams) error {
+	store.attempts = append(store.attempts, arg)
+	return nil
+}
+
+func (store *memoryStore) DeleteOldLoginAttempts(ctx context.Context, createdAt time.Time) error {
+	return nil
+}
+
+func TestGuard(t *testing.T) {
+	config := Config{
+		MaxAttempts:   3,
+		MaxIPAttempts: 5,
+		Delay:         time.Minute,
+		MaxDelay:      time.Hour,
+		Window:        time.Hour,
+	}
+
+	alice := Attempt{UserID: uuid.New(), Email: "alice@example.com", ClientIP: "203.0.113.1"}
+	fromIP := func(attempt Attempt, clientIP string) Attempt {
+		attempt.ClientIP = clientIP
+		return attempt
+	}
+	withEmail := func(attempt Attempt, email string) Attempt {
+		attempt.UserID = uuid.Nil
+		attempt.Email = email
+		return attempt
+	}
+
+	testCases := []struct {
+		name          string
+		failures      []Attempt
+		succeed       *Attempt
+		check         Attempt
+		checkResponse func(t *testing.T, err error)
+	}{
+		{
+			name:     "BelowLimit",
+			failures: []Attempt{alice, alice},
+			check:    alice,
+			checkResponse: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:     "EmailLocked",
+			failures: []Attempt{alice, alice, alice},
+			check:    fromIP(alice, "198.51.100.1"),
+			checkResponse: func(t *testing.T, err error) {
+				requireLocked(t, err, time.Minute)
+			},
+		},
+		{
+			name:     "EmailCaseInsensitive",
+			failures: []Attempt{alice, alice, alice},
+			check:    withEmail(alice, "ALICE@example.com"),
+			checkResponse: func(t *testing.T, err error) {
+				requireLocked(t, err, time.Minute)
+			},
+		},
+		{
+			name:     "DelayDoubles",
+			failures: []Attempt{alice, alice, alice, alice, alice},
+			check:    alice,
+			checkResponse: func(t *testing.T, err error) {
+				requireLocked(t, err, 4*time.Minute)
+			},
+		},
+		{
+			name: "IPLockedAcrossEmails",
+			failures: []Attempt{
+				withEmail(alice, "a@example.com"),
+				withEmail(alice, "b@example.com"),
+				withEmail(alice, "c@example.com"),
+				withEmail(alice, "d@example.com"),
+				withEmail(alice, "e@example.com"),
+			},
+			check: withEmail(alice, "f@example.com"),
+			checkResponse: func(t *testing.T, err error) {
+				requireLocked(t, err, time.Minute)
+			},
+		},
+		{
+			name: "OtherIPNotLocked",
+			failures: []Attempt{
+				withEmail(alice, "a@example.com"),
+				withEmail(alice, "b@example.com"),
+				withEmail(alice, "c@example.com"),
+				withEmail(alice, "d@example.com"),
+				withEmail(alice, "e@example.com"),
+			},
+			check: withEmail(fromIP(alice, "198.51.100.1"), "f@example.com"),
+			checkResponse: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:     "SuccessResetsEmail",
+			failures: []Attempt{alice, alice},
+			succeed:  &alice,
+			check:    alice,
+			checkResponse: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			guard := New(newMemoryStore(), config)
+			ctx := context.Background()
+
+			for _, attempt := range tc.failures {
+				require.NoError(t, guard.Fail(ctx, attempt))
+			}
+			if tc.succeed != nil {
+				require.NoError(t, guard.Succeed(ctx, *tc.succeed))
+			}
+
+			tc.checkResponse(t, guard.Check(ctx, tc.check.Email, tc.check.ClientIP))
+		})
+	}
+}
+
+func TestGuardSuccessKeepsIPCount(t *testing.T) {
+	guard := New(newMemoryStore(), Config{
+		MaxAttempts:   3,
+		MaxIPAttempts: 3,
+		Delay:         time.Minute,
+		MaxDelay:      time.Hour,
+		Window:        time.Hour,
+	})
+	ctx := context.Background()
+	attempt := Attempt{Email: "alice@example.com", ClientIP: "203.0.113.1"}
+
+	require.NoError(t, guard.Fail(ctx, attempt))
+	require.NoError(t, guard.Fail(ctx, attempt))
+	require.NoError(t, guard.Succeed(ctx, attempt))
+	require.NoError(t, guard.Check(ctx, attempt.Email, attempt.ClientIP))
+
+	require.NoError(t, guard.Fail(ctx, attempt))
+	requireLocked(t, guard.Check(ctx, "bob@example.com", attempt.ClientIP), time.Minute)
+	require.NoError(t, guard.Check(ctx, attempt.Email, "198.51.100.1"))
+}
+
+func TestGuardWindow(t *testing.T) {
+	store := newMemoryStore()
+	guard := New(store, Config{
+		MaxAttempts:   2,
+		MaxIPAttempts: 10,
+		Delay:         time.Minute,
+		MaxDelay:      time.Hour,
+		Window:        time.Hour,
+	})
+	ctx := context.Background()
+	attempt := Attempt{Email: "alice@example.com", ClientIP: "203.0.113.1"}
+
+	require.NoError(t, guard.Fail(ctx, attempt))
+
+	// The first failure falls out of the window before the second one.
+	throttle := store.throttles[emailKey(attempt.Email)]
+	throttle.LastFailureAt = time.Now().Add(-2 * time.Hour)
+	store.throttles[emailKey(attempt.Email)] = throttle
+
+	require.NoError(t, guard.Fail(ctx, attempt))
+	require.NoError(t, guard.Check(ctx, attempt.Email, attempt.ClientIP))
+	require.Equal(t, int32(1), store.throttles[emailKey(attempt.Email)].Failures)
+}
+
+func TestGuardHistory(t *testing.T) {
+	store := newMemoryStore()
+	guard := New(store, Config{MaxAttempts: 5, MaxIPAttempts: 5, Delay: time.Minute, MaxDelay: time.Hour})
+	ctx := context.Background()
+
+	known := Attempt{UserID: uuid.New(), Email: "alice@example.com", ClientIP: "203.0.113.1"}
+	unknown := Attempt{Email: "nobody@example.com", ClientIP: "203.0.113.1"}
+
+	require.NoError(t, guard.Fail(ctx, known))
+	require.NoError(t, guard.Fail(ctx, unknown))
+	require.NoError(t, guard.Succeed(ctx, known))
+
+	require.Len(t, store.attempts, 2)
+	require.False(t, store.attempts[0].Success)
+	require.True(t, store.attempts[1].Success)
+	for _, attempt := range store.attempts {
+		require.Equal(t, known.UserID, attempt.UserID)
+	}
+}
+
+func requireLocked(t *testing.T, err error, retryAfter time.Duration) {
+	var locked *LockedError
+	require.ErrorAs(t, err, &locked)
+	require.InDelta(t, retryAfter.Seconds(), locked.RetryAfter.Seconds(), 1)
+}
@@ -0,0 +1,71 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/mail"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages. Servers only depend on this interface so tests
+// and development setups can swap out SMTP.
+type Mailer interface {
+	Send(message Message) error
+}
+
+// New picks the mailer named by kind: "smtp", "file" or "memory".
+func New(kind string, config Config) (Mailer, error) {
+	switch kind {
+	case "smtp":
+		return NewSMTPMailer(config.SMTPAddress, config.Username, config.Password, config.From)
+	case "file":
+		return NewFileMailer(config.Directory, config.From)
+	case "memory":
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("Unknown mailer %q", kind)
+	}
+}
+
+// Config holds the settings of every mailer, each one reads what it needs.
+type Config struct {
+	From        string
+	SMTPAddress string
+	Username    string
+	Password    string
+	Directory   string
+}
+
+// format renders message as an RFC 5322 email sent by from.
+func format(from string, message Message) ([]byte, error) {
+	if len(message.To) == 0 {
+		return nil, fmt.Errorf("Message has no recipients")
+	}
+	for _, to := range message.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return nil, fmt.Errorf("Invalid recipient %q: %w", to, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	for _, to := range message.To {
+		fmt.Fprintf(&buf, "To: %s\r\n", to)
+	}
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(message.Body)
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,76 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+
+	mailer, err := New("file", Config{Directory: dir, From: "Dropbyte <no-reply@example.com>"})
+	require.NoError(t, err)
+
+	err = mailer.Send(Message{
+		To:      []string{"user@example.com"},
+		Subject: "Verify your email ✓",
+		Body:    "Hello",
+	})
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	content, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	require.Contains(t, string(content), "To: user@example.com\r\n")
+	require.Contains(t, string(content), "Subject: =?utf-8?q?")
+	require.True(t, strings.HasSuffix(string(content), "\r\n\r\nHello"))
+}
+
+func TestMemoryMailer(t *testing.T) {
+	mailer := NewMemoryMailer()
+
+	testCases := []struct {
+		name       string
+		message    Message
+		checkError func(t *testing.T, err error)
+	}{
+		{
+			name:    "OK",
+			message: Message{To: []string{"user@example.com"}, Subject: "Hi", Body: "Body"},
+			checkError: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:    "NoRecipient",
+			message: Message{Subject: "Hi"},
+			checkError: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+		},
+		{
+			name:    "InvalidRecipient",
+			message: Message{To: []string{"not an address"}},
+			checkError: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			tc.checkError(t, mailer.Send(tc.message))
+		})
+	}
+
+	require.Len(t, mailer.Messages(), 1)
+}
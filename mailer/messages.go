@@ -0,0 +1,72 @@
+package mailer
+
+import (
+	"fmt"
+	"time"
+)
+
+func VerificationMessage(to string, fullName string, link string, expiresIn time.Duration) Message {
+	body := fmt.Sprintf(
+		"Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in %s. If you did not create a Dropbyte account, ignore this email.\n",
+		fullName,
+		link,
+		expiresIn,
+	)
+
+	return Message{
+		To:      []string{to},
+		Subject: "Verify your Dropbyte email",
+		Body:    body,
+	}
+}
+
+func PasswordResetMessage(to string, fullName string, link string, expiresIn time.Duration) Message {
+	body := fmt.Sprintf(
+		"Hi %s,\n\nSomeone asked to reset the password of your Dropbyte account. "+
+			"Open the link below to choose a new one:\n\n%s\n\n"+
+			"The link expires in %s and works once. If you did not ask for it, ignore this email.\n",
+		fullName,
+		link,
+		expiresIn,
+	)
+
+	return Message{
+		To:      []string{to},
+		Subject: "Reset your Dropbyte password",
+		Body:    body,
+	}
+}
+
+// MagicLinkMessage doesn't greet by name, the account may not exist until the
+// link is followed.
+func MagicLinkMessage(to string, link string, expiresIn time.Duration) Message {
+	body := fmt.Sprintf(
+		"Hi,\n\nOpen the link below to log in to Dropbyte:\n\n%s\n\n"+
+			"The link expires in %s and works once. If you did not ask for it, ignore this email.\n",
+		link,
+		expiresIn,
+	)
+
+	return Message{
+		To:      []string{to},
+		Subject: "Your Dropbyte login link",
+		Body:    body,
+	}
+}
+
+// EmailChangedMessage warns the previous address that the account moved.
+func EmailChangedMessage(to string, fullName string, newEmail string) Message {
+	body := fmt.Sprintf(
+		"Hi %s,\n\nThe email address of your Dropbyte account was changed to %s. "+
+			"If you did not make this change, reset your password right away.\n",
+		fullName,
+		newEmail,
+	)
+
+	return Message{
+		To:      []string{to},
+		Subject: "Your Dropbyte email was changed",
+		Body:    body,
+	}
+}
@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+)
+
+type SMTPMailer struct {
+	address string
+	auth    smtp.Auth
+	from    string
+}
+
+// NewSMTPMailer sends through the SMTP server at address, authenticating
+// with username and password when a username is set.
+func NewSMTPMailer(address string, username string, password string, from string) (*SMTPMailer, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid SMTP address: %w", err)
+	}
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("Invalid sender address: %w", err)
+	}
+
+	mailer := &SMTPMailer{address: address, from: from}
+	if username != "" {
+		mailer.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return mailer, nil
+}
+
+func (mailer *SMTPMailer) Send(message Message) error {
+	msg, err := format(mailer.from, message)
+	if err != nil {
+		return err
+	}
+
+	sender, err := mail.ParseAddress(mailer.from)
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(mailer.address, mailer.auth, sender.Address, message.To, msg)
+}
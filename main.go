@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"os"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
@@ -18,16 +20,34 @@ import (
 
 	"github.com/liquiddev99/dropbyte-backend/api"
 	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/encryption"
 	"github.com/liquiddev99/dropbyte-backend/gapi"
 	"github.com/liquiddev99/dropbyte-backend/pb"
+	"github.com/liquiddev99/dropbyte-backend/token"
 	"github.com/liquiddev99/dropbyte-backend/util"
+	"github.com/liquiddev99/dropbyte-backend/validation"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "generate-token-key" {
+		runGenerateTokenKey()
+		return
+	}
+
 	config, err := util.LoadConfig(".")
 	if err != nil {
 		log.Fatal("Cannot load config file", err)
 	}
+	util.SetPasswordParams(util.PasswordParamsFromConfig(config))
+
+	passwordPolicy, err := validation.NewPasswordPolicy(
+		config.PasswordMinEntropy,
+		config.BreachedPasswordsFile,
+	)
+	if err != nil {
+		log.Fatal("Cannot load password policy", err)
+	}
+	validation.SetPasswordPolicy(passwordPolicy)
 
 	dbpool, err := pgxpool.New(context.Background(), config.DatabaseUrl)
 	if err != nil {
@@ -39,9 +59,19 @@ func main() {
 
 	runDbMigration(config.MigrationUrl, config.DatabaseUrl)
 
-	runGinServer(config, query)
-	// go runGatewayServer(config, query)
-	// runGrpcServer(config, query)
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		runKeyRotation(config, dbpool)
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "set-role" {
+		runSetRole(query, os.Args[2:])
+		return
+	}
+
+	runGinServer(config, query, dbpool)
+	// go runGatewayServer(config, query, dbpool)
+	// runGrpcServer(config, query, dbpool)
 }
 
 func runDbMigration(migrationUrl string, dbURL string) {
@@ -57,14 +87,70 @@ func runDbMigration(migrationUrl string, dbURL string) {
 	log.Println("DB migrated successfully")
 }
 
+// Print a new Ed25519 key for signing tokens. The seed goes in
+// TOKEN_SIGNING_KEY, the public key is what to add to TOKEN_RETIRED_KEYS once
+// it is replaced.
+func runGenerateTokenKey() {
+	signingKey, publicKey, err := token.GenerateSigningKey()
+	if err != nil {
+		log.Fatal("Failed to generate token key", err)
+	}
+
+	fmt.Println("TOKEN_SIGNING_KEY=" + signingKey)
+	fmt.Println("public key:", publicKey)
+}
+
+// Re-wrap every data key under fresh key-encryption keys. Set
+// PREVIOUS_MASTER_KEY to the old value when the master key changes as well.
+// Run it while no server is accepting uploads.
+func runKeyRotation(config util.Config, dbpool *pgxpool.Pool) {
+	err := encryption.RotateKeys(
+		context.Background(),
+		dbpool,
+		config.PreviousMasterKey,
+		config.MasterKey,
+	)
+	if err != nil {
+		log.Fatal("Failed to rotate keys", err)
+	}
+
+	log.Println("Keys rotated successfully")
+}
+
+// Give the account with an email a role, for example the first admin:
+// dropbyte-backend set-role admin@example.com admin
+func runSetRole(query *db.Queries, args []string) {
+	if len(args) != 2 || !util.ValidRole(args[1]) {
+		log.Fatalf("Usage: set-role <email> <%s|%s>", util.RoleUser, util.RoleAdmin)
+	}
+
+	user, err := query.GetUserByEmail(context.Background(), args[0])
+	if err != nil {
+		log.Fatal("Cannot find user", err)
+	}
+
+	err = query.UpdateUserRole(context.Background(), db.UpdateUserRoleParams{
+		ID:   user.ID,
+		Role: args[1],
+	})
+	if err != nil {
+		log.Fatal("Failed to set role", err)
+	}
+
+	log.Printf("%s is now %s", user.Email, args[1])
+}
+
 // Run gRPC server
-func runGrpcServer(config util.Config, query *db.Queries) {
-	server, err := gapi.NewServer(config, query)
+func runGrpcServer(config util.Config, query *db.Queries, dbpool *pgxpool.Pool) {
+	server, err := gapi.NewServer(config, query, dbpool)
 	if err != nil {
 		log.Fatal("Cannot create server", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		server.AuthInterceptor,
+		server.RateLimitInterceptor,
+	))
 
 	pb.RegisterDropbyteServer(grpcServer, server)
 	reflection.Register(grpcServer)
@@ -82,8 +168,8 @@ func runGrpcServer(config util.Config, query *db.Queries) {
 	}
 }
 
-func runGatewayServer(config util.Config, query *db.Queries) {
-	server, err := gapi.NewServer(config, query)
+func runGatewayServer(config util.Config, query *db.Queries, dbpool *pgxpool.Pool) {
+	server, err := gapi.NewServer(config, query, dbpool)
 	if err != nil {
 		log.Fatal("Cannot create server", err)
 	}
@@ -124,8 +210,8 @@ func runGatewayServer(config util.Config, query *db.Queries) {
 }
 
 // Run HTTP server
-func runGinServer(config util.Config, query *db.Queries) {
-	server, err := api.NewServer(config, query)
+func runGinServer(config util.Config, query *db.Queries, dbpool *pgxpool.Pool) {
+	server, err := api.NewServer(config, query, dbpool)
 	if err != nil {
 		log.Fatal("Cannot create server", err)
 	}
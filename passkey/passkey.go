@@ -0,0 +1,148 @@
+// Package passkey runs the WebAuthn registration and login ceremonies. Logins
+// are discoverable, the authenticator tells which account the passkey belongs
+// to, so no email or password is needed.
+package passkey
+
+import (
+	"errors"
+	"io"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+// ErrClonedAuthenticator is returned when the signature counter of a
+// credential did not increase, which means the private key was copied or the
+// assertion was replayed.
+var ErrClonedAuthenticator = errors.New("Signature counter did not increase, the authenticator may be cloned")
+
+type Config struct {
+	RPID          string
+	RPDisplayName string
+	RPOrigins     []string
+}
+
+type Passkeys struct {
+	webauthn *webauthn.WebAuthn
+}
+
+// User is an account together with the credentials it has registered.
+type User struct {
+	ID          uuid.UUID
+	Name        string
+	DisplayName string
+	Credentials []webauthn.Credential
+}
+
+func (user User) WebAuthnID() []byte {
+	id := user.ID
+	return id[:]
+}
+
+func (user User) WebAuthnName() string {
+	return user.Name
+}
+
+func (user User) WebAuthnDisplayName() string {
+	return user.DisplayName
+}
+
+func (user User) WebAuthnCredentials() []webauthn.Credential {
+	return user.Credentials
+}
+
+func (user User) WebAuthnIcon() string {
+	return ""
+}
+
+// UserLookup finds the owner of a credential during login.
+type UserLookup func(credentialID []byte, userID uuid.UUID) (User, error)
+
+func New(config Config) (*Passkeys, error) {
+	web, err := webauthn.New(&webauthn.Config{
+		RPID:          config.RPID,
+		RPDisplayName: config.RPDisplayName,
+		RPOrigins:     config.RPOrigins,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Passkeys{webauthn: web}, nil
+}
+
+// BeginRegistration returns the options passed to navigator.credentials.create
+// and the session data that has to be kept until FinishRegistration.
+func (passkeys *Passkeys) BeginRegistration(
+	user User,
+) (*protocol.CredentialCreation, *webauthn.SessionData, error) {
+	exclusions := make([]protocol.CredentialDescriptor, len(user.Credentials))
+	for i, credential := range user.Credentials {
+		exclusions[i] = credential.Descriptor()
+	}
+
+	return passkeys.webauthn.BeginRegistration(
+		user,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(exclusions),
+	)
+}
+
+// FinishRegistration checks the response of the authenticator and returns the
+// new credential.
+func (passkeys *Passkeys) FinishRegistration(
+	user User,
+	session webauthn.SessionData,
+	body io.Reader,
+) (*webauthn.Credential, error) {
+	response, err := protocol.ParseCredentialCreationResponseBody(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return passkeys.webauthn.CreateCredential(user, session, response)
+}
+
+// BeginLogin returns the options passed to navigator.credentials.get. The
+// user has to be verified by the authenticator, as the passkey replaces both
+// the password and the second factor.
+func (passkeys *Passkeys) BeginLogin() (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
+	return passkeys.webauthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+}
+
+// FinishLogin checks the assertion and returns the user it belongs to along
+// with the credential, whose signature counter has been updated.
+func (passkeys *Passkeys) FinishLogin(
+	session webauthn.SessionData,
+	body io.Reader,
+	lookup UserLookup,
+) (User, *webauthn.Credential, error) {
+	response, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		return User{}, nil, err
+	}
+
+	var user User
+	handler := func(rawID []byte, userHandle []byte) (webauthn.User, error) {
+		userID, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, err
+		}
+
+		user, err = lookup(rawID, userID)
+		return user, err
+	}
+
+	credential, err := passkeys.webauthn.ValidateDiscoverableLogin(handler, session, response)
+	if err != nil {
+		return User{}, nil, err
+	}
+
+	if credential.Authenticator.CloneWarning {
+		return User{}, nil, ErrClonedAuthenticator
+	}
+
+	return user, credential, nil
+}
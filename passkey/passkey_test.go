@@ -0,0 +1,267 @@
+package passkey
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:3000"
+)
+
+// softAuthenticator is a platform authenticator holding a single P-256
+// credential, enough to run both ceremonies without a browser.
+type softAuthenticator struct {
+	credentialID []byte
+	key          *ecdsa.PrivateKey
+	userHandle   []byte
+	counter      uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	credentialID := make([]byte, 16)
+	_, err = rand.Read(credentialID)
+	require.NoError(t, err)
+
+	return &softAuthenticator{credentialID: credentialID, key: key}
+}
+
+func encode(buf []byte) string {
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func (authenticator *softAuthenticator) clientData(
+	t *testing.T,
+	ceremony string,
+	challenge protocol.URLEncodedBase64,
+	origin string,
+) []byte {
+	clientData, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": encode(challenge),
+		"origin":    origin,
+	})
+	require.NoError(t, err)
+	return clientData
+}
+
+func (authenticator *softAuthenticator) authData(attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+
+	flags := byte(protocol.FlagUserPresent | protocol.FlagUserVerified)
+	if attested != nil {
+		flags |= byte(protocol.FlagAttestedCredentialData)
+	}
+
+	authData := append([]byte(nil), rpIDHash[:]...)
+	authData = append(authData, flags)
+	authData = binary.BigEndian.AppendUint32(authData, authenticator.counter)
+	return append(authData, attested...)
+}
+
+// create answers navigator.credentials.create with a "none" attestation.
+func (authenticator *softAuthenticator) create(
+	t *testing.T,
+	options *protocol.CredentialCreation,
+	origin string,
+) []byte {
+	authenticator.userHandle = options.Response.User.ID.(protocol.URLEncodedBase64)
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1,
+		XCoord: authenticator.key.X.FillBytes(make([]byte, 32)),
+		YCoord: authenticator.key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+
+	attested := make([]byte, 16)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(authenticator.credentialID)))
+	attested = append(attested, authenticator.credentialID...)
+	attested = append(attested, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authenticator.authData(attested),
+	})
+	require.NoError(t, err)
+
+	clientData := authenticator.clientData(t, "webauthn.create", options.Response.Challenge, origin)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":    encode(authenticator.credentialID),
+		"rawId": encode(authenticator.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    encode(clientData),
+			"attestationObject": encode(attestationObject),
+		},
+	})
+	require.NoError(t, err)
+	return body
+}
+
+// get answers navigator.credentials.get, bumping the signature counter.
+func (authenticator *softAuthenticator) get(
+	t *testing.T,
+	options *protocol.CredentialAssertion,
+	origin string,
+) []byte {
+	authenticator.counter++
+	authData := authenticator.authData(nil)
+	clientData := authenticator.clientData(t, "webauthn.get", options.Response.Challenge, origin)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, authenticator.key, digest[:])
+	require.NoError(t, err)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":    encode(authenticator.credentialID),
+		"rawId": encode(authenticator.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    encode(clientData),
+			"authenticatorData": encode(authData),
+			"signature":         encode(signature),
+			"userHandle":        encode(authenticator.userHandle),
+		},
+	})
+	require.NoError(t, err)
+	return body
+}
+
+func newTestPasskeys(t *testing.T) *Passkeys {
+	passkeys, err := New(Config{
+		RPID:          testRPID,
+		RPDisplayName: "Dropbyte",
+		RPOrigins:     []string{testOrigin},
+	})
+	require.NoError(t, err)
+	return passkeys
+}
+
+func register(t *testing.T, passkeys *Passkeys, authenticator *softAuthenticator) User {
+	user := User{ID: uuid.New(), Name: "user@example.com", DisplayName: "User"}
+
+	options, session, err := passkeys.BeginRegistration(user)
+	require.NoError(t, err)
+
+	body := authenticator.create(t, options, testOrigin)
+	credential, err := passkeys.FinishRegistration(user, *session, bytes.NewReader(body))
+	require.NoError(t, err)
+	require.Equal(t, authenticator.credentialID, credential.ID)
+	require.Equal(t, "none", credential.AttestationType)
+
+	user.Credentials = []webauthn.Credential{*credential}
+	return user
+}
+
+func lookupUser(user User) UserLookup {
+	return func(credentialID []byte, userID uuid.UUID) (User, error) {
+		if userID != user.ID || !bytes.Equal(credentialID, user.Credentials[0].ID) {
+			return User{}, errors.New("Unknown credential")
+		}
+		return user, nil
+	}
+}
+
+func TestRegistrationAndLogin(t *testing.T) {
+	passkeys := newTestPasskeys(t)
+	authenticator := newSoftAuthenticator(t)
+	user := register(t, passkeys, authenticator)
+
+	for i := uint32(1); i <= 2; i++ {
+		options, session, err := passkeys.BeginLogin()
+		require.NoError(t, err)
+
+		body := authenticator.get(t, options, testOrigin)
+		loggedIn, credential, err := passkeys.FinishLogin(*session, bytes.NewReader(body), lookupUser(user))
+		require.NoError(t, err)
+		require.Equal(t, user.ID, loggedIn.ID)
+		require.Equal(t, i, credential.Authenticator.SignCount)
+
+		user.Credentials = []webauthn.Credential{*credential}
+	}
+}
+
+func TestRegistrationWrongOrigin(t *testing.T) {
+	passkeys := newTestPasskeys(t)
+	authenticator := newSoftAuthenticator(t)
+	user := User{ID: uuid.New(), Name: "user@example.com", DisplayName: "User"}
+
+	options, session, err := passkeys.BeginRegistration(user)
+	require.NoError(t, err)
+
+	body := authenticator.create(t, options, "https://evil.example.com")
+	_, err = passkeys.FinishRegistration(user, *session, bytes.NewReader(body))
+	require.Error(t, err)
+}
+
+func TestLoginWrongOrigin(t *testing.T) {
+	passkeys := newTestPasskeys(t)
+	authenticator := newSoftAuthenticator(t)
+	user := register(t, passkeys, authenticator)
+
+	options, session, err := passkeys.BeginLogin()
+	require.NoError(t, err)
+
+	body := authenticator.get(t, options, "https://evil.example.com")
+	_, _, err = passkeys.FinishLogin(*session, bytes.NewReader(body), lookupUser(user))
+	require.Error(t, err)
+}
+
+func TestLoginWrongChallenge(t *testing.T) {
+	passkeys := newTestPasskeys(t)
+	authenticator := newSoftAuthenticator(t)
+	user := register(t, passkeys, authenticator)
+
+	options, _, err := passkeys.BeginLogin()
+	require.NoError(t, err)
+	_, session, err := passkeys.BeginLogin()
+	require.NoError(t, err)
+
+	body := authenticator.get(t, options, testOrigin)
+	_, _, err = passkeys.FinishLogin(*session, bytes.NewReader(body), lookupUser(user))
+	require.Error(t, err)
+}
+
+func TestLoginClonedAuthenticator(t *testing.T) {
+	passkeys := newTestPasskeys(t)
+	authenticator := newSoftAuthenticator(t)
+	user := register(t, passkeys, authenticator)
+
+	// The server has already seen a higher counter than the authenticator
+	// is about to send.
+	user.Credentials[0].Authenticator.SignCount = 5
+
+	options, session, err := passkeys.BeginLogin()
+	require.NoError(t, err)
+
+	body := authenticator.get(t, options, testOrigin)
+	_, _, err = passkeys.FinishLogin(*session, bytes.NewReader(body), lookupUser(user))
+	require.ErrorIs(t, err, ErrClonedAuthenticator)
+}
@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+)
+
+// PostgresStore keeps buckets in the rate_limits table so every node shares
+// them. Taking a token is a single upsert, so concurrent requests can't both
+// take the last one.
+type PostgresStore struct {
+	store *db.Queries
+}
+
+func NewPostgresStore(store *db.Queries) *PostgresStore {
+	return &PostgresStore{store: store}
+}
+
+func (store *PostgresStore) Take(ctx context.Context, key string, policy Policy) (bool, time.Duration, error) {
+	bucket, err := store.store.TakeRateLimitToken(ctx, db.TakeRateLimitTokenParams{
+		Key:   key,
+		Burst: policy.Burst,
+		Rate:  policy.Rate,
+	})
+	if err != nil {
+		return false, 0, err
+	}
+
+	if !bucket.Allowed {
+		return false, retryAfter(bucket.Tokens, policy), nil
+	}
+	return true, 0, nil
+}
+
+// Prune drops buckets unused for longer than idle. A dropped bucket starts
+// over full, so idle should be at least the longest refill time.
+func (store *PostgresStore) Prune(ctx context.Context, idle time.Duration) error {
+	return store.store.DeleteIdleRateLimits(ctx, time.Now().Add(-idle))
+}
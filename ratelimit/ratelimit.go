@@ -0,0 +1,144 @@
+// Package ratelimit throttles requests with token buckets. Each policy gives
+// a bucket of Burst tokens per key, refilled at Rate tokens per second, and
+// every request takes one. Buckets live in a Store, in memory for a single
+// node or in Postgres when several nodes share the limits.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+)
+
+type Policy struct {
+	// Rate is how many tokens are added per second.
+	Rate float64
+	// Burst is the size of the bucket, how many requests can be made at once.
+	Burst float64
+}
+
+// idle is how long a bucket takes to fill up again, after which forgetting
+// it makes no difference.
+func (policy Policy) idle(tokens float64) time.Duration {
+	return time.Duration((policy.Burst - tokens) / policy.Rate * float64(time.Second))
+}
+
+type Store interface {
+	// Take removes a token from the bucket of key if there is one. When there
+	// isn't it returns how long until there will be.
+	Take(ctx context.Context, key string, policy Policy) (bool, time.Duration, error)
+}
+
+// Limiter applies named policies. Requests for a policy that isn't
+// configured are let through.
+type Limiter struct {
+	store    Store
+	policies map[string]Policy
+}
+
+func New(store Store, policies map[string]Policy) *Limiter {
+	return &Limiter{store: store, policies: policies}
+}
+
+// Allow takes a token for key from the bucket of the named policy.
+func (limiter *Limiter) Allow(ctx context.Context, name string, key string) (bool, time.Duration, error) {
+	policy, ok := limiter.policies[name]
+	if !ok {
+		return true, 0, nil
+	}
+	return limiter.store.Take(ctx, name+":"+key, policy)
+}
+
+// Prune drops buckets that have been full again for a while, if the store
+// keeps them around. Memory buckets are dropped as they fill.
+func (limiter *Limiter) Prune(ctx context.Context) error {
+	store, ok := limiter.store.(*PostgresStore)
+	if !ok {
+		return nil
+	}
+
+	var idle time.Duration
+	for _, policy := range limiter.policies {
+		if refill := policy.idle(0); refill > idle {
+			idle = refill
+		}
+	}
+	return store.Prune(ctx, idle+time.Hour)
+}
+
+// NewStore returns the store named by kind, "memory" or "postgres". Memory is
+// the default.
+func NewStore(kind string, store *db.Queries) (Store, error) {
+	switch kind {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "postgres":
+		return NewPostgresStore(store), nil
+	default:
+		return nil, fmt.Errorf("Unknown rate limit store %q", kind)
+	}
+}
+
+// ParsePolicies reads policies written as name=count/unit[:burst], comma
+// separated, for example "login=10/m,signup=5/h:2". Units are s, m, h and d.
+// The burst defaults to count.
+func ParsePolicies(spec string) (map[string]Policy, error) {
+	policies := make(map[string]Policy)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, limit, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("Invalid rate limit %q: missing =", entry)
+		}
+
+		limit, burstValue, hasBurst := strings.Cut(limit, ":")
+		countValue, unit, ok := strings.Cut(limit, "/")
+		if !ok {
+			return nil, fmt.Errorf("Invalid rate limit %q: missing /", entry)
+		}
+
+		count, err := strconv.ParseFloat(countValue, 64)
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("Invalid rate limit %q: bad count", entry)
+		}
+
+		period, ok := units[unit]
+		if !ok {
+			return nil, fmt.Errorf("Invalid rate limit %q: unknown unit %q", entry, unit)
+		}
+
+		policy := Policy{Rate: count / period.Seconds(), Burst: count}
+		if hasBurst {
+			burst, err := strconv.ParseFloat(burstValue, 64)
+			if err != nil || burst < 1 {
+				return nil, fmt.Errorf("Invalid rate limit %q: bad burst", entry)
+			}
+			policy.Burst = burst
+		}
+
+		policies[strings.TrimSpace(name)] = policy
+	}
+
+	return policies, nil
+}
+
+var units = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+}
+
+// retryAfter is how long until a bucket holding tokens has a whole one.
+func retryAfter(tokens float64, policy Policy) time.Duration {
+	return time.Duration((1 - tokens) / policy.Rate * float64(time.Second))
+}
@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicies(t *testing.T) {
+	policies, err := ParsePolicies("login=10/m, signup=5/h:2,,api=600/m")
+	require.NoError(t, err)
+	require.Len(t, policies, 3)
+
+	require.InDelta(t, 10.0/60, policies["login"].Rate, 1e-9)
+	require.Equal(t, 10.0, policies["login"].Burst)
+	require.InDelta(t, 5.0/3600, policies["signup"].Rate, 1e-9)
+	require.Equal(t, 2.0, policies["signup"].Burst)
+
+	for _, spec := range []string{"login", "login=10", "login=x/m", "login=10/w", "login=10/m:0"} {
+		_, err := ParsePolicies(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	limiter := New(store, map[string]Policy{
+		"login": {Rate: 1, Burst: 3},
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		allowed, _, err := limiter.Allow(ctx, "login", "ip:1.2.3.4")
+		require.NoError(t, err)
+		require.True(t, allowed)
+	}
+
+	allowed, retryAfter, err := limiter.Allow(ctx, "login", "ip:1.2.3.4")
+	require.NoError(t, err)
+	require.False(t, allowed)
+	require.Equal(t, time.Second, retryAfter)
+
+	// Other keys and other policies have their own buckets.
+	allowed, _, err = limiter.Allow(ctx, "login", "ip:5.6.7.8")
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	allowed, _, err = limiter.Allow(ctx, "unlimited", "ip:1.2.3.4")
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	now = now.Add(1500 * time.Millisecond)
+	allowed, _, err = limiter.Allow(ctx, "login", "ip:1.2.3.4")
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	allowed, retryAfter, err = limiter.Allow(ctx, "login", "ip:1.2.3.4")
+	require.NoError(t, err)
+	require.False(t, allowed)
+	require.Equal(t, 500*time.Millisecond, retryAfter)
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	policy := Policy{Rate: 1, Burst: 2}
+	_, _, err := store.Take(context.Background(), "a", policy)
+	require.NoError(t, err)
+	require.Len(t, store.buckets, 1)
+
+	now = now.Add(sweepInterval + time.Second)
+	_, _, err = store.Take(context.Background(), "b", policy)
+	require.NoError(t, err)
+	require.Len(t, store.buckets, 1)
+	require.Contains(t, store.buckets, "b")
+}
@@ -0,0 +1,44 @@
+package request
+
+type fileInfoResponse struct {
+	FileId        string `json:"fileId"`
+	BucketId      string `json:"bucketId"`
+	FileName      string `json:"fileName"`
+	ContentLength int64  `json:"contentLength"`
+	ContentType   string `json:"contentType"`
+	ContentSha1   string `json:"contentSha1"`
+}
+
+type listFileNamesResponse struct {
+	Files []fileInfoResponse `json:"files"`
+}
+
+func GetFileInfo(fileId string, authToken string) (response fileInfoResponse, err error) {
+	body := map[string]string{"fileId": fileId}
+	err = postJSON("b2_get_file_info", authToken, body, &response)
+	return
+}
+
+// FindFileByName looks up the current version of fileName, reporting false
+// when no such file exists.
+func FindFileByName(
+	bucketId string,
+	fileName string,
+	authToken string,
+) (fileInfoResponse, bool, error) {
+	body := map[string]interface{}{
+		"bucketId":      bucketId,
+		"startFileName": fileName,
+		"maxFileCount":  1,
+	}
+
+	var response listFileNamesResponse
+	if err := postJSON("b2_list_file_names", authToken, body, &response); err != nil {
+		return fileInfoResponse{}, false, err
+	}
+
+	if len(response.Files) == 0 || response.Files[0].FileName != fileName {
+		return fileInfoResponse{}, false, nil
+	}
+	return response.Files[0], true, nil
+}
@@ -0,0 +1,135 @@
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type startLargeFileResponse struct {
+	FileId   string `json:"fileId"`
+	FileName string `json:"fileName"`
+	BucketId string `json:"bucketId"`
+}
+
+type uploadPartUrlResponse struct {
+	FileId             string `json:"fileId"`
+	UploadUrl          string `json:"uploadUrl"`
+	AuthorizationToken string `json:"authorizationToken"`
+}
+
+func StartLargeFile(
+	bucketId string,
+	fileName string,
+	authToken string,
+) (response startLargeFileResponse, err error) {
+	body := map[string]string{
+		"bucketId":    bucketId,
+		"fileName":    fileName,
+		"contentType": "b2/x-auto",
+	}
+	err = postJSON("b2_start_large_file", authToken, body, &response)
+	return
+}
+
+func GetUploadPartUrl(fileId string, authToken string) (response uploadPartUrlResponse, err error) {
+	body := map[string]string{"fileId": fileId}
+	err = postJSON("b2_get_upload_part_url", authToken, body, &response)
+	return
+}
+
+// UploadPart uploads one part of a large file. Part numbers start at 1 and
+// every part but the last must be at least 5MB.
+func UploadPart(
+	uploadUrl string,
+	authToken string,
+	partNumber int,
+	content []byte,
+	contentSha1 string,
+) error {
+	request, err := http.NewRequest(http.MethodPost, uploadUrl, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Authorization", authToken)
+	request.Header.Set("X-Bz-Part-Number", fmt.Sprintf("%d", partNumber))
+	request.Header.Set("X-Bz-Content-Sha1", contentSha1)
+	request.ContentLength = int64(len(content))
+
+	res, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return decodeError(res)
+	}
+
+	return nil
+}
+
+func FinishLargeFile(
+	fileId string,
+	partSha1s []string,
+	authToken string,
+) (response uploadFileResponse, err error) {
+	body := map[string]interface{}{
+		"fileId":        fileId,
+		"partSha1Array": partSha1s,
+	}
+	err = postJSON("b2_finish_large_file", authToken, body, &response)
+	return
+}
+
+func CancelLargeFile(fileId string, authToken string) error {
+	body := map[string]string{"fileId": fileId}
+	return postJSON("b2_cancel_large_file", authToken, body, nil)
+}
+
+func postJSON(operation string, authToken string, body interface{}, response interface{}) error {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(
+		http.MethodPost,
+		"https://api005.backblazeb2.com/b2api/v2/"+operation,
+		bytes.NewReader(jsonBody),
+	)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Authorization", authToken)
+
+	res, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return decodeError(res)
+	}
+
+	if response == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(response)
+}
+
+func decodeError(res *http.Response) error {
+	var errorResponse responseBodyOnError
+	if err := json.NewDecoder(res.Body).Decode(&errorResponse); err != nil {
+		return fmt.Errorf("B2 request failed with %s: %w", res.Status, err)
+	}
+	if errorResponse.Message == "" {
+		return errors.New(res.Status)
+	}
+	return errors.New(errorResponse.Message)
+}
@@ -0,0 +1,175 @@
+package request
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxPresignDuration is the longest the S3-compatible API accepts a presigned
+// URL for.
+const MaxPresignDuration = 7 * 24 * time.Hour
+
+// presignedUpload is a PUT request that stores exactly one object. The URL only
+// works with Headers set as given, Content-Length included.
+type presignedUpload struct {
+	Url       string
+	Headers   map[string]string
+	ExpiresAt time.Time
+}
+
+// PresignUpload signs a PUT of fileName to bucketName through the
+// S3-compatible API. The signature covers the object key, its length and its
+// SHA-1, so the URL can't be used to store anything else.
+func PresignUpload(
+	endpoint string,
+	region string,
+	keyId string,
+	applicationKey string,
+	bucketName string,
+	fileName string,
+	contentLength int64,
+	contentSha1 string,
+	duration time.Duration,
+) (presignedUpload, error) {
+	sha1Sum, err := hex.DecodeString(contentSha1)
+	if err != nil {
+		return presignedUpload{}, fmt.Errorf("invalid sha1 %q: %w", contentSha1, err)
+	}
+	if duration > MaxPresignDuration {
+		duration = MaxPresignDuration
+	}
+
+	headers := map[string]string{
+		"Content-Length":      fmt.Sprintf("%d", contentLength),
+		"X-Amz-Checksum-Sha1": base64.StdEncoding.EncodeToString(sha1Sum),
+	}
+
+	now := time.Now().UTC()
+	signedUrl, err := presign(presignRequest{
+		Method:    "PUT",
+		Endpoint:  endpoint,
+		Path:      "/" + bucketName + "/" + fileName,
+		Region:    region,
+		AccessKey: keyId,
+		SecretKey: applicationKey,
+		Headers:   headers,
+		Time:      now,
+		Expires:   duration,
+	})
+	if err != nil {
+		return presignedUpload{}, err
+	}
+
+	return presignedUpload{
+		Url:       signedUrl,
+		Headers:   headers,
+		ExpiresAt: now.Add(duration),
+	}, nil
+}
+
+type presignRequest struct {
+	Method    string
+	Endpoint  string
+	Path      string
+	Region    string
+	AccessKey string
+	SecretKey string
+	Headers   map[string]string
+	Time      time.Time
+	Expires   time.Duration
+}
+
+// presign builds a URL carrying an AWS Signature Version 4 in its query. The
+// host and every header in req.Headers are signed, the payload is not.
+func presign(req presignRequest) (string, error) {
+	endpoint, err := url.Parse(req.Endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	amzDate := req.Time.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	scope := date + "/" + req.Region + "/s3/aws4_request"
+
+	headers := map[string]string{"host": endpoint.Host}
+	for name, value := range req.Headers {
+		headers[strings.ToLower(name)] = strings.TrimSpace(value)
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", req.AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", fmt.Sprintf("%d", int64(req.Expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+	canonicalQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	canonicalPath := escapePath(req.Path)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath,
+		canonicalQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+req.SecretKey), date)
+	key = hmacSHA256(key, req.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	return fmt.Sprintf(
+		"%s://%s%s?%s&X-Amz-Signature=%s",
+		endpoint.Scheme, endpoint.Host, canonicalPath, canonicalQuery, signature,
+	), nil
+}
+
+// escapePath encodes every byte of path but unreserved characters and slashes.
+func escapePath(path string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			escaped.WriteByte(c)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
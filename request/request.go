@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 )
 
 type authResponse struct {
@@ -29,6 +30,16 @@ type deleteFileResponse struct {
 	StatusCode int    `json:"statusCode"`
 }
 
+type uploadFileResponse struct {
+	FileId        string `json:"fileId"`
+	BucketId      string `json:"bucketId"`
+	FileName      string `json:"fileName"`
+	ContentLength int64  `json:"contentLength"`
+	ContentType   string `json:"contentType"`
+	ContentSha1   string `json:"contentSha1"`
+	StatusCode    int    `json:"statusCode"`
+}
+
 type responseBodyOnError struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
@@ -98,6 +109,44 @@ func GetUploadUrl(bucketId string, authToken string) (response urlResponse, err
 	return response, nil
 }
 
+func UploadFile(
+	uploadUrl string,
+	authToken string,
+	fileName string,
+	content []byte,
+	contentSha1 string,
+) (response uploadFileResponse, err error) {
+	request, err := http.NewRequest(http.MethodPost, uploadUrl, bytes.NewReader(content))
+	if err != nil {
+		return
+	}
+
+	request.Header.Set("Authorization", authToken)
+	request.Header.Set("X-Bz-File-Name", url.QueryEscape(fileName))
+	request.Header.Set("Content-Type", "b2/x-auto")
+	request.Header.Set("X-Bz-Content-Sha1", contentSha1)
+	request.ContentLength = int64(len(content))
+
+	res, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	response.StatusCode = res.StatusCode
+	if res.StatusCode != 200 {
+		return response, decodeError(res)
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		return
+	}
+	response.StatusCode = res.StatusCode
+
+	return response, nil
+}
+
 func DeleteFileById(
 	fileId string,
 	fileName string,
@@ -117,19 +166,15 @@ func DeleteFileById(
 	request.Header.Set("Authorization", authToken)
 
 	res, err := http.DefaultClient.Do(request)
-	response.StatusCode = res.StatusCode
-
-	if res.StatusCode != 200 {
-		var errorResponse responseBodyOnError
-		err = json.NewDecoder(res.Body).Decode(&errorResponse)
-		if err != nil {
-			fmt.Println("Error reading response body:", err)
-		}
-		return response, errors.New(errorResponse.Message)
-	}
 	if err != nil {
 		return
 	}
+	defer res.Body.Close()
+
+	response.StatusCode = res.StatusCode
+	if res.StatusCode != 200 {
+		return response, decodeError(res)
+	}
 
 	resBody, err := ioutil.ReadAll(res.Body)
 	if err != nil {
@@ -156,17 +201,14 @@ func DownloadFileById(fileId string, authToken string) (resBody []byte, err erro
 	request.Header.Set("Authorization", authToken)
 
 	res, err := http.DefaultClient.Do(request)
-	if res.StatusCode != 200 {
-		var errorResponse responseBodyOnError
-		err = json.NewDecoder(res.Body).Decode(&errorResponse)
-		if err != nil {
-			fmt.Println("Error reading response body:", err)
-		}
-		return resBody, errors.New(errorResponse.Message)
-	}
 	if err != nil {
 		return
 	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return resBody, decodeError(res)
+	}
 	resBody, err = ioutil.ReadAll(res.Body)
 
 	if err != nil {
@@ -174,3 +216,33 @@ func DownloadFileById(fileId string, authToken string) (resBody []byte, err erro
 	}
 	return resBody, nil
 }
+
+// OpenFileById streams a file from B2. byteRange is an optional HTTP Range
+// header value; the caller must close the returned body.
+func OpenFileById(fileId string, authToken string, byteRange string) (*http.Response, error) {
+	request, err := http.NewRequest(
+		http.MethodGet,
+		"https://api005.backblazeb2.com/b2api/v2/b2_download_file_by_id?fileId="+fileId,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Authorization", authToken)
+	if byteRange != "" {
+		request.Header.Set("Range", byteRange)
+	}
+
+	res, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusPartialContent {
+		defer res.Body.Close()
+		return nil, decodeError(res)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,145 @@
+// Package sso signs users in through OpenID Connect providers with the
+// authorization code flow and PKCE.
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"github.com/liquiddev99/dropbyte-backend/util"
+)
+
+var defaultScopes = []string{oidc.ScopeOpenID, "email", "profile"}
+
+// Identity is what the provider asserts about the user in the ID token.
+type Identity struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// Provider is a configured OpenID provider. Discovery happens on first use, so
+// an unreachable provider does not keep the server from starting.
+type Provider struct {
+	Name        string
+	config      util.OIDCProviderConfig
+	redirectUrl string
+
+	mutex    sync.Mutex
+	oauth2   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func NewProvider(config util.OIDCProviderConfig, redirectUrl string) *Provider {
+	return &Provider{Name: config.Name, config: config, redirectUrl: redirectUrl}
+}
+
+func (provider *Provider) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	if provider.oauth2 != nil {
+		return provider.oauth2, provider.verifier, nil
+	}
+
+	discovered, err := oidc.NewProvider(ctx, provider.config.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to discover %s: %w", provider.Name, err)
+	}
+
+	scopes := provider.config.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultScopes
+	}
+
+	provider.oauth2 = &oauth2.Config{
+		ClientID:     provider.config.ClientID,
+		ClientSecret: provider.config.ClientSecret,
+		Endpoint:     discovered.Endpoint(),
+		RedirectURL:  provider.redirectUrl,
+		Scopes:       scopes,
+	}
+	provider.verifier = discovered.Verifier(&oidc.Config{ClientID: provider.config.ClientID})
+
+	return provider.oauth2, provider.verifier, nil
+}
+
+// AuthCodeURL returns where to send the browser to sign in. state, nonce and
+// codeVerifier have to be kept until the callback.
+func (provider *Provider) AuthCodeURL(
+	ctx context.Context,
+	state string,
+	nonce string,
+	codeVerifier string,
+) (string, error) {
+	config, _, err := provider.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	return config.AuthCodeURL(
+		state,
+		oidc.Nonce(nonce),
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	), nil
+}
+
+// Exchange redeems the authorization code and validates the ID token: its
+// signature against the provider's JWKS, issuer, audience, expiry and nonce.
+func (provider *Provider) Exchange(
+	ctx context.Context,
+	code string,
+	nonce string,
+	codeVerifier string,
+) (Identity, error) {
+	config, verifier, err := provider.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	token, err := config.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
+	if err != nil {
+		return Identity{}, fmt.Errorf("Failed to exchange code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Identity{}, errors.New("Provider did not return an ID token")
+	}
+
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return Identity{}, fmt.Errorf("Invalid ID token: %w", err)
+	}
+
+	if idToken.Nonce != nonce {
+		return Identity{}, errors.New("Invalid ID token: nonce does not match")
+	}
+
+	var identity Identity
+	if err := idToken.Claims(&identity); err != nil {
+		return Identity{}, err
+	}
+	return identity, nil
+}
+
+// RandomString returns a random URL-safe value for states, nonces and code
+// verifiers.
+func RandomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,270 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/liquiddev99/dropbyte-backend/util"
+)
+
+const (
+	testClientID    = "dropbyte"
+	testRedirectUrl = "http://localhost:8080/oidc/test/callback"
+)
+
+// standInIdP is a minimal OpenID provider. It remembers the PKCE challenge
+// and nonce of the last authorization request and issues a code for it. ID
+// tokens are signed with signingKey while only key is published.
+type standInIdP struct {
+	t          *testing.T
+	server     *httptest.Server
+	key        *rsa.PrivateKey
+	signingKey *rsa.PrivateKey
+	audience   string
+	claims     map[string]interface{}
+
+	challenge string
+	nonce     string
+}
+
+func newStandInIdP(t *testing.T) *standInIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	idp := &standInIdP{
+		t:          t,
+		key:        key,
+		signingKey: key,
+		audience:   testClientID,
+		claims: map[string]interface{}{
+			"sub":            "subject-1",
+			"email":          "user@example.com",
+			"email_verified": true,
+			"name":           "User",
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func (idp *standInIdP) writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	require.NoError(idp.t, json.NewEncoder(w).Encode(body))
+}
+
+func (idp *standInIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := idp.server.URL
+	idp.writeJSON(w, map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"jwks_uri":                              issuer + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (idp *standInIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	idp.writeJSON(w, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &idp.key.PublicKey, KeyID: "key-1", Algorithm: "RS256", Use: "sig"},
+	}})
+}
+
+// authorize skips the login page and redirects straight back with a code.
+func (idp *standInIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	require.Equal(idp.t, "S256", query.Get("code_challenge_method"))
+	idp.challenge = query.Get("code_challenge")
+	idp.nonce = query.Get("nonce")
+
+	redirect := query.Get("redirect_uri") + "?code=code-1&state=" + url.QueryEscape(query.Get("state"))
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+func (idp *standInIdP) token(w http.ResponseWriter, r *http.Request) {
+	require.NoError(idp.t, r.ParseForm())
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if r.PostForm.Get("code") != "code-1" ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != idp.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		idp.writeJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: idp.signingKey},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "key-1"),
+	)
+	require.NoError(idp.t, err)
+
+	claims := map[string]interface{}{
+		"iss":   idp.server.URL,
+		"aud":   idp.audience,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": idp.nonce,
+	}
+	for key, value := range idp.claims {
+		claims[key] = value
+	}
+
+	idToken, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	require.NoError(idp.t, err)
+
+	idp.writeJSON(w, map[string]interface{}{
+		"access_token": "access-1",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+// signIn follows the authorization request to the stand-in IdP and returns
+// the code it redirects back with.
+func (idp *standInIdP) signIn(t *testing.T, authUrl string, state string) string {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	rsp, err := client.Get(authUrl)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusFound, rsp.StatusCode)
+
+	location, err := url.Parse(rsp.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, state, location.Query().Get("state"))
+	return location.Query().Get("code")
+}
+
+func newTestProvider(idp *standInIdP) *Provider {
+	return NewProvider(util.OIDCProviderConfig{
+		Name:     "test",
+		Issuer:   idp.server.URL,
+		ClientID: testClientID,
+	}, testRedirectUrl)
+}
+
+func TestExchange(t *testing.T) {
+	testCases := []struct {
+		name   string
+		modify func(idp *standInIdP)
+		// verifier and nonce replace the values used for the authorization
+		// request when set.
+		verifier string
+		nonce    string
+		check    func(t *testing.T, identity Identity, err error)
+	}{
+		{
+			name: "OK",
+			check: func(t *testing.T, identity Identity, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "subject-1", identity.Subject)
+				require.Equal(t, "user@example.com", identity.Email)
+				require.True(t, identity.EmailVerified)
+				require.Equal(t, "User", identity.Name)
+			},
+		},
+		{
+			name: "UnverifiedEmail",
+			modify: func(idp *standInIdP) {
+				idp.claims["email_verified"] = false
+			},
+			check: func(t *testing.T, identity Identity, err error) {
+				require.NoError(t, err)
+				require.False(t, identity.EmailVerified)
+			},
+		},
+		{
+			name:     "WrongCodeVerifier",
+			verifier: "wrong",
+			check: func(t *testing.T, identity Identity, err error) {
+				require.ErrorContains(t, err, "Failed to exchange code")
+			},
+		},
+		{
+			name:  "WrongNonce",
+			nonce: "wrong",
+			check: func(t *testing.T, identity Identity, err error) {
+				require.ErrorContains(t, err, "nonce")
+			},
+		},
+		{
+			name: "WrongAudience",
+			modify: func(idp *standInIdP) {
+				idp.audience = "someone-else"
+			},
+			check: func(t *testing.T, identity Identity, err error) {
+				require.ErrorContains(t, err, "Invalid ID token")
+			},
+		},
+		{
+			name: "UnknownSigningKey",
+			modify: func(idp *standInIdP) {
+				key, err := rsa.GenerateKey(rand.Reader, 2048)
+				require.NoError(t, err)
+				idp.signingKey = key
+			},
+			check: func(t *testing.T, identity Identity, err error) {
+				require.ErrorContains(t, err, "Invalid ID token")
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			idp := newStandInIdP(t)
+			provider := newTestProvider(idp)
+			ctx := context.Background()
+
+			state, err := RandomString()
+			require.NoError(t, err)
+			nonce, err := RandomString()
+			require.NoError(t, err)
+			verifier, err := RandomString()
+			require.NoError(t, err)
+
+			authUrl, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+			require.NoError(t, err)
+			code := idp.signIn(t, authUrl, state)
+
+			if tc.modify != nil {
+				tc.modify(idp)
+			}
+			if tc.verifier != "" {
+				verifier = tc.verifier
+			}
+			if tc.nonce != "" {
+				nonce = tc.nonce
+			}
+
+			identity, err := provider.Exchange(ctx, code, nonce, verifier)
+			tc.check(t, identity, err)
+		})
+	}
+}
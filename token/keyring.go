@@ -0,0 +1,110 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PublicKey is a verification key as published to other services. Retired
+// keys no longer sign tokens but still verify the ones they signed until
+// those expire.
+type PublicKey struct {
+	ID      string
+	Key     ed25519.PublicKey
+	Retired bool
+}
+
+// Keyring holds the Ed25519 key new tokens are signed with and the public
+// keys of the ones it replaced. Rotating means making a new signing key
+// active and moving the old public key to the retired list.
+type Keyring struct {
+	signingKey ed25519.PrivateKey
+	active     PublicKey
+	keys       map[string]PublicKey
+}
+
+// NewKeyring takes the signing key seed and the retired public keys, all
+// base64url encoded.
+func NewKeyring(signingKey string, retiredKeys []string) (*Keyring, error) {
+	seed, err := base64.RawURLEncoding.DecodeString(signingKey)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf(
+			"Invalid signing key: must be a base64url encoded %d byte seed",
+			ed25519.SeedSize,
+		)
+	}
+
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+
+	keyring := &Keyring{
+		signingKey: privateKey,
+		active:     PublicKey{ID: KeyID(publicKey), Key: publicKey},
+		keys:       make(map[string]PublicKey),
+	}
+	keyring.keys[keyring.active.ID] = keyring.active
+
+	for _, retiredKey := range retiredKeys {
+		retiredKey = strings.TrimSpace(retiredKey)
+		if retiredKey == "" {
+			continue
+		}
+
+		key, err := base64.RawURLEncoding.DecodeString(retiredKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("Invalid retired key %q", retiredKey)
+		}
+
+		id := KeyID(key)
+		if _, ok := keyring.keys[id]; ok {
+			continue
+		}
+		keyring.keys[id] = PublicKey{ID: id, Key: key, Retired: true}
+	}
+
+	return keyring, nil
+}
+
+// GenerateSigningKey returns a new signing key seed and its public key, both
+// base64url encoded.
+func GenerateSigningKey() (string, string, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	seed := base64.RawURLEncoding.EncodeToString(privateKey.Seed())
+	return seed, base64.RawURLEncoding.EncodeToString(publicKey), nil
+}
+
+// KeyID derives the id of a public key from its hash, so it doesn't need to
+// be configured alongside the key.
+func KeyID(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// PublicKeys lists the active key first, then the retired ones.
+func (keyring *Keyring) PublicKeys() []PublicKey {
+	var retired []PublicKey
+	for _, key := range keyring.keys {
+		if key.Retired {
+			retired = append(retired, key)
+		}
+	}
+	sort.Slice(retired, func(i, j int) bool {
+		return retired[i].ID < retired[j].ID
+	})
+
+	return append([]PublicKey{keyring.active}, retired...)
+}
+
+func (keyring *Keyring) publicKey(id string) (PublicKey, bool) {
+	key, ok := keyring.keys[id]
+	return key, ok
+}
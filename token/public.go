@@ -0,0 +1,103 @@
+package token
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/o1egl/paseto"
+)
+
+// PublicPaseto signs v2.public tokens with the active key of its keyring, so
+// other services can verify them with the published public keys alone.
+type PublicPaseto struct {
+	paseto  *paseto.V2
+	keyring *Keyring
+}
+
+// KeySet is implemented by makers whose tokens can be verified with public
+// keys.
+type KeySet interface {
+	PublicKeys() []PublicKey
+}
+
+// footer names the key a token was signed with.
+type footer struct {
+	KeyID string `json:"kid"`
+}
+
+func NewPublicMaker(keyring *Keyring) Token {
+	return &PublicPaseto{paseto: paseto.NewV2(), keyring: keyring}
+}
+
+// New picks the public-key maker when a signing key is configured and the
+// symmetric one otherwise. retiredKeys is a comma separated list.
+func New(symmetricKey string, signingKey string, retiredKeys string) (Token, error) {
+	if signingKey == "" {
+		return NewMaker(symmetricKey)
+	}
+
+	keyring, err := NewKeyring(signingKey, strings.Split(retiredKeys, ","))
+	if err != nil {
+		return nil, err
+	}
+	return NewPublicMaker(keyring), nil
+}
+
+func (maker *PublicPaseto) CreateToken(
+	userId uuid.UUID,
+	sessionId uuid.UUID,
+	tokenType string,
+	duration time.Duration,
+) (string, *Payload, error) {
+	return maker.CreateScopedToken(userId, sessionId, tokenType, Claims{}, duration)
+}
+
+func (maker *PublicPaseto) CreateScopedToken(
+	userId uuid.UUID,
+	sessionId uuid.UUID,
+	tokenType string,
+	claims Claims,
+	duration time.Duration,
+) (string, *Payload, error) {
+	payload, err := newPayload(userId, sessionId, tokenType, claims, duration)
+	if err != nil {
+		return "", nil, err
+	}
+
+	active := maker.keyring.active
+	token, err := maker.paseto.Sign(maker.keyring.signingKey, payload, footer{KeyID: active.ID})
+	if err != nil {
+		return "", nil, err
+	}
+	return token, payload, nil
+}
+
+func (maker *PublicPaseto) VerifyToken(token string, tokenType string) (*Payload, error) {
+	var keyFooter footer
+	if err := paseto.ParseFooter(token, &keyFooter); err != nil {
+		return nil, err
+	}
+
+	key, ok := maker.keyring.publicKey(keyFooter.KeyID)
+	if !ok {
+		return nil, errors.New("Token was signed with an unknown key")
+	}
+
+	payload := &Payload{}
+	if err := maker.paseto.Verify(token, key.Key, payload, nil); err != nil {
+		return nil, err
+	}
+
+	if err := payload.check(tokenType); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// PublicKeys lists the keys tokens from this maker can be verified with.
+func (maker *PublicPaseto) PublicKeys() []PublicKey {
+	return maker.keyring.PublicKeys()
+}
@@ -0,0 +1,85 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKeyring(t *testing.T, retired ...string) (*Keyring, string) {
+	signingKey, publicKey, err := GenerateSigningKey()
+	require.NoError(t, err)
+
+	keyring, err := NewKeyring(signingKey, retired)
+	require.NoError(t, err)
+	return keyring, publicKey
+}
+
+func TestPublicToken(t *testing.T) {
+	keyring, _ := newTestKeyring(t)
+	maker := NewPublicMaker(keyring)
+
+	userId := uuid.New()
+	token, _, err := maker.CreateToken(userId, uuid.New(), AccessToken, time.Minute)
+	require.NoError(t, err)
+	require.Contains(t, token, "v2.public.")
+
+	payload, err := maker.VerifyToken(token, AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, userId, payload.UserId)
+
+	_, err = maker.VerifyToken(token, RefreshToken)
+	require.EqualError(t, err, "Invalid token type")
+}
+
+func TestPublicTokenKeyRotation(t *testing.T) {
+	oldKeyring, oldPublicKey := newTestKeyring(t)
+	oldMaker := NewPublicMaker(oldKeyring)
+
+	token, _, err := oldMaker.CreateToken(uuid.New(), uuid.New(), AccessToken, time.Minute)
+	require.NoError(t, err)
+
+	// The old key is retired, tokens it signed still verify.
+	keyring, _ := newTestKeyring(t, oldPublicKey)
+	maker := NewPublicMaker(keyring)
+
+	_, err = maker.VerifyToken(token, AccessToken)
+	require.NoError(t, err)
+
+	keys := maker.(KeySet).PublicKeys()
+	require.Len(t, keys, 2)
+	require.False(t, keys[0].Retired)
+	require.True(t, keys[1].Retired)
+
+	// Once it's dropped from the keyring they are rejected.
+	keyring, _ = newTestKeyring(t)
+	maker = NewPublicMaker(keyring)
+
+	_, err = maker.VerifyToken(token, AccessToken)
+	require.EqualError(t, err, "Token was signed with an unknown key")
+}
+
+func TestPublicTokenRejectsLocal(t *testing.T) {
+	symmetric, err := NewMaker("12345678901234567890123456789012")
+	require.NoError(t, err)
+
+	token, _, err := symmetric.CreateToken(uuid.New(), uuid.New(), AccessToken, time.Minute)
+	require.NoError(t, err)
+
+	keyring, _ := newTestKeyring(t)
+	_, err = NewPublicMaker(keyring).VerifyToken(token, AccessToken)
+	require.Error(t, err)
+}
+
+func TestNewKeyringInvalidKey(t *testing.T) {
+	_, err := NewKeyring("too-short", nil)
+	require.Error(t, err)
+
+	signingKey, _, err := GenerateSigningKey()
+	require.NoError(t, err)
+
+	_, err = NewKeyring(signingKey, []string{"not-a-key"})
+	require.Error(t, err)
+}
@@ -10,9 +10,43 @@ import (
 	"github.com/o1egl/paseto"
 )
 
+// Token types keep refresh tokens from being accepted as access tokens and
+// the other way around. MFA tokens only prove the password was checked and
+// are exchanged for a session once the second factor is.
+const (
+	AccessToken  = "access"
+	RefreshToken = "refresh"
+	MFAToken     = "mfa"
+)
+
+// Audiences record which client a token was minted for. Share tokens are
+// handed to someone else and only work on routes that accept them.
+const (
+	AudienceWeb   = "web"
+	AudienceCLI   = "cli"
+	AudienceShare = "share"
+)
+
+// Claims narrow what a token grants. Without scopes a token grants whatever
+// its session can do, and without a resource it isn't bound to one object.
+// Tokens minted with an API key name the key instead of a session, so they
+// stop working once the key is deleted.
+type Claims struct {
+	Audience string
+	Scopes   []string
+	Resource string
+	KeyId    uuid.UUID
+}
+
 type Payload struct {
 	TokenId   uuid.UUID `json:"token_id"`
 	UserId    uuid.UUID `json:"user_id"`
+	SessionId uuid.UUID `json:"session_id"`
+	Type      string    `json:"type"`
+	Audience  string    `json:"audience,omitempty"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	Resource  string    `json:"resource,omitempty"`
+	KeyId     uuid.UUID `json:"key_id"`
 	IssuedAt  time.Time `json:"issued_at"`
 	ExpiredAt time.Time `json:"expired_at"`
 }
@@ -23,8 +57,20 @@ type Paseto struct {
 }
 
 type Token interface {
-	CreateToken(userId uuid.UUID, duration time.Duration) (string, error)
-	VerifyToken(token string) (*Payload, error)
+	CreateToken(
+		userId uuid.UUID,
+		sessionId uuid.UUID,
+		tokenType string,
+		duration time.Duration,
+	) (string, *Payload, error)
+	CreateScopedToken(
+		userId uuid.UUID,
+		sessionId uuid.UUID,
+		tokenType string,
+		claims Claims,
+		duration time.Duration,
+	) (string, *Payload, error)
+	VerifyToken(token string, tokenType string) (*Payload, error)
 }
 
 func NewMaker(key string) (Token, error) {
@@ -38,23 +84,35 @@ func NewMaker(key string) (Token, error) {
 	return maker, nil
 }
 
-func (maker *Paseto) CreateToken(userId uuid.UUID, duration time.Duration) (string, error) {
-	tokenId, err := uuid.NewRandom()
+func (maker *Paseto) CreateToken(
+	userId uuid.UUID,
+	sessionId uuid.UUID,
+	tokenType string,
+	duration time.Duration,
+) (string, *Payload, error) {
+	return maker.CreateScopedToken(userId, sessionId, tokenType, Claims{}, duration)
+}
+
+func (maker *Paseto) CreateScopedToken(
+	userId uuid.UUID,
+	sessionId uuid.UUID,
+	tokenType string,
+	claims Claims,
+	duration time.Duration,
+) (string, *Payload, error) {
+	payload, err := newPayload(userId, sessionId, tokenType, claims, duration)
 	if err != nil {
-		return "", err
-	}
-	payload := &Payload{
-		TokenId:   tokenId,
-		UserId:    userId,
-		IssuedAt:  time.Now(),
-		ExpiredAt: time.Now().Add(duration),
+		return "", nil, err
 	}
 
 	token, err := maker.paseto.Encrypt(maker.symmetricKey, payload, nil)
-	return token, nil
+	if err != nil {
+		return "", nil, err
+	}
+	return token, payload, nil
 }
 
-func (maker *Paseto) VerifyToken(token string) (*Payload, error) {
+func (maker *Paseto) VerifyToken(token string, tokenType string) (*Payload, error) {
 	payload := &Payload{}
 
 	err := maker.paseto.Decrypt(token, maker.symmetricKey, &payload, nil)
@@ -62,17 +120,84 @@ func (maker *Paseto) VerifyToken(token string) (*Payload, error) {
 		return nil, err
 	}
 
-	err = payload.CheckExpired()
-	if err != nil {
+	if err := payload.check(tokenType); err != nil {
 		return nil, err
 	}
 
 	return payload, nil
 }
 
+func newPayload(
+	userId uuid.UUID,
+	sessionId uuid.UUID,
+	tokenType string,
+	claims Claims,
+	duration time.Duration,
+) (*Payload, error) {
+	tokenId, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	return &Payload{
+		TokenId:   tokenId,
+		UserId:    userId,
+		SessionId: sessionId,
+		Type:      tokenType,
+		Audience:  claims.Audience,
+		Scopes:    claims.Scopes,
+		Resource:  claims.Resource,
+		KeyId:     claims.KeyId,
+		IssuedAt:  time.Now(),
+		ExpiredAt: time.Now().Add(duration),
+	}, nil
+}
+
+// check verifies the claims every maker checks once the token is decoded.
+func (payload *Payload) check(tokenType string) error {
+	if payload.Type != tokenType {
+		return errors.New("Invalid token type")
+	}
+	return payload.CheckExpired()
+}
+
 func (payload *Payload) CheckExpired() error {
 	if time.Now().After(payload.ExpiredAt) {
 		return errors.New("Token has expired")
 	}
 	return nil
 }
+
+// CheckAudience returns an error unless the token was minted for one of
+// audiences.
+func (payload *Payload) CheckAudience(audiences ...string) error {
+	for _, audience := range audiences {
+		if payload.Audience == audience {
+			return nil
+		}
+	}
+	return fmt.Errorf("Token is not valid for audience %q", payload.Audience)
+}
+
+// HasScope reports whether the token grants scope.
+func (payload *Payload) HasScope(scope string) bool {
+	if len(payload.Scopes) == 0 {
+		return true
+	}
+	for _, granted := range payload.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Restricted reports whether the token was narrowed by scopes or a resource,
+// so it doesn't stand in for a full login session.
+func (payload *Payload) Restricted() bool {
+	return len(payload.Scopes) > 0 || payload.Resource != ""
+}
+
+// AllowsResource reports whether the token may be used on resource.
+func (payload *Payload) AllowsResource(resource string) bool {
+	return payload.Resource == "" || payload.Resource == resource
+}
@@ -0,0 +1,114 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyToken(t *testing.T) {
+	maker, err := NewMaker("12345678901234567890123456789012")
+	require.NoError(t, err)
+
+	userId := uuid.New()
+	sessionId := uuid.New()
+
+	testCases := []struct {
+		name       string
+		tokenType  string
+		verifyType string
+		duration   time.Duration
+		checkError func(t *testing.T, payload *Payload, err error)
+	}{
+		{
+			name:       "Access",
+			tokenType:  AccessToken,
+			verifyType: AccessToken,
+			duration:   time.Minute,
+			checkError: func(t *testing.T, payload *Payload, err error) {
+				require.NoError(t, err)
+				require.Equal(t, userId, payload.UserId)
+				require.Equal(t, sessionId, payload.SessionId)
+				require.Equal(t, AccessToken, payload.Type)
+			},
+		},
+		{
+			name:       "RefreshAsAccess",
+			tokenType:  RefreshToken,
+			verifyType: AccessToken,
+			duration:   time.Minute,
+			checkError: func(t *testing.T, payload *Payload, err error) {
+				require.Error(t, err)
+				require.Nil(t, payload)
+			},
+		},
+		{
+			name:       "Expired",
+			tokenType:  RefreshToken,
+			verifyType: RefreshToken,
+			duration:   -time.Minute,
+			checkError: func(t *testing.T, payload *Payload, err error) {
+				require.EqualError(t, err, "Token has expired")
+				require.Nil(t, payload)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			token, _, err := maker.CreateToken(userId, sessionId, tc.tokenType, tc.duration)
+			require.NoError(t, err)
+
+			payload, err := maker.VerifyToken(token, tc.verifyType)
+			tc.checkError(t, payload, err)
+		})
+	}
+}
+
+func TestScopedToken(t *testing.T) {
+	maker, err := NewMaker("12345678901234567890123456789012")
+	require.NoError(t, err)
+
+	fileId := uuid.NewString()
+	claims := Claims{
+		Audience: AudienceShare,
+		Scopes:   []string{"files:read"},
+		Resource: fileId,
+	}
+
+	token, _, err := maker.CreateScopedToken(uuid.New(), uuid.New(), AccessToken, claims, time.Minute)
+	require.NoError(t, err)
+
+	payload, err := maker.VerifyToken(token, AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, claims.Scopes, payload.Scopes)
+	require.True(t, payload.Restricted())
+
+	require.NoError(t, payload.CheckAudience(AudienceWeb, AudienceShare))
+	require.Error(t, payload.CheckAudience(AudienceWeb, AudienceCLI))
+
+	require.True(t, payload.HasScope("files:read"))
+	require.False(t, payload.HasScope("files:write"))
+
+	require.True(t, payload.AllowsResource(fileId))
+	require.False(t, payload.AllowsResource(uuid.NewString()))
+}
+
+func TestSessionTokenGrantsEverything(t *testing.T) {
+	maker, err := NewMaker("12345678901234567890123456789012")
+	require.NoError(t, err)
+
+	claims := Claims{Audience: AudienceWeb}
+	token, _, err := maker.CreateScopedToken(uuid.New(), uuid.New(), AccessToken, claims, time.Minute)
+	require.NoError(t, err)
+
+	payload, err := maker.VerifyToken(token, AccessToken)
+	require.NoError(t, err)
+	require.False(t, payload.Restricted())
+	require.True(t, payload.HasScope("files:write"))
+	require.True(t, payload.AllowsResource(uuid.NewString()))
+}
@@ -0,0 +1,59 @@
+package totp
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	db "github.com/liquiddev99/dropbyte-backend/db/sqlc"
+	"github.com/liquiddev99/dropbyte-backend/encryption"
+)
+
+var ErrInvalidSecondFactor = errors.New("Invalid authentication code")
+
+// CheckSecondFactor accepts either a TOTP code or an unused recovery code of
+// user. Every code works only once, even within its time window.
+func CheckSecondFactor(
+	ctx context.Context,
+	store *db.Queries,
+	keyring *encryption.Keyring,
+	user db.User,
+	code string,
+	recoveryCode string,
+) error {
+	if recoveryCode != "" {
+		rows, err := store.UseRecoveryCode(ctx, db.UseRecoveryCodeParams{
+			UserID:   user.ID,
+			CodeHash: HashRecoveryCode(recoveryCode),
+		})
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrInvalidSecondFactor
+		}
+		return nil
+	}
+
+	secret, err := keyring.UnwrapSecret(user.TotpSecret)
+	if err != nil {
+		return err
+	}
+
+	step, ok := Validate(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidSecondFactor
+	}
+
+	rows, err := store.UseUserTotpStep(ctx, db.UseUserTotpStepParams{
+		ID:           user.ID,
+		TotpLastStep: step,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrInvalidSecondFactor
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// The RFC 6238 test vectors for SHA1, truncated to 6 digits.
+func TestCode(t *testing.T) {
+	secret := []byte("12345678901234567890")
+
+	testCases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.code, func(t *testing.T) {
+			require.Equal(t, tc.code, Code(secret, Step(time.Unix(tc.unix, 0))))
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Now()
+	step := Step(now)
+
+	testCases := []struct {
+		name string
+		code string
+		ok   bool
+	}{
+		{"Current", Code(secret, step), true},
+		{"Previous", Code(secret, step-1), true},
+		{"Next", Code(secret, step+1), true},
+		{"TooOld", Code(secret, step-2), false},
+		{"TooShort", Code(secret, step)[1:], false},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			_, ok := Validate(secret, tc.code, now)
+			require.Equal(t, tc.ok, ok)
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Dropbyte", "user@example.com", []byte("12345678901234567890"))
+
+	require.True(t, strings.HasPrefix(uri, "otpauth://totp/Dropbyte:user@example.com?"))
+	require.Contains(t, uri, "secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	require.Contains(t, uri, "issuer=Dropbyte")
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	require.NoError(t, err)
+	require.Len(t, codes, RecoveryCodeCount)
+
+	for _, code := range codes {
+		require.Len(t, code, 11)
+		require.Equal(t, HashRecoveryCode(code), HashRecoveryCode(strings.ToUpper(code)))
+		require.Equal(t, HashRecoveryCode(code), HashRecoveryCode(strings.ReplaceAll(code, "-", "")))
+	}
+}
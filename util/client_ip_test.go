@@ -0,0 +1,83 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		clientIP   string
+	}{
+		{
+			name:       "NoProxy",
+			remoteAddr: "203.0.113.7:51234",
+			clientIP:   "203.0.113.7",
+		},
+		{
+			name:       "UntrustedPeerForwarding",
+			remoteAddr: "203.0.113.7:51234",
+			forwarded:  []string{"198.51.100.1"},
+			clientIP:   "203.0.113.7",
+		},
+		{
+			name:       "TrustedProxy",
+			remoteAddr: "10.1.2.3:443",
+			forwarded:  []string{"198.51.100.1"},
+			clientIP:   "198.51.100.1",
+		},
+		{
+			name:       "SpoofedBehindTrustedProxy",
+			remoteAddr: "10.1.2.3:443",
+			forwarded:  []string{"1.2.3.4", "198.51.100.1"},
+			clientIP:   "198.51.100.1",
+		},
+		{
+			name:       "ProxyChain",
+			remoteAddr: "192.168.1.1",
+			forwarded:  []string{"198.51.100.1", " 10.0.0.5"},
+			clientIP:   "198.51.100.1",
+		},
+		{
+			name:       "InvalidHop",
+			remoteAddr: "10.1.2.3:443",
+			forwarded:  []string{"unknown"},
+			clientIP:   "10.1.2.3",
+		},
+		{
+			name:       "IPv6Peer",
+			remoteAddr: "[2001:db8::1]:51234",
+			clientIP:   "2001:db8::1",
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.clientIP, ClientIP(tc.remoteAddr, tc.forwarded, trusted))
+		})
+	}
+}
+
+func TestSplitForwarded(t *testing.T) {
+	hops := SplitForwarded([]string{"198.51.100.1, 10.0.0.5", "10.1.2.3"})
+	require.Equal(t, []string{"198.51.100.1", " 10.0.0.5", "10.1.2.3"}, hops)
+	require.Empty(t, SplitForwarded(nil))
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	_, err := ParseTrustedProxies([]string{"not-an-ip"})
+	require.Error(t, err)
+
+	networks, err := ParseTrustedProxies([]string{"", "::1", "172.16.0.0/12"})
+	require.NoError(t, err)
+	require.Len(t, networks, 2)
+}
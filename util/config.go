@@ -1,25 +1,98 @@
 package util
 
 import (
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	HTTPServerAddress    string        `mapstructure:"HTTP_SERVER_ADDRESS"`
-	GRPCServerAddress    string        `mapstructure:"GRPC_SERVER_ADDRESS"`
-	DatabaseUrl          string        `mapstructure:"DATABASE_URL"`
-	OriginAllowed        string        `mapstructure:"ORIGIN_ALLOWED"`
-	B2ApplicationKeyId   string        `mapstructure:"B2_APPLICATION_KEY_ID"`
-	BucketId             string        `mapstructure:"BUCKET_ID"`
-	BucketName           string        `mapstructure:"BUCKET_NAME"`
-	B2ApplicationKey     string        `mapstructure:"B2_APPLICATION_KEY"`
-	SymmetricKey         string        `mapstructure:"SYMMETRIC_KEY"`
-	MigrationUrl         string        `mapstructure:"MIGRATION_URL"`
-	Domain               string        `mapstructure:"DOMAIN"`
-	AccessTokenDuration  time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
-	RefreshTokenDuration time.Duration `mapstructure:"REFRESH_TOKEN_DURATION"`
+	HTTPServerAddress         string        `mapstructure:"HTTP_SERVER_ADDRESS"`
+	GRPCServerAddress         string        `mapstructure:"GRPC_SERVER_ADDRESS"`
+	DatabaseUrl               string        `mapstructure:"DATABASE_URL"`
+	OriginAllowed             string        `mapstructure:"ORIGIN_ALLOWED"`
+	TrustedProxies            []string      `mapstructure:"TRUSTED_PROXIES"`
+	B2ApplicationKeyId        string        `mapstructure:"B2_APPLICATION_KEY_ID"`
+	BucketId                  string        `mapstructure:"BUCKET_ID"`
+	BucketName                string        `mapstructure:"BUCKET_NAME"`
+	B2ApplicationKey          string        `mapstructure:"B2_APPLICATION_KEY"`
+	B2S3Endpoint              string        `mapstructure:"B2_S3_ENDPOINT"`
+	B2S3Region                string        `mapstructure:"B2_S3_REGION"`
+	SymmetricKey              string        `mapstructure:"SYMMETRIC_KEY"`
+	MasterKey                 string        `mapstructure:"MASTER_KEY"`
+	PreviousMasterKey         string        `mapstructure:"PREVIOUS_MASTER_KEY"`
+	MigrationUrl              string        `mapstructure:"MIGRATION_URL"`
+	Domain                    string        `mapstructure:"DOMAIN"`
+	MaxUploadSize             int64         `mapstructure:"MAX_UPLOAD_SIZE"`
+	UploadExpiration          time.Duration `mapstructure:"UPLOAD_EXPIRATION"`
+	DirectUploadDuration      time.Duration `mapstructure:"DIRECT_UPLOAD_DURATION"`
+	UnverifiedMaxUploadSize   int64         `mapstructure:"UNVERIFIED_MAX_UPLOAD_SIZE"`
+	DefaultStorageQuota       int64         `mapstructure:"DEFAULT_STORAGE_QUOTA"`
+	PublicUrl                 string        `mapstructure:"PUBLIC_URL"`
+	Mailer                    string        `mapstructure:"MAILER"`
+	MailFrom                  string        `mapstructure:"MAIL_FROM"`
+	MailDirectory             string        `mapstructure:"MAIL_DIRECTORY"`
+	SMTPAddress               string        `mapstructure:"SMTP_ADDRESS"`
+	SMTPUsername              string        `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword              string        `mapstructure:"SMTP_PASSWORD"`
+	EmailVerificationDuration time.Duration `mapstructure:"EMAIL_VERIFICATION_DURATION"`
+	PasswordResetUrl          string        `mapstructure:"PASSWORD_RESET_URL"`
+	PasswordResetDuration     time.Duration `mapstructure:"PASSWORD_RESET_DURATION"`
+	TotpIssuer                string        `mapstructure:"TOTP_ISSUER"`
+	MFAChallengeDuration      time.Duration `mapstructure:"MFA_CHALLENGE_DURATION"`
+	WebauthnRPID              string        `mapstructure:"WEBAUTHN_RP_ID"`
+	WebauthnRPName            string        `mapstructure:"WEBAUTHN_RP_NAME"`
+	WebauthnChallengeDuration time.Duration `mapstructure:"WEBAUTHN_CHALLENGE_DURATION"`
+	OIDCProviderNames         string        `mapstructure:"OIDC_PROVIDERS"`
+	OIDCLoginRedirectUrl      string        `mapstructure:"OIDC_LOGIN_REDIRECT_URL"`
+	OIDCLoginDuration         time.Duration `mapstructure:"OIDC_LOGIN_DURATION"`
+	AccessTokenDuration       time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
+	RefreshTokenDuration      time.Duration `mapstructure:"REFRESH_TOKEN_DURATION"`
+	DownloadTokenDuration     time.Duration `mapstructure:"DOWNLOAD_TOKEN_DURATION"`
+	TokenSigningKey           string        `mapstructure:"TOKEN_SIGNING_KEY"`
+	TokenRetiredKeys          string        `mapstructure:"TOKEN_RETIRED_KEYS"`
+	Argon2Memory              uint32        `mapstructure:"ARGON2_MEMORY"`
+	Argon2Iterations          uint32        `mapstructure:"ARGON2_ITERATIONS"`
+	Argon2Parallelism         uint8         `mapstructure:"ARGON2_PARALLELISM"`
+	PasswordMinEntropy        float64       `mapstructure:"PASSWORD_MIN_ENTROPY"`
+	BreachedPasswordsFile     string        `mapstructure:"BREACHED_PASSWORDS_FILE"`
+	LoginMaxAttempts          int32         `mapstructure:"LOGIN_MAX_ATTEMPTS"`
+	LoginMaxIPAttempts        int32         `mapstructure:"LOGIN_MAX_IP_ATTEMPTS"`
+	LoginLockoutDuration      time.Duration `mapstructure:"LOGIN_LOCKOUT_DURATION"`
+	LoginMaxLockoutDuration   time.Duration `mapstructure:"LOGIN_MAX_LOCKOUT_DURATION"`
+	LoginAttemptWindow        time.Duration `mapstructure:"LOGIN_ATTEMPT_WINDOW"`
+	LoginHistoryRetention     time.Duration `mapstructure:"LOGIN_HISTORY_RETENTION"`
+	ReauthDuration            time.Duration `mapstructure:"REAUTH_DURATION"`
+	RateLimitStore            string        `mapstructure:"RATE_LIMIT_STORE"`
+	RateLimits                string        `mapstructure:"RATE_LIMITS"`
+	MagicLinkUrl              string        `mapstructure:"MAGIC_LINK_URL"`
+	MagicLinkDuration         time.Duration `mapstructure:"MAGIC_LINK_DURATION"`
+	MagicLinkSignup           bool          `mapstructure:"MAGIC_LINK_SIGNUP"`
+	LoginProviders            string        `mapstructure:"LOGIN_PROVIDERS"`
+	LDAPUrl                   string        `mapstructure:"LDAP_URL"`
+	LDAPStartTLS              bool          `mapstructure:"LDAP_START_TLS"`
+	LDAPBindDN                string        `mapstructure:"LDAP_BIND_DN"`
+	LDAPBindPassword          string        `mapstructure:"LDAP_BIND_PASSWORD"`
+	LDAPBaseDN                string        `mapstructure:"LDAP_BASE_DN"`
+	LDAPUserFilter            string        `mapstructure:"LDAP_USER_FILTER"`
+	LDAPIDAttribute           string        `mapstructure:"LDAP_ID_ATTRIBUTE"`
+	LDAPEmailAttribute        string        `mapstructure:"LDAP_EMAIL_ATTRIBUTE"`
+	LDAPNameAttribute         string        `mapstructure:"LDAP_NAME_ATTRIBUTE"`
+	LDAPGroupAttribute        string        `mapstructure:"LDAP_GROUP_ATTRIBUTE"`
+	LDAPRoleGroups            string        `mapstructure:"LDAP_ROLE_GROUPS"`
+
+	OIDCProviders []OIDCProviderConfig `mapstructure:"-"`
+}
+
+// OIDCProviderConfig is read from the OIDC_<NAME>_* keys of every provider
+// listed in OIDC_PROVIDERS.
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
 }
 
 func LoadConfig(path string) (config Config, err error) {
@@ -35,5 +108,25 @@ func LoadConfig(path string) (config Config, err error) {
 	}
 
 	err = viper.Unmarshal(&config)
+	if err != nil {
+		return
+	}
+
+	for _, name := range strings.Split(config.OIDCProviderNames, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := OIDCProviderConfig{
+			Name:         name,
+			Issuer:       viper.GetString(prefix + "ISSUER"),
+			ClientID:     viper.GetString(prefix + "CLIENT_ID"),
+			ClientSecret: viper.GetString(prefix + "CLIENT_SECRET"),
+			Scopes:       strings.Fields(viper.GetString(prefix + "SCOPES")),
+		}
+		config.OIDCProviders = append(config.OIDCProviders, provider)
+	}
 	return
 }
@@ -1,20 +1,199 @@
 package util
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Passwords are hashed with Argon2id and stored in the PHC string format,
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>, which records the algorithm
+// version and parameters next to the hash. Hashes from before the switch are
+// bcrypt and are upgraded the next time their owner logs in.
+
+const argon2idPrefix = "$argon2id$"
+
+var ErrPasswordMismatch = errors.New("Password is incorrect")
+
+type PasswordParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultPasswordParams follow the second recommended option of RFC 9106.
+var DefaultPasswordParams = PasswordParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var passwordParams = DefaultPasswordParams
+
+// SetPasswordParams changes the parameters new hashes are made with. Existing
+// hashes made with other parameters are rehashed on login.
+func SetPasswordParams(params PasswordParams) {
+	passwordParams = params
+}
+
+// PasswordParamsFromConfig fills in the parameters config leaves unset with
+// the defaults.
+func PasswordParamsFromConfig(config Config) PasswordParams {
+	params := DefaultPasswordParams
+	if config.Argon2Memory != 0 {
+		params.Memory = config.Argon2Memory
+	}
+	if config.Argon2Iterations != 0 {
+		params.Iterations = config.Argon2Iterations
+	}
+	if config.Argon2Parallelism != 0 {
+		params.Parallelism = config.Argon2Parallelism
+	}
+	return params
+}
+
 func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
+	params := passwordParams
+
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
 		return "", errors.New("Failed to hash password")
 	}
 
-	return string(hashedPassword), nil
+	key := argon2.IDKey(
+		[]byte(password),
+		salt,
+		params.Iterations,
+		params.Memory,
+		params.Parallelism,
+		params.KeyLength,
+	)
+
+	return fmt.Sprintf(
+		"%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		params.Memory,
+		params.Iterations,
+		params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
 }
 
 func CheckPassword(password string, hashedPassword string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	if !strings.HasPrefix(hashedPassword, argon2idPrefix) {
+		err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return ErrPasswordMismatch
+		}
+		return err
+	}
+
+	params, salt, key, err := decodeArgon2id(hashedPassword)
+	if err != nil {
+		return err
+	}
+
+	otherKey := argon2.IDKey(
+		[]byte(password),
+		salt,
+		params.Iterations,
+		params.Memory,
+		params.Parallelism,
+		params.KeyLength,
+	)
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return ErrPasswordMismatch
+	}
+
+	return nil
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// CheckDummyPassword takes as long as checking a real password. Logins for
+// emails without an account call it so they can't be told apart by timing.
+func CheckDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = HashPassword("dummy password")
+	})
+	CheckPassword(password, dummyHash)
+}
+
+// NeedsRehash reports whether hashedPassword was made with bcrypt or with
+// other parameters than the current ones.
+func NeedsRehash(hashedPassword string) bool {
+	if !strings.HasPrefix(hashedPassword, argon2idPrefix) {
+		return true
+	}
+
+	params, salt, _, err := decodeArgon2id(hashedPassword)
+	if err != nil {
+		return true
+	}
+
+	current := passwordParams
+	return params.Memory != current.Memory ||
+		params.Iterations != current.Iterations ||
+		params.Parallelism != current.Parallelism ||
+		params.KeyLength != current.KeyLength ||
+		uint32(len(salt)) != current.SaltLength
+}
+
+func decodeArgon2id(hashedPassword string) (PasswordParams, []byte, []byte, error) {
+	var params PasswordParams
+	invalid := errors.New("Invalid password hash")
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, invalid
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, invalid
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("Unsupported argon2 version %d", version)
+	}
+
+	_, err := fmt.Sscanf(
+		parts[3],
+		"m=%d,t=%d,p=%d",
+		&params.Memory,
+		&params.Iterations,
+		&params.Parallelism,
+	)
+	if err != nil {
+		return params, nil, nil, invalid
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, invalid
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, invalid
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
 }
@@ -0,0 +1,53 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPassword(t *testing.T) {
+	// Longer than the 72 bytes bcrypt would truncate to.
+	password := strings.Repeat("a", 80)
+
+	hashedPassword, err := HashPassword(password)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hashedPassword, "$argon2id$v=19$m=65536,t=3,p=2$"))
+	require.False(t, NeedsRehash(hashedPassword))
+
+	require.NoError(t, CheckPassword(password, hashedPassword))
+	require.ErrorIs(t, CheckPassword(strings.Repeat("a", 79)+"b", hashedPassword), ErrPasswordMismatch)
+
+	otherHash, err := HashPassword(password)
+	require.NoError(t, err)
+	require.NotEqual(t, hashedPassword, otherHash)
+}
+
+func TestLegacyBcryptPassword(t *testing.T) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	require.NoError(t, CheckPassword("secret", string(hashedPassword)))
+	require.ErrorIs(t, CheckPassword("wrong", string(hashedPassword)), ErrPasswordMismatch)
+	require.True(t, NeedsRehash(string(hashedPassword)))
+}
+
+func TestPasswordParamsChange(t *testing.T) {
+	hashedPassword, err := HashPassword("secret")
+	require.NoError(t, err)
+
+	params := DefaultPasswordParams
+	params.Iterations = 4
+	SetPasswordParams(params)
+	defer SetPasswordParams(DefaultPasswordParams)
+
+	require.True(t, NeedsRehash(hashedPassword))
+	require.NoError(t, CheckPassword("secret", hashedPassword))
+}
+
+func TestCheckPasswordInvalidHash(t *testing.T) {
+	require.Error(t, CheckPassword("secret", "$argon2id$v=19$m=1$salt"))
+	require.Error(t, CheckPassword("secret", "$argon2id$v=18$m=65536,t=3,p=2$c2FsdA$a2V5"))
+}
@@ -0,0 +1,11 @@
+package util
+
+// Roles stored in users.role. Every account starts as a user.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
+}
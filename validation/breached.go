@@ -0,0 +1,120 @@
+package validation
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// BreachedPasswords looks passwords up in a local copy of the Pwned Passwords
+// dataset, so the check works offline and no password or hash ever leaves the
+// server. The file has one "SHA1:COUNT" line per breached password, in
+// uppercase hex and ordered by hash. That is what the k-anonymity range API
+// returns for every 5 character prefix, with the prefix put back in front of
+// each suffix.
+//
+// The file is binary searched in place rather than loaded, the full dataset
+// is tens of gigabytes.
+type BreachedPasswords struct {
+	file *os.File
+	size int64
+}
+
+// maxLineLength bounds a "SHA1:COUNT" line, counts have at most a few digits.
+const maxLineLength = 64
+
+func OpenBreachedPasswords(path string) (*BreachedPasswords, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &BreachedPasswords{file: file, size: info.Size()}, nil
+}
+
+func (breached *BreachedPasswords) Close() error {
+	return breached.file.Close()
+}
+
+// Contains reports whether password appears in the dataset.
+func (breached *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := []byte(strings.ToUpper(hex.EncodeToString(sum[:])))
+
+	low, high := int64(0), breached.size
+	for low < high {
+		mid := low + (high-low)/2
+
+		line, start, err := breached.lineFrom(mid)
+		if err != nil {
+			return false, err
+		}
+		if line == nil {
+			high = mid
+			continue
+		}
+
+		lineHash, _, _ := bytes.Cut(bytes.TrimRight(line, "\r"), []byte(":"))
+		switch bytes.Compare(bytes.ToUpper(lineHash), hash) {
+		case 0:
+			return true, nil
+		case -1:
+			low = start + int64(len(line)) + 1
+		default:
+			high = mid
+		}
+	}
+
+	return false, nil
+}
+
+// lineFrom returns the first line starting at or after offset, and where it
+// starts. It returns a nil line past the last one.
+func (breached *BreachedPasswords) lineFrom(offset int64) ([]byte, int64, error) {
+	start := offset
+	if offset > 0 {
+		// Back up one byte so a line starting right at offset is kept.
+		start = offset - 1
+	}
+
+	buf := make([]byte, 2*maxLineLength+1)
+	n, err := breached.file.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+	eof := n < len(buf)
+	buf = buf[:n]
+
+	if offset > 0 {
+		newline := bytes.IndexByte(buf, '\n')
+		if newline < 0 {
+			return nil, 0, nil
+		}
+		buf = buf[newline+1:]
+		start += int64(newline) + 1
+	}
+
+	if len(buf) == 0 {
+		return nil, 0, nil
+	}
+
+	end := bytes.IndexByte(buf, '\n')
+	if end < 0 {
+		if !eof {
+			return nil, 0, errors.New("Breached password dataset has an invalid line")
+		}
+		end = len(buf)
+	}
+
+	return buf[:end], start, nil
+}
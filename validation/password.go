@@ -0,0 +1,150 @@
+package validation
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// DefaultMinEntropy rejects short single-class passwords and long runs of the
+// same few characters, while leaving passphrases alone.
+const DefaultMinEntropy = 50
+
+// PasswordPolicy is what passwords must meet when they are set. Logging in
+// only checks the length, so tightening the policy doesn't lock anyone out.
+type PasswordPolicy struct {
+	MinEntropy float64
+	// Breached is optional, without it the check is skipped.
+	Breached *BreachedPasswords
+}
+
+var passwordPolicy = PasswordPolicy{MinEntropy: DefaultMinEntropy}
+
+func SetPasswordPolicy(policy PasswordPolicy) {
+	passwordPolicy = policy
+}
+
+// NewPasswordPolicy opens the breached password dataset at breachedFile, if
+// one is configured.
+func NewPasswordPolicy(minEntropy float64, breachedFile string) (PasswordPolicy, error) {
+	policy := PasswordPolicy{MinEntropy: minEntropy}
+	if breachedFile == "" {
+		return policy, nil
+	}
+
+	breached, err := OpenBreachedPasswords(breachedFile)
+	if err != nil {
+		return policy, err
+	}
+	policy.Breached = breached
+	return policy, nil
+}
+
+// ValidateNewPassword checks a password that is about to be set. personal
+// holds the account's email and name, which the password must not contain.
+func ValidateNewPassword(value string, personal ...string) error {
+	if err := ValidatePassword(value); err != nil {
+		return err
+	}
+
+	if PasswordEntropy(value) < passwordPolicy.MinEntropy {
+		return fmt.Errorf("Is too easy to guess, use a longer password or more kinds of characters")
+	}
+
+	if err := ValidatePersonalInfo(value, personal...); err != nil {
+		return err
+	}
+
+	if passwordPolicy.Breached != nil {
+		breached, err := passwordPolicy.Breached.Contains(value)
+		if err != nil {
+			// A broken dataset shouldn't stop people from signing up.
+			log.Println("Failed to check breached passwords", err)
+		} else if breached {
+			return fmt.Errorf("Has appeared in a data breach, choose a different password")
+		}
+	}
+
+	return nil
+}
+
+// ValidatePersonalInfo rejects passwords containing the email, its local
+// part, or a word of the name.
+func ValidatePersonalInfo(value string, personal ...string) error {
+	password := strings.ToLower(value)
+
+	for _, info := range personal {
+		info = strings.ToLower(strings.TrimSpace(info))
+
+		parts := strings.Fields(info)
+		if local, _, ok := strings.Cut(info, "@"); ok {
+			parts = append(parts, info, local)
+		}
+
+		for _, part := range parts {
+			if len(part) >= 3 && strings.Contains(password, part) {
+				return fmt.Errorf("Must not contain your email or name")
+			}
+		}
+	}
+
+	return nil
+}
+
+// PasswordEntropy estimates the bits of entropy in a password from the
+// character classes it uses. Repeated characters add a single bit each, so
+// "aaaaaaaaaaaa" doesn't count as long.
+func PasswordEntropy(value string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range value {
+		switch {
+		case r > unicode.MaxASCII:
+			other = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	bitsPerChar := math.Log2(float64(pool))
+	seen := make(map[rune]bool)
+
+	entropy := 0.0
+	for _, r := range value {
+		if seen[r] {
+			entropy++
+			continue
+		}
+		seen[r] = true
+		entropy += bitsPerChar
+	}
+
+	return entropy
+}
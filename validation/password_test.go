@@ -0,0 +1,120 @@
+package validation
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeBreachedPasswords writes a dataset file in the Pwned Passwords format,
+// with some filler so the search has to narrow down.
+func writeBreachedPasswords(t *testing.T, passwords ...string) string {
+	var lines []string
+	for _, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		lines = append(lines, strings.ToUpper(hex.EncodeToString(sum[:]))+":42")
+	}
+	for i := 0; i < 500; i++ {
+		sum := sha1.Sum([]byte(fmt.Sprintf("filler-%d", i)))
+		lines = append(lines, fmt.Sprintf("%s:%d", strings.ToUpper(hex.EncodeToString(sum[:])), i))
+	}
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "pwned-passwords.txt")
+	err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600)
+	require.NoError(t, err)
+	return path
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	path := writeBreachedPasswords(t, "password123", "Tr0ub4dor&3")
+
+	breached, err := OpenBreachedPasswords(path)
+	require.NoError(t, err)
+	defer breached.Close()
+
+	for _, password := range []string{"password123", "Tr0ub4dor&3", "filler-0", "filler-499"} {
+		found, err := breached.Contains(password)
+		require.NoError(t, err)
+		require.True(t, found, password)
+	}
+
+	for _, password := range []string{"", "correct horse battery staple", "filler-500"} {
+		found, err := breached.Contains(password)
+		require.NoError(t, err)
+		require.False(t, found, password)
+	}
+}
+
+func TestValidateNewPassword(t *testing.T) {
+	policy, err := NewPasswordPolicy(DefaultMinEntropy, writeBreachedPasswords(t, "Tr0ub4dor&3"))
+	require.NoError(t, err)
+	SetPasswordPolicy(policy)
+	defer SetPasswordPolicy(PasswordPolicy{MinEntropy: DefaultMinEntropy})
+
+	testCases := []struct {
+		name     string
+		password string
+		personal []string
+		errMsg   string
+	}{
+		{
+			name:     "OK",
+			password: "correct horse battery staple",
+			personal: []string{"alice@example.com", "Alice Smith"},
+		},
+		{
+			name:     "TooShort",
+			password: "aB3$",
+			errMsg:   "Must contain from 6-100 characters",
+		},
+		{
+			name:     "LowEntropy",
+			password: "aaaaaaaaaaaaaaaa",
+			errMsg:   "Is too easy to guess, use a longer password or more kinds of characters",
+		},
+		{
+			name:     "ContainsEmail",
+			password: "my-alice-is-Very-Long-42",
+			personal: []string{"alice@example.com", "Bob Jones"},
+			errMsg:   "Must not contain your email or name",
+		},
+		{
+			name:     "ContainsName",
+			password: "JONES-rules-forever-99",
+			personal: []string{"bob@example.com", "Bob Jones"},
+			errMsg:   "Must not contain your email or name",
+		},
+		{
+			name:     "Breached",
+			password: "Tr0ub4dor&3",
+			errMsg:   "Has appeared in a data breach, choose a different password",
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateNewPassword(tc.password, tc.personal...)
+			if tc.errMsg == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tc.errMsg)
+		})
+	}
+}
+
+func TestPasswordEntropy(t *testing.T) {
+	require.Zero(t, PasswordEntropy(""))
+	require.Less(t, PasswordEntropy("aaaaaaaa"), PasswordEntropy("abcdefgh"))
+	require.Less(t, PasswordEntropy("abcdefgh"), PasswordEntropy("abcdEFG1"))
+}